@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"os"
 	"time"
+	"urlcutter/internal/handler"
 
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/gorilla/mux"
@@ -20,10 +21,13 @@ type URL struct {
 	Short     string    `json:"short_url"`
 	CreatedAt time.Time `json:"created_at"`
 	Clicks    int       `json:"clicks"`
+	// 0 — статус по умолчанию (302)
+	RedirectType int `json:"redirect_type,omitempty"`
 }
 
 type CreateURLRequest struct {
-	URL string `json:"url"`
+	URL          string `json:"url"`
+	RedirectType int    `json:"redirect_type,omitempty"`
 }
 
 type CreateURLResponse struct {
@@ -86,7 +90,8 @@ func createTable(db *sql.DB) error {
 		original_url TEXT NOT NULL,
 		short_url VARCHAR(10) UNIQUE NOT NULL,
 		created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-		clicks INT DEFAULT 0
+		clicks INT DEFAULT 0,
+		redirect_type SMALLINT NOT NULL DEFAULT 0
 	)`
 
 	_, err := db.Exec(createTableQuery)
@@ -94,6 +99,11 @@ func createTable(db *sql.DB) error {
 		return fmt.Errorf("failed to create table: %v", err)
 	}
 
+	// Таблицы, созданные до появления redirect_type
+	if _, err := db.Exec("ALTER TABLE urls ADD COLUMN redirect_type SMALLINT NOT NULL DEFAULT 0"); err != nil {
+		log.Printf("Note: redirect_type column not added: %v", err)
+	}
+
 	// Создаем индексы отдельными командами
 	indexQueries := []string{
 		"CREATE INDEX IF NOT EXISTS idx_short_url ON urls(short_url)",
@@ -176,6 +186,13 @@ func createShortURLHandler(db *sql.DB) http.HandlerFunc {
 			return
 		}
 
+		switch req.RedirectType {
+		case 0, http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		default:
+			http.Error(w, "redirect_type must be one of 301, 302, 307, 308", http.StatusBadRequest)
+			return
+		}
+
 		// Проверяем, не сокращали ли уже этот URL
 		var existingURL URL
 		err := db.QueryRow("SELECT short_url FROM urls WHERE original_url = ?", req.URL).Scan(&existingURL.Short)
@@ -192,8 +209,8 @@ func createShortURLHandler(db *sql.DB) http.HandlerFunc {
 
 		// Сохраняем в базу данных
 		_, err = db.Exec(
-			"INSERT INTO urls (id, original_url, short_url, created_at, clicks) VALUES (?, ?, ?, ?, ?)",
-			shortURL, req.URL, shortURL, time.Now(), 0,
+			"INSERT INTO urls (id, original_url, short_url, created_at, clicks, redirect_type) VALUES (?, ?, ?, ?, ?, ?)",
+			shortURL, req.URL, shortURL, time.Now(), 0, req.RedirectType,
 		)
 
 		if err != nil {
@@ -216,9 +233,9 @@ func getURLInfoHandler(db *sql.DB) http.HandlerFunc {
 
 		var url URL
 		err := db.QueryRow(
-			"SELECT id, original_url, short_url, created_at, clicks FROM urls WHERE short_url = ?",
+			"SELECT id, original_url, short_url, created_at, clicks, redirect_type FROM urls WHERE short_url = ?",
 			short,
-		).Scan(&url.ID, &url.Original, &url.Short, &url.CreatedAt, &url.Clicks)
+		).Scan(&url.ID, &url.Original, &url.Short, &url.CreatedAt, &url.Clicks, &url.RedirectType)
 
 		if err != nil {
 			if err == sql.ErrNoRows {
@@ -241,7 +258,8 @@ func redirectHandler(db *sql.DB) http.HandlerFunc {
 		short := vars["short"]
 
 		var originalURL string
-		err := db.QueryRow("SELECT original_url FROM urls WHERE short_url = ?", short).Scan(&originalURL)
+		var redirectType int
+		err := db.QueryRow("SELECT original_url, redirect_type FROM urls WHERE short_url = ?", short).Scan(&originalURL, &redirectType)
 
 		if err != nil {
 			if err == sql.ErrNoRows {
@@ -261,7 +279,10 @@ func redirectHandler(db *sql.DB) http.HandlerFunc {
 			}
 		}()
 
-		http.Redirect(w, r, originalURL, http.StatusFound)
+		if redirectType == 0 {
+			redirectType = http.StatusFound
+		}
+		handler.WriteRedirect(w, r, originalURL, redirectType)
 	}
 }
 
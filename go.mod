@@ -6,3 +6,10 @@ require (
 	github.com/go-sql-driver/mysql v1.7.1
 	github.com/gorilla/mux v1.8.0
 )
+
+require github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+
+require (
+	golang.org/x/net v0.17.0
+	golang.org/x/text v0.13.0 // indirect
+)
@@ -0,0 +1,219 @@
+package blocklist
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Формат файла — по одному правилу на строку, # — комментарий:
+//
+//	https://evil.example/login      точный URL
+//	evil.example                    хост
+//	.evil.example, *.evil.example   домен вместе с поддоменами
+//	prefix:https://evil.example/p   префикс URL
+//	regex:^https?://[^/]*paypa1\.   регулярное выражение по всему URL
+//	sha256:1a2b3c4d                 префикс SHA-256 от выражения host/path (как в Safe Browsing)
+type rules struct {
+	urls     map[string]bool
+	hosts    map[string]bool
+	domains  []string
+	prefixes []string
+	regexps  []*regexp.Regexp
+	hashes   []string
+}
+
+// Blocklist — список опасных адресов из локального файла с перечитыванием при изменении
+type Blocklist struct {
+	path string
+
+	mu      sync.RWMutex
+	rules   *rules
+	modTime time.Time
+}
+
+// Load читает список из файла
+func Load(path string) (*Blocklist, error) {
+	b := &Blocklist{path: path}
+	if _, err := b.Reload(); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Reload перечитывает файл, если он изменился, и сообщает, были ли изменения
+func (b *Blocklist) Reload() (bool, error) {
+	info, err := os.Stat(b.path)
+	if err != nil {
+		return false, err
+	}
+
+	b.mu.RLock()
+	unchanged := b.rules != nil && info.ModTime().Equal(b.modTime)
+	b.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	f, err := os.Open(b.path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	r, err := parse(f)
+	if err != nil {
+		return false, fmt.Errorf("parse blocklist %s: %w", b.path, err)
+	}
+
+	b.mu.Lock()
+	b.rules = r
+	b.modTime = info.ModTime()
+	b.mu.Unlock()
+	return true, nil
+}
+
+// Watch раз в interval проверяет файл и вызывает onChange после успешного перечитывания.
+// Возвращает функцию остановки.
+func (b *Blocklist) Watch(interval time.Duration, onChange func()) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				changed, err := b.Reload()
+				if err != nil {
+					log.Printf("Failed to reload blocklist: %v", err)
+					continue
+				}
+				if changed && onChange != nil {
+					onChange()
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() { once.Do(func() { close(done) }) }
+}
+
+// Match проверяет URL и возвращает правило, которому он соответствует
+func (b *Blocklist) Match(raw string) (string, bool) {
+	b.mu.RLock()
+	r := b.rules
+	b.mu.RUnlock()
+	if r == nil {
+		return "", false
+	}
+
+	if r.urls[raw] {
+		return raw, true
+	}
+	for _, p := range r.prefixes {
+		if strings.HasPrefix(raw, p) {
+			return "prefix:" + p, true
+		}
+	}
+	for _, re := range r.regexps {
+		if re.MatchString(raw) {
+			return "regex:" + re.String(), true
+		}
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return "", false
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if r.hosts[host] {
+		return host, true
+	}
+	for _, d := range r.domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return "." + d, true
+		}
+	}
+	if len(r.hashes) > 0 {
+		for _, expr := range hashExpressions(host, parsed.EscapedPath()) {
+			sum := sha256.Sum256([]byte(expr))
+			digest := hex.EncodeToString(sum[:])
+			for _, h := range r.hashes {
+				if strings.HasPrefix(digest, h) {
+					return "sha256:" + h, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+func parse(rd io.Reader) (*rules, error) {
+	r := &rules{urls: make(map[string]bool), hosts: make(map[string]bool)}
+
+	scanner := bufio.NewScanner(rd)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(text, "prefix:"):
+			r.prefixes = append(r.prefixes, strings.TrimPrefix(text, "prefix:"))
+		case strings.HasPrefix(text, "regex:"):
+			re, err := regexp.Compile(strings.TrimPrefix(text, "regex:"))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			r.regexps = append(r.regexps, re)
+		case strings.HasPrefix(text, "sha256:"):
+			h := strings.ToLower(strings.TrimPrefix(text, "sha256:"))
+			if _, err := hex.DecodeString(h); err != nil || len(h) < 8 {
+				return nil, fmt.Errorf("line %d: invalid hash prefix %q", line, h)
+			}
+			r.hashes = append(r.hashes, h)
+		case strings.Contains(text, "://"):
+			r.urls[text] = true
+		case strings.HasPrefix(text, "*."):
+			r.domains = append(r.domains, strings.ToLower(text[2:]))
+		case strings.HasPrefix(text, "."):
+			r.domains = append(r.domains, strings.ToLower(text[1:]))
+		default:
+			r.hosts[strings.ToLower(text)] = true
+		}
+	}
+	return r, scanner.Err()
+}
+
+// hashExpressions строит выражения host/path для хоста и его родительских доменов
+func hashExpressions(host, path string) []string {
+	if path == "" {
+		path = "/"
+	}
+
+	var exprs []string
+	for h := host; h != ""; {
+		exprs = append(exprs, h+"/", h+path)
+		i := strings.IndexByte(h, '.')
+		if i < 0 || !strings.Contains(h[i+1:], ".") {
+			break
+		}
+		h = h[i+1:]
+	}
+	return exprs
+}
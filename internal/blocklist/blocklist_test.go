@@ -0,0 +1,60 @@
+package blocklist
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	sum := sha256.Sum256([]byte("malware.example/"))
+	list := strings.Join([]string{
+		"# comment",
+		"https://bad.example/exact",
+		"host.example",
+		"*.suffix.example",
+		"prefix:https://docs.example/phish/",
+		`regex:^https?://[^/]*paypa1\.`,
+		"sha256:" + hex.EncodeToString(sum[:])[:8],
+	}, "\n")
+
+	r, err := parse(strings.NewReader(list))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	b := &Blocklist{rules: r}
+
+	blocked := []string{
+		"https://bad.example/exact",
+		"https://HOST.example/anything",
+		"https://a.b.suffix.example/",
+		"https://suffix.example/",
+		"https://docs.example/phish/page",
+		"http://login.paypa1.com/",
+		"https://www.malware.example/download.exe",
+	}
+	for _, u := range blocked {
+		if _, ok := b.Match(u); !ok {
+			t.Errorf("expected %s to be blocked", u)
+		}
+	}
+
+	allowed := []string{
+		"https://bad.example/other",
+		"https://sub.host.example/",
+		"https://docs.example/guide",
+		"https://example.com/",
+	}
+	for _, u := range allowed {
+		if rule, ok := b.Match(u); ok {
+			t.Errorf("expected %s to be allowed, matched %s", u, rule)
+		}
+	}
+}
+
+func TestParse_InvalidRegex(t *testing.T) {
+	if _, err := parse(strings.NewReader("regex:(")); err == nil {
+		t.Fatalf("expected error for invalid regex")
+	}
+}
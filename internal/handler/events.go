@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+	"urlcutter/internal/pubsub"
+
+	"github.com/gorilla/mux"
+)
+
+// sseHeartbeat — как часто в поток пишется комментарий, чтобы прокси не закрыли
+// молчащее соединение
+const sseHeartbeat = 15 * time.Second
+
+// ClickEvents отдаёт переходы по ссылке потоком Server-Sent Events
+func (h *Handler) ClickEvents(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.requireOwner(w, r)
+	if !ok {
+		return
+	}
+	sub, err := h.service.SubscribeClicks(r.Context(), owner, r.URL.Query().Get(domainParam), mux.Vars(r)["short"])
+	if err != nil {
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return
+	}
+	h.streamClicks(w, r, sub)
+}
+
+// WorkspaceClickEvents отдаёт переходы по всем ссылкам владельца потоком Server-Sent Events
+func (h *Handler) WorkspaceClickEvents(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.requireOwner(w, r)
+	if !ok {
+		return
+	}
+	sub, err := h.service.SubscribeOwnerClicks(r.Context(), owner)
+	if err != nil {
+		http.Error(w, "Click stream is not available", http.StatusServiceUnavailable)
+		return
+	}
+	h.streamClicks(w, r, sub)
+}
+
+// streamClicks пишет события подписки, пока клиент не отключится. Если клиент не успевает
+// читать и брокер закрыл подписку, перед закрытием потока отправляется событие overflow.
+func (h *Handler) streamClicks(w http.ResponseWriter, r *http.Request, sub *pubsub.Subscription) {
+	defer sub.Close()
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// nginx иначе буферизует ответ целиком
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, ": connected\n\n")
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case event, ok := <-sub.Events:
+			if !ok {
+				if sub.Slow() {
+					fmt.Fprint(w, "event: overflow\ndata: {}\n\n")
+					flusher.Flush()
+				}
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				return
+			}
+			fmt.Fprintf(w, "event: click\ndata: %s\n\n", data)
+		}
+		flusher.Flush()
+	}
+}
@@ -2,24 +2,94 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
 	"urlcutter/internal/service"
 
 	"github.com/gorilla/mux"
 )
 
+// apiKeyHeader — ключ API; владелец определяется только по проверенному ключу
+const apiKeyHeader = "X-API-Key"
+
+// domainParam — query-параметр API с брендированным доменом ссылки
+const domainParam = "domain"
+
+// previewSuffix после кода (/abc123+) открывает страницу предпросмотра вместо редиректа
+const previewSuffix = "+"
+
+// Cookie с закреплённым за посетителем вариантом A/B-теста
+const (
+	variantCookiePrefix = "ab_"
+	variantCookieTTL    = 30 * 24 * time.Hour
+)
+
+// Заголовки со страной посетителя в порядке приоритета
+var countryHeaders = []string{"CF-IPCountry", "X-Country-Code"}
+
 type Handler struct {
 	service service.Service
+	pages   *Pages
+}
+
+// Option настраивает Handler при создании
+type Option func(*Handler)
+
+func NewHandler(service service.Service, opts ...Option) *Handler {
+	h := &Handler{service: service, pages: NewPages("")}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
 }
 
-func NewHandler(service service.Service) *Handler {
-	return &Handler{service: service}
+// WithTemplatesDir включает переопределение страниц шаблонами из dir
+func WithTemplatesDir(dir string) Option {
+	return func(h *Handler) {
+		h.pages = NewPages(dir)
+	}
+}
+
+// RegisterRoutes регистрирует маршруты API и редиректа
+func (h *Handler) RegisterRoutes(r *mux.Router) {
+	api := r.PathPrefix("/api/v1").Subrouter()
+	api.HandleFunc("/shorten", h.CreateShortURL).Methods("POST")
+	api.HandleFunc("/shorten/batch", h.CreateShortURLs).Methods("POST")
+	api.HandleFunc("/url/{short}", h.GetURLInfo).Methods("GET")
+	api.HandleFunc("/url/{short}/stats", h.Stats).Methods("GET")
+	api.HandleFunc("/url/{short}/qr", h.QRCode).Methods("GET")
+	api.HandleFunc("/url/{short}/health", h.HealthHistory).Methods("GET")
+	api.HandleFunc("/url/{short}/events", h.ClickEvents).Methods("GET")
+	api.HandleFunc("/events", h.WorkspaceClickEvents).Methods("GET")
+	api.HandleFunc("/links/broken", h.BrokenLinks).Methods("GET")
+	api.HandleFunc("/usage", h.Usage).Methods("GET")
+	api.HandleFunc("/workspace/utm", h.GetUTMDefaults).Methods("GET")
+	api.HandleFunc("/workspace/utm", h.SetUTMDefaults).Methods("PUT")
+	api.HandleFunc("/domains", h.AddDomain).Methods("POST")
+	api.HandleFunc("/domains", h.ListDomains).Methods("GET")
+	api.HandleFunc("/webhooks", h.AddWebhook).Methods("POST")
+	api.HandleFunc("/webhooks", h.ListWebhooks).Methods("GET")
+	api.HandleFunc("/webhooks/{id}", h.DeleteWebhook).Methods("DELETE")
+	api.HandleFunc("/webhooks/{id}/deliveries", h.WebhookDeliveries).Methods("GET")
+
+	// Редирект отвечает на любой метод: API-клиенты отправляют на короткие ссылки POST и PUT
+	// и получают 307/308, сохраняющие метод и тело
+	r.HandleFunc("/{short}", h.Redirect)
+	r.HandleFunc("/{short}/{rest:.*}", h.Redirect)
 }
 
 // CreateShortURL создает короткую ссылку
 
 func (h *Handler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
 	var req models.CreateURLRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -27,9 +97,9 @@ func (h *Handler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := h.service.CreateShortURL(req.URL)
+	resp, err := h.service.CreateShortURL(r.Context(), owner, &req)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeCreateError(w, err)
 		return
 	}
 
@@ -38,19 +108,171 @@ func (h *Handler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// CreateShortURLs создает короткие ссылки для пачки URL
+
+func (h *Handler) CreateShortURLs(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	var req models.BatchCreateURLRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.URLs) == 0 {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	results, err := h.service.CreateShortURLs(r.Context(), owner, &req)
+	if err != nil {
+		writeCreateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(models.BatchCreateURLResponse{Results: results})
+}
+
 //Redirect перенапраавляет на оригинальный URL
 
 func (h *Handler) Redirect(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	short := vars["short"]
+	if short, ok := strings.CutSuffix(vars["short"], previewSuffix); ok && vars["rest"] == "" && r.Method != http.MethodPost {
+		h.preview(w, r, short, "", "")
+		return
+	}
+
+	target, err := h.service.Redirect(r.Context(), &models.RedirectRequest{
+		Short:          vars["short"],
+		Host:           r.Host,
+		Rest:           vars["rest"],
+		RawQuery:       r.URL.RawQuery,
+		UserAgent:      r.UserAgent(),
+		AcceptLanguage: r.Header.Get("Accept-Language"),
+		Country:        countryFromRequest(r),
+		Time:           time.Now(),
+		Variant:        variantFromCookie(r, vars["short"]),
+		Confirmed:      r.Method == http.MethodPost,
+	})
+	if err != nil {
+		h.redirectError(w, r, vars["short"], err)
+		return
+	}
+
+	if target.Unfurl != nil {
+		target.Unfurl.URL = requestOrigin(r) + r.URL.RequestURI()
+		h.pages.Render(w, r, PageUnfurl, &PageData{
+			Status:      http.StatusOK,
+			Short:       vars["short"],
+			Destination: target.Location,
+			Unfurl:      target.Unfurl,
+		})
+		return
+	}
+
+	if target.Interstitial {
+		h.preview(w, r, vars["short"], target.Location, r.URL.RequestURI())
+		return
+	}
+
+	if target.Sticky {
+		http.SetCookie(w, &http.Cookie{
+			Name:     variantCookiePrefix + vars["short"],
+			Value:    target.Variant,
+			Path:     "/" + vars["short"],
+			MaxAge:   int(variantCookieTTL.Seconds()),
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	WriteRedirect(w, r, target.Location, target.Status)
+}
+
+// redirectError показывает страницу, соответствующую причине, по которой перехода не будет
+func (h *Handler) redirectError(w http.ResponseWriter, r *http.Request, short string, err error) {
+	var disabledErr *service.DisabledError
+	if errors.As(err, &disabledErr) {
+		page := PageDisabled
+		if disabledErr.Blocked {
+			page = PageBlocked
+		}
+		h.pages.Render(w, r, page, &PageData{
+			Status:      http.StatusForbidden,
+			Message:     "URL is disabled",
+			Short:       short,
+			Destination: disabledErr.Original,
+			Reason:      disabledErr.Reason,
+		})
+		return
+	}
+
+	var inactiveErr *service.InactiveError
+	if errors.As(err, &inactiveErr) && inactiveErr.Status == models.StatusExpired {
+		h.pages.Render(w, r, PageExpired, &PageData{
+			Status:  http.StatusGone,
+			Message: "URL has expired",
+			Short:   short,
+			At:      &inactiveErr.At,
+		})
+		return
+	}
+
+	h.pages.Render(w, r, PageNotFound, &PageData{Status: http.StatusNotFound, Message: "URL not found", Short: short})
+}
+
+// preview показывает страницу предпросмотра; destination, если задан, заменяет адрес ссылки
+// (например, выбранный вариант A/B-теста), а continueURL — адрес, на который форма
+// отправляет подтверждение перехода
+func (h *Handler) preview(w http.ResponseWriter, r *http.Request, short, destination, continueURL string) {
+	preview, err := h.service.Preview(r.Context(), r.Host, short)
+	if err != nil {
+		h.pages.Render(w, r, PageNotFound, &PageData{Status: http.StatusNotFound, Message: "URL not found", Short: short})
+		return
+	}
+	if destination != "" {
+		preview.Destination = destination
+	}
+
+	h.pages.Render(w, r, PagePreview, &PageData{Status: http.StatusOK, Short: short, Preview: preview, Continue: continueURL})
+}
 
-	original, err := h.service.Redirect(short)
+// Stats возвращает переходы по ссылке с разбивкой по вариантам A/B-теста
+
+func (h *Handler) Stats(w http.ResponseWriter, r *http.Request) {
+	short := mux.Vars(r)["short"]
+
+	stats, err := h.service.Stats(r.Context(), r.URL.Query().Get(domainParam), short)
 	if err != nil {
 		http.Error(w, "URL not found", http.StatusNotFound)
 		return
 	}
 
-	http.Redirect(w, r, original, http.StatusFound)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func variantFromCookie(r *http.Request, short string) string {
+	cookie, err := r.Cookie(variantCookiePrefix + short)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// permanentMaxAge — сколько клиенты и прокси могут кешировать постоянный редирект
+const permanentMaxAge = 24 * time.Hour
+
+// WriteRedirect отправляет редирект с Cache-Control, подходящим для его статуса:
+// постоянные редиректы можно кешировать, временные — нет, чтобы каждый переход доходил до сервиса
+func WriteRedirect(w http.ResponseWriter, r *http.Request, location string, status int) {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(permanentMaxAge.Seconds())))
+	default:
+		w.Header().Set("Cache-Control", "private, no-cache, no-store, must-revalidate")
+	}
+	http.Redirect(w, r, location, status)
 }
 
 // GetURLInfo возвращает информацию о короткой ссылке
@@ -59,17 +281,289 @@ func (h *Handler) GetURLInfo(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	short := vars["short"]
 
-	original, err := h.service.GetOriginalURL(short)
+	info, err := h.service.GetURLInfo(r.Context(), r.URL.Query().Get(domainParam), short)
 	if err != nil {
 		http.Error(w, "URL not found", http.StatusNotFound)
 		return
 	}
 
-	resp := map[string]string{
-		"original_url": original,
-		"short_url":    short,
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(info)
+}
+
+// GetUTMDefaults возвращает UTM-метки владельца по умолчанию
+
+func (h *Handler) GetUTMDefaults(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.requireOwner(w, r)
+	if !ok {
+		return
+	}
+	utm, err := h.service.GetUTMDefaults(r.Context(), owner)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(utm)
+}
+
+// SetUTMDefaults сохраняет UTM-метки владельца по умолчанию
+
+func (h *Handler) SetUTMDefaults(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.requireOwner(w, r)
+	if !ok {
+		return
+	}
+	var utm models.UTM
+	if err := json.NewDecoder(r.Body).Decode(&utm); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.service.SetUTMDefaults(r.Context(), owner, &utm); err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(utm)
+}
+
+// BrokenLinks возвращает ссылки владельца, адрес назначения которых не отвечает
+
+func (h *Handler) BrokenLinks(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.requireOwner(w, r)
+	if !ok {
+		return
+	}
+	links, err := h.service.BrokenLinks(r.Context(), owner)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(links)
+}
+
+// HealthHistory возвращает историю проверок доступности ссылки
+
+func (h *Handler) HealthHistory(w http.ResponseWriter, r *http.Request) {
+	short := mux.Vars(r)["short"]
+
+	checks, err := h.service.HealthHistory(r.Context(), r.URL.Query().Get(domainParam), short)
+	if err != nil {
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(checks)
+}
+
+// AddDomain подключает брендированный домен владельца
+func (h *Handler) AddDomain(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.requireOwner(w, r)
+	if !ok {
+		return
+	}
+	var req models.CreateDomainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Host == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	domain, err := h.service.AddDomain(r.Context(), owner, req.Host)
+	if err != nil {
+		writeCreateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(domain)
+}
+
+// ListDomains возвращает домены владельца
+func (h *Handler) ListDomains(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.requireOwner(w, r)
+	if !ok {
+		return
+	}
+	domains, err := h.service.ListDomains(r.Context(), owner)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(domains)
+}
+
+// AddWebhook подписывает адрес на события ссылок владельца
+func (h *Handler) AddWebhook(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.requireOwner(w, r)
+	if !ok {
+		return
+	}
+	var req models.CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	hook, err := h.service.AddWebhook(r.Context(), owner, &req)
+	if err != nil {
+		writeCreateError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hook)
+}
+
+// ListWebhooks возвращает подписки владельца
+func (h *Handler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.requireOwner(w, r)
+	if !ok {
+		return
+	}
+	hooks, err := h.service.ListWebhooks(r.Context(), owner)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hooks)
+}
+
+// DeleteWebhook удаляет подписку владельца
+func (h *Handler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.requireOwner(w, r)
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteWebhook(r.Context(), owner, mux.Vars(r)["id"]); err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// WebhookDeliveries возвращает журнал доставки подписки
+func (h *Handler) WebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.requireOwner(w, r)
+	if !ok {
+		return
+	}
+	deliveries, err := h.service.WebhookDeliveries(r.Context(), owner, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// Usage показывает расход квот владельца
+
+func (h *Handler) Usage(w http.ResponseWriter, r *http.Request) {
+	owner, ok := h.requireOwner(w, r)
+	if !ok {
+		return
+	}
+	resp, err := h.service.Usage(r.Context(), owner)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(resp)
 }
+
+// countryFromRequest берёт страну посетителя из заголовков CDN или прокси с GeoIP
+func countryFromRequest(r *http.Request) string {
+	for _, header := range countryHeaders {
+		if country := r.Header.Get(header); country != "" {
+			return strings.ToUpper(country)
+		}
+	}
+	return ""
+}
+
+// authenticate определяет владельца по ключу API из X-API-Key. Без ключа запрос
+// анонимный (owner ""), на неизвестный ключ уже отправлен 401.
+func (h *Handler) authenticate(w http.ResponseWriter, r *http.Request) (string, bool) {
+	key := r.Header.Get(apiKeyHeader)
+	if key == "" {
+		return "", true
+	}
+	owner, err := h.service.Authenticate(r.Context(), key)
+	if errors.Is(err, service.ErrUnauthorized) {
+		http.Error(w, "Invalid API key", http.StatusUnauthorized)
+		return "", false
+	}
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return "", false
+	}
+	return owner, true
+}
+
+// requireOwner — как authenticate, но и запрос без ключа получает 401
+func (h *Handler) requireOwner(w http.ResponseWriter, r *http.Request) (string, bool) {
+	owner, ok := h.authenticate(w, r)
+	if ok && owner == "" {
+		http.Error(w, "API key is required", http.StatusUnauthorized)
+		return "", false
+	}
+	return owner, ok
+}
+
+// writeCreateError отдает 429/403 с JSON-телом для превышения квот, 400 с кодом для
+// отклонённых политикой URL, 401 для анонимного запроса при квотах и 400 текстом для
+// остальных ошибок
+func writeCreateError(w http.ResponseWriter, err error) {
+	var validationErr *policy.ValidationError
+	if errors.As(err, &validationErr) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": err.Error(),
+			"code":  validationErr.Code,
+		})
+		return
+	}
+
+	if errors.Is(err, service.ErrUnauthorized) {
+		http.Error(w, "API key is required", http.StatusUnauthorized)
+		return
+	}
+
+	var quotaErr *service.QuotaError
+	if !errors.As(err, &quotaErr) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusForbidden
+	if quotaErr.Kind == service.QuotaMonthly {
+		status = http.StatusTooManyRequests
+		retry := int(time.Until(quotaErr.ResetAt).Seconds())
+		w.Header().Set("Retry-After", strconv.Itoa(retry))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": quotaErr.Error(),
+		"quota": quotaErr.Kind,
+		"limit": quotaErr.Limit,
+		"used":  quotaErr.Used,
+	})
+}
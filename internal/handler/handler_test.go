@@ -1,30 +1,136 @@
 package handler
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 	"urlcutter/internal/models"
+	"urlcutter/internal/pubsub"
+	"urlcutter/internal/service"
+	"urlcutter/pkg/qr"
+
+	"github.com/gorilla/mux"
 )
 
 type mockService struct {
-	createResp       *models.CreateURLResponse
-	createErr        error
-	original         string
-	getErr           error
-	redirectOriginal string
-	redirectErr      error
+	createResp     *models.CreateURLResponse
+	createErr      error
+	original       string
+	getErr         error
+	redirectTarget *models.RedirectTarget
+	redirectErr    error
+	redirectReq    *models.RedirectRequest
+	redirectCtx    context.Context
+	qrOrigin       string
+	clicks         *pubsub.Broker
 }
 
-func (m *mockService) CreateShortURL(original string) (*models.CreateURLResponse, error) {
+func (m *mockService) CreateShortURL(ctx context.Context, owner string, req *models.CreateURLRequest) (*models.CreateURLResponse, error) {
 	return m.createResp, m.createErr
 }
-func (m *mockService) GetOriginalURL(short string) (string, error) { return m.original, m.getErr }
-func (m *mockService) Redirect(short string) (string, error) {
-	return m.redirectOriginal, m.redirectErr
+func (m *mockService) CreateShortURLs(ctx context.Context, owner string, req *models.BatchCreateURLRequest) ([]models.CreateURLResponse, error) {
+	if m.createErr != nil {
+		return nil, m.createErr
+	}
+	return []models.CreateURLResponse{*m.createResp}, nil
+}
+func (m *mockService) GetOriginalURL(ctx context.Context, domain, short string) (string, error) {
+	return m.original, m.getErr
+}
+func (m *mockService) GetURLInfo(ctx context.Context, domain, short string) (*models.URLInfo, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	return &models.URLInfo{URL: models.URL{Short: short, Domain: domain, Original: m.original, Owner: "acme"}, FinalURL: m.original}, nil
+}
+func (m *mockService) Redirect(ctx context.Context, req *models.RedirectRequest) (*models.RedirectTarget, error) {
+	m.redirectReq, m.redirectCtx = req, ctx
+	return m.redirectTarget, m.redirectErr
+}
+func (m *mockService) Usage(ctx context.Context, owner string) (*models.UsageResponse, error) {
+	return &models.UsageResponse{Owner: owner}, nil
+}
+func (m *mockService) Preview(ctx context.Context, domain, short string) (*models.Preview, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	return &models.Preview{Short: short, Destination: m.original, Safety: models.SafetyOK, CreatedAt: time.Now()}, nil
+}
+func (m *mockService) Stats(ctx context.Context, domain, short string) (*models.StatsResponse, error) {
+	return &models.StatsResponse{Short: short, Domain: domain}, nil
+}
+func (m *mockService) AddDomain(ctx context.Context, owner, host string) (*models.Domain, error) {
+	return &models.Domain{Host: host, Owner: owner}, m.createErr
+}
+func (m *mockService) ListDomains(ctx context.Context, owner string) ([]*models.Domain, error) {
+	return []*models.Domain{}, nil
+}
+func (m *mockService) BrokenLinks(ctx context.Context, owner string) ([]*models.URL, error) {
+	return []*models.URL{{Short: "abc123", Owner: owner, Health: &models.HealthCheck{StatusCode: 404, Broken: true}}}, nil
+}
+func (m *mockService) HealthHistory(ctx context.Context, domain, short string) ([]models.HealthCheck, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	return []models.HealthCheck{{Short: short, Domain: domain, StatusCode: 200}}, nil
+}
+func (m *mockService) QRCode(ctx context.Context, domain, short, origin, format string, opts qr.Options) ([]byte, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	m.qrOrigin = origin
+	return qr.Encode(origin+"/"+short, format, opts)
+}
+func (m *mockService) AddWebhook(ctx context.Context, owner string, req *models.CreateWebhookRequest) (*models.Webhook, error) {
+	if m.createErr != nil {
+		return nil, m.createErr
+	}
+	return &models.Webhook{ID: "wh1", Owner: owner, URL: req.URL, Secret: "secret", Events: req.Events}, nil
+}
+func (m *mockService) ListWebhooks(ctx context.Context, owner string) ([]*models.Webhook, error) {
+	return []*models.Webhook{}, nil
+}
+func (m *mockService) DeleteWebhook(ctx context.Context, owner, id string) error {
+	return m.getErr
+}
+func (m *mockService) WebhookDeliveries(ctx context.Context, owner, id string) ([]models.WebhookDelivery, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	return []models.WebhookDelivery{{WebhookID: id, EventType: models.EventLinkCreated, Attempt: 1, Success: true}}, nil
+}
+func (m *mockService) SubscribeClicks(ctx context.Context, owner, domain, short string) (*pubsub.Subscription, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	if owner != "acme" {
+		return nil, errors.New("URL not found")
+	}
+	return m.clicks.Subscribe(domain + "/" + short), nil
+}
+
+// Authenticate принимает ключи вида key-<owner>
+func (m *mockService) Authenticate(ctx context.Context, key string) (string, error) {
+	if owner, ok := strings.CutPrefix(key, "key-"); ok {
+		return owner, nil
+	}
+	return "", service.ErrUnauthorized
+}
+func (m *mockService) SubscribeOwnerClicks(ctx context.Context, owner string) (*pubsub.Subscription, error) {
+	return m.clicks.Subscribe(owner), nil
+}
+func (m *mockService) GetUTMDefaults(ctx context.Context, owner string) (*models.UTM, error) {
+	return &models.UTM{}, nil
+}
+func (m *mockService) SetUTMDefaults(ctx context.Context, owner string, utm *models.UTM) error {
+	return nil
 }
 
 func TestCreateShortURL_OK(t *testing.T) {
@@ -52,6 +158,31 @@ func TestCreateShortURL_BadRequest(t *testing.T) {
 	}
 }
 
+func TestCreateShortURL_QuotaExceeded(t *testing.T) {
+	cases := []struct {
+		err  *service.QuotaError
+		code int
+	}{
+		{&service.QuotaError{Kind: service.QuotaTotal, Limit: 10, Used: 10}, http.StatusForbidden},
+		{&service.QuotaError{Kind: service.QuotaMonthly, Limit: 5, Used: 5, ResetAt: time.Now().Add(time.Hour)}, http.StatusTooManyRequests},
+	}
+	for _, c := range cases {
+		h := NewHandler(&mockService{createErr: c.err})
+		body, _ := json.Marshal(models.CreateURLRequest{URL: "https://example.com"})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		h.CreateShortURL(rr, req)
+
+		if rr.Code != c.code {
+			t.Fatalf("%s: expected %d, got %d", c.err.Kind, c.code, rr.Code)
+		}
+		var resp map[string]interface{}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil || resp["quota"] != c.err.Kind {
+			t.Fatalf("%s: unexpected body %v (%v)", c.err.Kind, resp, err)
+		}
+	}
+}
+
 func TestGetURLInfo_OK(t *testing.T) {
 	svc := &mockService{original: "https://example.com"}
 	h := NewHandler(svc)
@@ -64,6 +195,9 @@ func TestGetURLInfo_OK(t *testing.T) {
 	if rr.Code != http.StatusOK {
 		t.Fatalf("expected 200, got %d", rr.Code)
 	}
+	if strings.Contains(rr.Body.String(), "acme") {
+		t.Fatalf("public link info must not reveal the owner: %s", rr.Body.String())
+	}
 }
 
 func TestRedirect_NotFound(t *testing.T) {
@@ -78,9 +212,405 @@ func TestRedirect_NotFound(t *testing.T) {
 	}
 }
 
+func TestRedirect_StatusAndCacheControl(t *testing.T) {
+	cases := []struct {
+		status int
+		cache  string
+	}{
+		{http.StatusFound, "private, no-cache, no-store, must-revalidate"},
+		{http.StatusTemporaryRedirect, "private, no-cache, no-store, must-revalidate"},
+		{http.StatusMovedPermanently, "public, max-age=86400"},
+		{http.StatusPermanentRedirect, "public, max-age=86400"},
+	}
+	for _, c := range cases {
+		svc := &mockService{redirectTarget: &models.RedirectTarget{Location: "https://example.com", Status: c.status}}
+		h := NewHandler(svc)
+		req := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+		rr := httptest.NewRecorder()
+		h.Redirect(rr, req)
+
+		if rr.Code != c.status {
+			t.Fatalf("expected %d, got %d", c.status, rr.Code)
+		}
+		if got := rr.Header().Get("Cache-Control"); got != c.cache {
+			t.Fatalf("%d: unexpected Cache-Control %q", c.status, got)
+		}
+		if got := rr.Header().Get("Location"); got != "https://example.com" {
+			t.Fatalf("unexpected Location %q", got)
+		}
+	}
+}
+
+func TestRedirect_StickyVariantCookie(t *testing.T) {
+	svc := &mockService{redirectTarget: &models.RedirectTarget{
+		Location: "https://b.example.com", Status: http.StatusFound, Variant: "b", Sticky: true,
+	}}
+	r := mux.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+	req.AddCookie(&http.Cookie{Name: "ab_abc123", Value: "a"})
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if svc.redirectReq.Variant != "a" {
+		t.Fatalf("expected variant from cookie, got %q", svc.redirectReq.Variant)
+	}
+	cookies := rr.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "ab_abc123" || cookies[0].Value != "b" {
+		t.Fatalf("expected sticky variant cookie, got %v", cookies)
+	}
+}
+
+func TestRedirect_Preview(t *testing.T) {
+	svc := &mockService{
+		original:       "https://example.com/page",
+		redirectTarget: &models.RedirectTarget{Location: "https://example.com/b", Status: http.StatusFound, Interstitial: true},
+	}
+	r := mux.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+
+	for path, destination := range map[string]string{
+		"/abc123+": "https://example.com/page",
+		"/abc123":  "https://example.com/b",
+	} {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("%s: expected 200, got %d", path, rr.Code)
+		}
+		if !strings.Contains(rr.Body.String(), destination) || rr.Header().Get("Location") != "" {
+			t.Fatalf("%s: expected preview page for %s", path, destination)
+		}
+	}
+	if svc.redirectReq == nil || svc.redirectReq.Short != "abc123" {
+		t.Fatalf("expected redirect call only for plain code, got %+v", svc.redirectReq)
+	}
+}
+
+func TestRedirect_InterstitialContinue(t *testing.T) {
+	svc := &mockService{
+		original:       "https://example.com/page",
+		redirectTarget: &models.RedirectTarget{Location: "https://example.com/b", Status: http.StatusFound, Interstitial: true},
+	}
+	r := mux.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/abc123?ref=mail", nil))
+	if !strings.Contains(rr.Body.String(), `<form method="post" action="/abc123?ref=mail">`) {
+		t.Fatalf("expected continue form, got %s", rr.Body.String())
+	}
+	if svc.redirectReq.Confirmed {
+		t.Fatalf("viewing the preview must not confirm the click")
+	}
+
+	svc.redirectTarget = &models.RedirectTarget{Location: "https://example.com/b", Status: http.StatusSeeOther}
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/abc123?ref=mail", nil))
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "https://example.com/b" {
+		t.Fatalf("expected 303 to destination, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if !svc.redirectReq.Confirmed || svc.redirectReq.RawQuery != "ref=mail" {
+		t.Fatalf("expected confirmed redirect request, got %+v", svc.redirectReq)
+	}
+}
+
+func TestRedirect_AnyMethodKeepsStatus(t *testing.T) {
+	svc := &mockService{redirectTarget: &models.RedirectTarget{Location: "https://api.example.com/hook", Status: http.StatusTemporaryRedirect}}
+	r := mux.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+
+	for _, method := range []string{http.MethodPost, http.MethodPut, http.MethodDelete} {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(method, "/abc123", strings.NewReader(`{"event":"ping"}`)))
+		if rr.Code != http.StatusTemporaryRedirect || rr.Header().Get("Location") != "https://api.example.com/hook" {
+			t.Fatalf("%s: expected 307 to destination, got %d %q", method, rr.Code, rr.Header().Get("Location"))
+		}
+	}
+}
+
+func TestRedirect_PathPassthroughRoute(t *testing.T) {
+	svc := &mockService{redirectTarget: &models.RedirectTarget{Location: "https://example.com", Status: http.StatusFound}}
+	r := mux.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc123/docs/intro?lang=ru", nil)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusFound {
+		t.Fatalf("expected 302, got %d", rr.Code)
+	}
+	got := svc.redirectReq
+	if got == nil || got.Short != "abc123" || got.Rest != "docs/intro" || got.RawQuery != "lang=ru" {
+		t.Fatalf("unexpected redirect request: %+v", got)
+	}
+}
+
 // helper to inject mux vars without importing mux in test
 func muxSetVar(r *http.Request, k, v string) *http.Request {
 	ctx := r.Context()
 	type muxKey struct{}
 	return r.WithContext(context.WithValue(ctx, muxKey{}, map[string]string{k: v}))
 }
+
+func TestRedirect_PassesHost(t *testing.T) {
+	svc := &mockService{redirectTarget: &models.RedirectTarget{Location: "https://example.com", Status: http.StatusFound}}
+	r := mux.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+	req.Host = "go.brand.example"
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if svc.redirectReq == nil || svc.redirectReq.Host != "go.brand.example" {
+		t.Fatalf("expected request host in redirect request, got %+v", svc.redirectReq)
+	}
+}
+
+func TestRedirect_PassesContext(t *testing.T) {
+	svc := &mockService{redirectTarget: &models.RedirectTarget{Location: "https://example.com", Status: http.StatusFound}}
+	r := mux.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/abc123", nil).WithContext(ctx)
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	if svc.redirectCtx == nil || svc.redirectCtx.Err() != context.Canceled {
+		t.Fatalf("expected request context in service call")
+	}
+}
+
+func TestGetURLInfo_Domain(t *testing.T) {
+	svc := &mockService{original: "https://example.com"}
+	r := mux.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/url/abc123?domain=go.brand.example", nil))
+
+	var info models.URLInfo
+	if err := json.NewDecoder(rr.Body).Decode(&info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Domain != "go.brand.example" {
+		t.Fatalf("expected domain from query, got %+v", info)
+	}
+}
+
+func TestQRCode_Formats(t *testing.T) {
+	svc := &mockService{}
+	r := mux.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+
+	for query, contentType := range map[string]string{
+		"":                                "image/png",
+		"?format=svg&fg=%23112233&bg=fff": "image/svg+xml",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/url/abc123/qr"+query, nil)
+		req.Host = "sho.rt"
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != contentType {
+			t.Fatalf("%q: unexpected response %d %s", query, rr.Code, rr.Header().Get("Content-Type"))
+		}
+		if svc.qrOrigin != "http://sho.rt" {
+			t.Fatalf("expected request origin, got %q", svc.qrOrigin)
+		}
+
+		// Повторный запрос с ETag не передаёт изображение заново
+		again := httptest.NewRequest(http.MethodGet, "/api/v1/url/abc123/qr"+query, nil)
+		again.Host = "sho.rt"
+		again.Header.Set("If-None-Match", rr.Header().Get("ETag"))
+		rr = httptest.NewRecorder()
+		r.ServeHTTP(rr, again)
+		if rr.Code != http.StatusNotModified {
+			t.Fatalf("%q: expected 304, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestQRCode_InvalidParams(t *testing.T) {
+	r := mux.NewRouter()
+	NewHandler(&mockService{}).RegisterRoutes(r)
+
+	for _, query := range []string{"?size=big", "?margin=1.5", "?fg=blue", "?bg=%2312"} {
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/api/v1/url/abc123/qr"+query, nil))
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: expected 400, got %d", query, rr.Code)
+		}
+	}
+}
+
+func TestRedirect_Unfurl(t *testing.T) {
+	svc := &mockService{redirectTarget: &models.RedirectTarget{
+		Location: "https://example.com/post",
+		Status:   http.StatusFound,
+		Unfurl:   &models.Unfurl{Title: "Post", Image: "https://example.com/og.png", Destination: "https://example.com/post"},
+	}}
+	r := mux.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodGet, "http://sho.rt/abc123", nil)
+	req.Header.Set("User-Agent", "Twitterbot/1.0")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Location") != "" {
+		t.Fatalf("expected unfurl page, got %d", rr.Code)
+	}
+	body := rr.Body.String()
+	for _, want := range []string{
+		`<meta property="og:title" content="Post">`,
+		`<meta property="og:image" content="https://example.com/og.png">`,
+		`<meta property="og:url" content="http://sho.rt/abc123">`,
+		`content="summary_large_image"`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("expected %s in page:\n%s", want, body)
+		}
+	}
+	if svc.redirectReq.UserAgent != "Twitterbot/1.0" {
+		t.Fatalf("expected user agent passed to service, got %q", svc.redirectReq.UserAgent)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	svc := &mockService{}
+	r := mux.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/webhooks", strings.NewReader(`{"url":"https://hooks.example.com","events":["link.created"]}`))
+	req.Header.Set(apiKeyHeader, "key-acme")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	var hook models.Webhook
+	if rr.Code != http.StatusCreated || json.NewDecoder(rr.Body).Decode(&hook) != nil || hook.Secret == "" || hook.Owner != "acme" {
+		t.Fatalf("expected created webhook with secret, got %d %+v", rr.Code, hook)
+	}
+
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/webhooks/wh1", nil)
+	req.Header.Set(apiKeyHeader, "key-acme")
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", rr.Code)
+	}
+
+	svc.getErr = errors.New("webhook not found")
+	for _, tc := range []struct{ method, path string }{
+		{http.MethodDelete, "/api/v1/webhooks/missing"},
+		{http.MethodGet, "/api/v1/webhooks/missing/deliveries"},
+	} {
+		rr = httptest.NewRecorder()
+		req = httptest.NewRequest(tc.method, tc.path, nil)
+		req.Header.Set(apiKeyHeader, "key-acme")
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusNotFound {
+			t.Fatalf("%s %s: expected 404, got %d", tc.method, tc.path, rr.Code)
+		}
+	}
+}
+
+func TestOwnerRequiresAPIKey(t *testing.T) {
+	svc := &mockService{}
+	r := mux.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+
+	for _, tc := range []struct {
+		header, value string
+		want          int
+	}{
+		{"", "", http.StatusUnauthorized},
+		{"X-Workspace-ID", "acme", http.StatusUnauthorized},
+		{apiKeyHeader, "forged", http.StatusUnauthorized},
+		{apiKeyHeader, "key-acme", http.StatusOK},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/usage", nil)
+		if tc.header != "" {
+			req.Header.Set(tc.header, tc.value)
+		}
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != tc.want {
+			t.Fatalf("%s=%q: expected %d, got %d", tc.header, tc.value, tc.want, rr.Code)
+		}
+	}
+
+	// Создание без ключа остаётся анонимным, с чужим ключом — нет
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/shorten", strings.NewReader(`{"url":"https://example.com"}`))
+	req.Header.Set(apiKeyHeader, "forged")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for unknown key, got %d", rr.Code)
+	}
+}
+
+func TestClickEvents(t *testing.T) {
+	svc := &mockService{clicks: pubsub.NewBroker(8)}
+	r := mux.NewRouter()
+	NewHandler(svc).RegisterRoutes(r)
+	srv := httptest.NewServer(r)
+	defer srv.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/url/abc123/events", nil)
+	req.Header.Set(apiKeyHeader, "key-acme")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("unexpected content type %q", resp.Header.Get("Content-Type"))
+	}
+
+	lines := bufio.NewReader(resp.Body)
+	if line, _ := lines.ReadString('\n'); line != ": connected\n" {
+		t.Fatalf("unexpected first line %q", line)
+	}
+	lines.ReadString('\n')
+
+	svc.clicks.Publish("/abc123", models.ClickEvent{Short: "abc123", Country: "DE"})
+	event, _ := lines.ReadString('\n')
+	data, _ := lines.ReadString('\n')
+	if event != "event: click\n" || !strings.Contains(data, `"country":"DE"`) {
+		t.Fatalf("unexpected event %q %q", event, data)
+	}
+
+	// Заголовок с идентификатором владельца без ключа не даёт доступа
+	for _, path := range []string{"/api/v1/url/abc123/events", "/api/v1/events"} {
+		for _, header := range []string{"X-Workspace-ID", apiKeyHeader} {
+			rr := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			req.Header.Set(header, "acme")
+			r.ServeHTTP(rr, req)
+			if rr.Code != http.StatusUnauthorized {
+				t.Fatalf("%s with %s: expected 401, got %d", path, header, rr.Code)
+			}
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/url/abc123/events", nil)
+	req.Header.Set(apiKeyHeader, "key-other")
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("another workspace: expected 404, got %d", rr.Code)
+	}
+
+	svc.getErr = errors.New("URL not found")
+	rr = httptest.NewRecorder()
+	req = httptest.NewRequest(http.MethodGet, "/api/v1/url/missing/events", nil)
+	req.Header.Set(apiKeyHeader, "key-acme")
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("expected 404, got %d", rr.Code)
+	}
+}
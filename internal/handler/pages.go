@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"embed"
+	"encoding/json"
+	"html/template"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"urlcutter/internal/models"
+)
+
+// Страницы, которые можно переопределить в каталоге шаблонов
+const (
+	PageNotFound = "not_found"
+	PageExpired  = "expired"
+	PageDisabled = "disabled"
+	PageBlocked  = "blocked"
+	PagePreview  = "preview"
+	PageUnfurl   = "unfurl"
+)
+
+//go:embed templates/*.html
+var builtinTemplates embed.FS
+
+var pageFuncs = template.FuncMap{
+	"safetyOK":      func(s string) bool { return s == models.SafetyOK },
+	"safetyBlocked": func(s string) bool { return s == models.SafetyBlocked },
+}
+
+// PageData — данные, доступные шаблонам страниц
+type PageData struct {
+	Status      int             `json:"status"`
+	Message     string          `json:"error,omitempty"`
+	Short       string          `json:"short_url,omitempty"`
+	Host        string          `json:"-"`
+	Destination string          `json:"destination,omitempty"`
+	Reason      string          `json:"reason,omitempty"`
+	At          *time.Time      `json:"at,omitempty"`
+	Preview     *models.Preview `json:"preview,omitempty"`
+	// Continue — адрес подтверждения перехода со страницы предпросмотра (POST)
+	Continue string         `json:"continue,omitempty"`
+	Unfurl   *models.Unfurl `json:"-"`
+}
+
+// Pages рендерит страницы ошибок и предпросмотра. Шаблон ищется в порядке
+// <dir>/<host>/<page>.html, <dir>/<page>.html, встроенный templates/<page>.html.
+type Pages struct {
+	dir string
+
+	mu    sync.Mutex
+	cache map[string]*template.Template
+}
+
+// NewPages создаёт рендерер; пустой dir — только встроенные шаблоны
+func NewPages(dir string) *Pages {
+	return &Pages{dir: dir, cache: make(map[string]*template.Template)}
+}
+
+// Render отдаёт страницу в HTML или JSON, если клиент предпочитает JSON
+func (p *Pages) Render(w http.ResponseWriter, r *http.Request, page string, data *PageData) {
+	w.Header().Set("Cache-Control", "no-store")
+
+	if prefersJSON(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(data.Status)
+		if data.Preview != nil {
+			json.NewEncoder(w).Encode(data.Preview)
+			return
+		}
+		json.NewEncoder(w).Encode(data)
+		return
+	}
+
+	data.Host = hostname(r.Host)
+	tmpl, err := p.lookup(data.Host, page)
+	if err != nil {
+		log.Printf("Failed to load template %s: %v", page, err)
+		http.Error(w, data.Message, data.Status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(data.Status)
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Printf("Failed to render page %s: %v", page, err)
+	}
+}
+
+func (p *Pages) lookup(host, page string) (*template.Template, error) {
+	var candidates []string
+	if p.dir != "" {
+		if host != "" && !strings.ContainsAny(host, `/\`) && host != ".." {
+			candidates = append(candidates, filepath.Join(p.dir, host, page+".html"))
+		}
+		candidates = append(candidates, filepath.Join(p.dir, page+".html"))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, path := range candidates {
+		if tmpl, ok := p.cache[path]; ok {
+			return tmpl, nil
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		tmpl, err := template.New(filepath.Base(path)).Funcs(pageFuncs).ParseFiles(path)
+		if err != nil {
+			return nil, err
+		}
+		p.cache[path] = tmpl
+		return tmpl, nil
+	}
+
+	builtin := "templates/" + page + ".html"
+	if tmpl, ok := p.cache[builtin]; ok {
+		return tmpl, nil
+	}
+	tmpl, err := template.New(page+".html").Funcs(pageFuncs).ParseFS(builtinTemplates, builtin)
+	if err != nil {
+		return nil, err
+	}
+	p.cache[builtin] = tmpl
+	return tmpl, nil
+}
+
+// prefersJSON сравнивает вес application/json и text/html в заголовке Accept
+func prefersJSON(r *http.Request) bool {
+	jsonQ, htmlQ := -1.0, -1.0
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		switch mediaType {
+		case "application/json":
+			jsonQ = q
+		case "text/html":
+			htmlQ = q
+		}
+	}
+	return jsonQ > 0 && jsonQ > htmlQ
+}
+
+func hostname(host string) string {
+	if h, _, ok := strings.Cut(host, ":"); ok && !strings.Contains(host, "]") {
+		host = h
+	}
+	return strings.ToLower(host)
+}
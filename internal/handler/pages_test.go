@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	"urlcutter/internal/service"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRedirect_ErrorPages(t *testing.T) {
+	cases := []struct {
+		err    error
+		status int
+		text   string
+	}{
+		{http.ErrMissingFile, http.StatusNotFound, "Ссылка не найдена"},
+		{&service.InactiveError{Short: "abc123", Status: "expired", At: time.Now()}, http.StatusGone, "Срок действия ссылки истёк"},
+		{&service.DisabledError{Short: "abc123", Reason: "manual"}, http.StatusForbidden, "Ссылка отключена"},
+		{&service.DisabledError{Short: "abc123", Original: "https://evil.example", Blocked: true}, http.StatusForbidden, "https://evil.example"},
+	}
+	for _, c := range cases {
+		r := mux.NewRouter()
+		NewHandler(&mockService{redirectErr: c.err}).RegisterRoutes(r)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/abc123", nil))
+
+		if rr.Code != c.status {
+			t.Fatalf("%v: expected %d, got %d", c.err, c.status, rr.Code)
+		}
+		if !strings.Contains(rr.Header().Get("Content-Type"), "text/html") || !strings.Contains(rr.Body.String(), c.text) {
+			t.Fatalf("%v: expected HTML page with %q, got %s", c.err, c.text, rr.Body.String())
+		}
+	}
+}
+
+func TestRedirect_ErrorPageJSON(t *testing.T) {
+	r := mux.NewRouter()
+	NewHandler(&mockService{redirectErr: http.ErrMissingFile}).RegisterRoutes(r)
+	req := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+	req.Header.Set("Accept", "application/json, text/html;q=0.5")
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+
+	var body map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+		t.Fatalf("expected JSON body: %v", err)
+	}
+	if rr.Code != http.StatusNotFound || body["error"] != "URL not found" {
+		t.Fatalf("unexpected response %d %v", rr.Code, body)
+	}
+}
+
+func TestRedirect_TemplateOverrides(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "go.example"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "not_found.html"), []byte("default {{.Short}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "go.example", "not_found.html"), []byte("branded {{.Short}}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mux.NewRouter()
+	NewHandler(&mockService{redirectErr: http.ErrMissingFile}, WithTemplatesDir(dir)).RegisterRoutes(r)
+	for host, want := range map[string]string{
+		"go.example:8080": "branded abc123",
+		"other.example":   "default abc123",
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/abc123", nil)
+		req.Host = host
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+
+		if rr.Body.String() != want {
+			t.Fatalf("%s: expected %q, got %q", host, want, rr.Body.String())
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"urlcutter/internal/policy"
+	"urlcutter/internal/service"
+	"urlcutter/pkg/qr"
+
+	"github.com/gorilla/mux"
+)
+
+// qrMaxAge — сколько клиенты могут кешировать изображение QR-кода
+const qrMaxAge = 24 * time.Hour
+
+var qrContentTypes = map[string]string{
+	qr.PNG: "image/png",
+	qr.SVG: "image/svg+xml",
+}
+
+// QRCode отдаёт QR-код абсолютного адреса ссылки в PNG или SVG.
+// Параметры: format, size, level (L/M/Q/H), margin, fg и bg (#rrggbb).
+func (h *Handler) QRCode(w http.ResponseWriter, r *http.Request) {
+	short := mux.Vars(r)["short"]
+	query := r.URL.Query()
+
+	format := strings.ToLower(query.Get("format"))
+	if format == "" {
+		format = qr.PNG
+	}
+	opts, err := qrOptions(query.Get)
+	if err != nil {
+		writeCreateError(w, &policy.ValidationError{Code: service.CodeInvalidQR, Message: err.Error()})
+		return
+	}
+
+	data, err := h.service.QRCode(r.Context(), query.Get(domainParam), short, requestOrigin(r), format, opts)
+	if err != nil {
+		var validationErr *policy.ValidationError
+		if errors.As(err, &validationErr) {
+			writeCreateError(w, err)
+			return
+		}
+		http.Error(w, "URL not found", http.StatusNotFound)
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	w.Header().Set("Content-Type", qrContentTypes[format])
+	w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(qrMaxAge.Seconds())))
+	w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:8])+`"`)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// qrOptions разбирает параметры изображения, пропущенные берутся по умолчанию
+func qrOptions(get func(string) string) (qr.Options, error) {
+	opts := qr.DefaultOptions()
+
+	for name, target := range map[string]*int{"size": &opts.Size, "margin": &opts.Margin} {
+		if v := get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return opts, errors.New(name + " must be an integer")
+			}
+			*target = n
+		}
+	}
+	if v := get("level"); v != "" {
+		opts.Level = strings.ToUpper(v)
+	}
+
+	var err error
+	if v := get("fg"); v != "" {
+		if opts.Foreground, err = qr.ParseColor(v); err != nil {
+			return opts, err
+		}
+	}
+	if v := get("bg"); v != "" {
+		if opts.Background, err = qr.ParseColor(v); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// requestOrigin восстанавливает адрес, по которому клиент обратился к сервису
+func requestOrigin(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
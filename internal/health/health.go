@@ -0,0 +1,238 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+)
+
+const (
+	defaultTimeout     = 10 * time.Second
+	defaultConcurrency = 8
+	defaultHostDelay   = time.Second
+	defaultUserAgent   = "URLcutterBot/1.0 (+link health check)"
+	// minHostsSweep — с какого размера таблица хостов очищается от записей, которые
+	// больше ничего не ограничивают
+	minHostsSweep = 1024
+)
+
+type Config struct {
+	// Timeout ограничивает одну проверку вместе с редиректами
+	Timeout time.Duration
+	// Concurrency — сколько проверок идёт одновременно
+	Concurrency int
+	// HostDelay — минимальный интервал между запросами к одному хосту; в CheckAll
+	// запросы к одному хосту никогда не идут параллельно
+	HostDelay time.Duration
+	UserAgent string
+	// AllowPrivate разрешает соединения с приватными адресами (только для тестов)
+	AllowPrivate bool
+}
+
+// Target — ссылка, адрес назначения которой нужно проверить
+type Target struct {
+	Domain string
+	Short  string
+	URL    string
+}
+
+// Checker проверяет доступность адресов назначения HEAD-запросами, а если сервер
+// их не поддерживает — GET
+type Checker struct {
+	cfg    Config
+	client *http.Client
+
+	// hosts — когда к хосту можно обратиться снова. Записи, срок которых прошёл,
+	// удаляются, когда таблица дорастает до sweepAt.
+	mu      sync.Mutex
+	hosts   map[string]time.Time
+	sweepAt int
+}
+
+func NewChecker(cfg Config) *Checker {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.Concurrency == 0 {
+		cfg.Concurrency = defaultConcurrency
+	}
+	if cfg.HostDelay == 0 {
+		cfg.HostDelay = defaultHostDelay
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = defaultUserAgent
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		dialer.Control = policy.DenyPrivateControl
+	}
+	return &Checker{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext, MaxIdleConnsPerHost: 1},
+		},
+		hosts:   make(map[string]time.Time),
+		sweepAt: minHostsSweep,
+	}
+}
+
+// CheckAll проверяет цели не более чем Concurrency запросами одновременно и передаёт
+// каждый результат в report. Цели одного хоста проверяет один обработчик подряд, так что
+// ожидание паузы перед медленным хостом не занимает остальных. report вызывается из
+// разных горутин.
+func (c *Checker) CheckAll(ctx context.Context, targets []Target, report func(Target, *models.HealthCheck)) {
+	jobs := make(chan []Target)
+	var wg sync.WaitGroup
+	for i := 0; i < c.cfg.Concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for group := range jobs {
+				for _, target := range group {
+					if ctx.Err() != nil {
+						break
+					}
+					report(target, c.Check(ctx, target))
+				}
+			}
+		}()
+	}
+	for _, group := range groupByHost(targets) {
+		select {
+		case jobs <- group:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// Check проверяет одну цель с соблюдением интервала между запросами к её хосту
+func (c *Checker) Check(ctx context.Context, target Target) *models.HealthCheck {
+	result := &models.HealthCheck{Short: target.Short, Domain: target.Domain, URL: target.URL}
+	parsed, err := url.Parse(target.URL)
+	if err != nil || parsed.Host == "" {
+		result.Error = "invalid URL"
+		result.Broken = true
+		result.CheckedAt = time.Now()
+		return result
+	}
+
+	host := strings.ToLower(parsed.Host)
+	if wait := time.Until(c.reserve(host)); wait > 0 {
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+		}
+	}
+	defer c.release(host)
+
+	start := time.Now()
+	status, err := c.request(ctx, http.MethodHead, target.URL)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		status, err = c.request(ctx, http.MethodGet, target.URL)
+	}
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.CheckedAt = time.Now()
+	result.StatusCode = status
+	if err != nil {
+		result.Error = describe(err)
+	}
+	result.Broken = err != nil || status >= 400
+	return result
+}
+
+func (c *Checker) request(ctx context.Context, method, target string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", c.cfg.UserAgent)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// reserve занимает ближайшее свободное время обращения к хосту и возвращает его;
+// следующий запрос к хосту получит время не раньше чем через HostDelay
+func (c *Checker) reserve(host string) time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := time.Now()
+	if len(c.hosts) >= c.sweepAt {
+		for name, next := range c.hosts {
+			if !next.After(now) {
+				delete(c.hosts, name)
+			}
+		}
+		c.sweepAt = max(minHostsSweep, 2*len(c.hosts))
+	}
+
+	slot := now
+	if next := c.hosts[host]; next.After(slot) {
+		slot = next
+	}
+	c.hosts[host] = slot.Add(c.cfg.HostDelay)
+	return slot
+}
+
+// release отсчитывает HostDelay от окончания запроса, если он шёл дольше паузы
+func (c *Checker) release(host string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if next := time.Now().Add(c.cfg.HostDelay); next.After(c.hosts[host]) {
+		c.hosts[host] = next
+	}
+}
+
+// groupByHost раскладывает цели по хостам, сохраняя порядок первого появления хоста
+func groupByHost(targets []Target) [][]Target {
+	index := make(map[string]int)
+	var groups [][]Target
+	for _, target := range targets {
+		host := target.URL
+		if parsed, err := url.Parse(target.URL); err == nil {
+			host = strings.ToLower(parsed.Host)
+		}
+		i, ok := index[host]
+		if !ok {
+			i = len(groups)
+			index[host] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], target)
+	}
+	return groups
+}
+
+// describe превращает ошибку запроса в короткое описание для истории проверок
+func describe(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return "dns: " + dnsErr.Err
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if urlErr.Timeout() {
+			return "timeout"
+		}
+		return urlErr.Err.Error()
+	}
+	return err.Error()
+}
@@ -0,0 +1,141 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+	"urlcutter/internal/models"
+)
+
+func TestCheck(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+		case "/missing":
+			http.NotFound(w, r)
+		case "/get-only":
+			if r.Method == http.MethodHead {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+			}
+		}
+	}))
+	defer srv.Close()
+
+	c := NewChecker(Config{AllowPrivate: true, HostDelay: time.Millisecond})
+	cases := []struct {
+		url    string
+		status int
+		broken bool
+	}{
+		{srv.URL + "/ok", http.StatusOK, false},
+		{srv.URL + "/missing", http.StatusNotFound, true},
+		{srv.URL + "/get-only", http.StatusOK, false},
+		{"http://does-not-exist.invalid/", 0, true},
+	}
+	for _, tc := range cases {
+		result := c.Check(context.Background(), Target{Short: "abc123", URL: tc.url})
+		if result.StatusCode != tc.status || result.Broken != tc.broken {
+			t.Fatalf("%s: unexpected result %+v", tc.url, result)
+		}
+		if result.CheckedAt.IsZero() || (tc.broken && tc.status == 0 && result.Error == "") {
+			t.Fatalf("%s: expected check time and error, got %+v", tc.url, result)
+		}
+	}
+}
+
+func TestCheck_PrivateAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	result := NewChecker(Config{}).Check(context.Background(), Target{URL: srv.URL})
+	if !result.Broken || result.StatusCode != 0 {
+		t.Fatalf("expected connection to private address to be refused, got %+v", result)
+	}
+}
+
+func TestCheckAll_Politeness(t *testing.T) {
+	var inFlight, maxInFlight int32
+	var mu sync.Mutex
+	var times []time.Time
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for {
+			max := atomic.LoadInt32(&maxInFlight)
+			if n <= max || atomic.CompareAndSwapInt32(&maxInFlight, max, n) {
+				break
+			}
+		}
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(handler))
+	defer srv.Close()
+
+	var targets []Target
+	for i := 0; i < 4; i++ {
+		targets = append(targets, Target{Short: "s", URL: srv.URL})
+	}
+
+	delay := 30 * time.Millisecond
+	c := NewChecker(Config{AllowPrivate: true, Concurrency: 4, HostDelay: delay})
+	var results int32
+	c.CheckAll(context.Background(), targets, func(Target, *models.HealthCheck) { atomic.AddInt32(&results, 1) })
+
+	if results != 4 {
+		t.Fatalf("expected 4 results, got %d", results)
+	}
+	if maxInFlight != 1 {
+		t.Fatalf("expected requests to one host to be sequential, got %d in flight", maxInFlight)
+	}
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < delay {
+			t.Fatalf("expected at least %v between requests to one host, got %v", delay, gap)
+		}
+	}
+}
+
+func TestCheckAll_SlowHostDoesNotBlockOthers(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer slow.Close()
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer fast.Close()
+
+	var targets []Target
+	for i := 0; i < 3; i++ {
+		targets = append(targets, Target{Short: "slow", URL: slow.URL})
+	}
+	targets = append(targets, Target{Short: "fast", URL: fast.URL})
+
+	delay := 100 * time.Millisecond
+	c := NewChecker(Config{AllowPrivate: true, Concurrency: 2, HostDelay: delay})
+	start := time.Now()
+	var fastDone time.Duration
+	c.CheckAll(context.Background(), targets, func(target Target, _ *models.HealthCheck) {
+		if target.Short == "fast" {
+			fastDone = time.Since(start)
+		}
+	})
+	if fastDone == 0 || fastDone >= delay {
+		t.Fatalf("expected other host checked without waiting for the slow one, took %v", fastDone)
+	}
+}
+
+func TestChecker_ForgetsIdleHosts(t *testing.T) {
+	c := NewChecker(Config{HostDelay: time.Nanosecond})
+	for i := 0; i < 10*minHostsSweep; i++ {
+		c.reserve(fmt.Sprintf("host%d.example", i))
+	}
+	time.Sleep(time.Millisecond)
+	c.reserve("last.example")
+	if len(c.hosts) > minHostsSweep {
+		t.Fatalf("expected idle hosts to be forgotten, got %d tracked", len(c.hosts))
+	}
+}
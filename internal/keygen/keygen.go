@@ -0,0 +1,270 @@
+package keygen
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+	"urlcutter/pkg/shortener"
+)
+
+const (
+	defaultBatch               = 100
+	defaultStorageLowWatermark = 10000
+	defaultStorageBatch        = 10000
+	defaultLease               = 10 * time.Minute
+)
+
+// Store — хранилище пула кодов; его реализует repository.URLRepository
+type Store interface {
+	// FillCodePool добавляет свободные коды, пропуская уже занятые, и возвращает число добавленных
+	FillCodePool(ctx context.Context, codes []string) (int, error)
+	CountFreeCodes(ctx context.Context) (int, error)
+	// ReserveCodes закрепляет за экземпляром до n свободных кодов
+	ReserveCodes(ctx context.Context, instance string, n int, now time.Time) ([]string, error)
+	// TouchReservedCodes продлевает резерв экземпляра и возвращает коды, которые всё ещё
+	// закреплены за ним
+	TouchReservedCodes(ctx context.Context, instance string, now time.Time) ([]string, error)
+	// ReleaseCodes возвращает неиспользованный резерв экземпляра в пул
+	ReleaseCodes(ctx context.Context, instance string) error
+	// ConsumeCode убирает из пула код, занятый ссылкой
+	ConsumeCode(ctx context.Context, code string) error
+	// ReclaimCodes возвращает в пул резерв, не продлевавшийся с staleBefore, и удаляет
+	// из него коды, которые успели занять ссылки
+	ReclaimCodes(ctx context.Context, staleBefore time.Time) (int, error)
+}
+
+type Config struct {
+	// Instance различает резервы экземпляров; по умолчанию hostname-pid
+	Instance string
+	// Batch — сколько кодов экземпляр резервирует за раз
+	Batch int
+	// LowWatermark — при стольких оставшихся в памяти кодах резервируется следующая пачка;
+	// по умолчанию четверть Batch
+	LowWatermark int
+	// StorageLowWatermark — при стольких свободных кодах в хранилище генерируются новые
+	StorageLowWatermark int
+	// StorageBatch — сколько кодов генерируется за раз
+	StorageBatch int
+	// Lease — резерв, который экземпляр не продлевал столько времени, считается резервом
+	// упавшего экземпляра и возвращается в пул
+	Lease    time.Duration
+	Generate func() (string, error)
+}
+
+// Pool раздаёт заранее сгенерированные и проверенные на уникальность коды. Коды
+// резервируются в хранилище пачками, так что несколько экземпляров не выдадут один код,
+// а создание ссылки не ждёт генерации и проверки на совпадения.
+type Pool struct {
+	cfg   Config
+	store Store
+	now   func() time.Time
+
+	mu     sync.Mutex
+	codes  []string
+	refill chan struct{}
+}
+
+func NewPool(store Store, cfg Config) *Pool {
+	if cfg.Instance == "" {
+		host, _ := os.Hostname()
+		cfg.Instance = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	if cfg.Batch == 0 {
+		cfg.Batch = defaultBatch
+	}
+	if cfg.LowWatermark == 0 {
+		cfg.LowWatermark = cfg.Batch / 4
+	}
+	if cfg.StorageLowWatermark == 0 {
+		cfg.StorageLowWatermark = defaultStorageLowWatermark
+	}
+	if cfg.StorageBatch == 0 {
+		cfg.StorageBatch = defaultStorageBatch
+	}
+	if cfg.Lease == 0 {
+		cfg.Lease = defaultLease
+	}
+	if cfg.Generate == nil {
+		cfg.Generate = shortener.GenerateShortURL
+	}
+	return &Pool{cfg: cfg, store: store, now: time.Now, refill: make(chan struct{}, 1)}
+}
+
+// Next выдаёт код. Если резерв в памяти кончился, пачка резервируется сразу, а при пустом
+// хранилище коды сначала генерируются.
+func (p *Pool) Next(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.codes) == 0 {
+		if err := p.reserve(ctx); err != nil {
+			return "", err
+		}
+	}
+	if len(p.codes) == 0 {
+		if _, err := p.fill(ctx); err != nil {
+			return "", err
+		}
+		if err := p.reserve(ctx); err != nil {
+			return "", err
+		}
+	}
+	if len(p.codes) == 0 {
+		return "", fmt.Errorf("code pool is empty")
+	}
+
+	code := p.codes[len(p.codes)-1]
+	p.codes = p.codes[:len(p.codes)-1]
+	if len(p.codes) < p.cfg.LowWatermark {
+		select {
+		case p.refill <- struct{}{}:
+		default:
+		}
+	}
+	return code, nil
+}
+
+// Consume отмечает, что код занят ссылкой
+func (p *Pool) Consume(ctx context.Context, code string) error {
+	return p.store.ConsumeCode(ctx, code)
+}
+
+// Start обслуживает пул каждые interval и сразу, когда резерв в памяти опускается ниже
+// LowWatermark: пополняет хранилище, резервирует коды, продлевает резерв и возвращает
+// резерв упавших экземпляров. interval должен быть заметно меньше Lease. stop возвращает
+// неиспользованный резерв в пул.
+func (p *Pool) Start(interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-p.refill:
+			case <-ticker.C:
+			}
+			if err := p.Maintain(ctx); err != nil {
+				log.Printf("Failed to maintain code pool: %v", err)
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+		if err := p.Release(context.Background()); err != nil {
+			log.Printf("Failed to release reserved codes: %v", err)
+		}
+	}
+}
+
+// Maintain делает один проход обслуживания пула. Первым делом продлевается резерв: если
+// продлить не удалось или часть кодов уже вернули в пул как резерв упавшего экземпляра,
+// эти коды убираются из памяти, чтобы не выдать их повторно.
+func (p *Pool) Maintain(ctx context.Context) error {
+	now := p.now()
+	if err := p.touch(ctx, now); err != nil {
+		return err
+	}
+
+	free, err := p.store.CountFreeCodes(ctx)
+	if err != nil {
+		return err
+	}
+	if free < p.cfg.StorageLowWatermark {
+		if _, err := p.fill(ctx); err != nil {
+			return err
+		}
+	}
+
+	p.mu.Lock()
+	if len(p.codes) < p.cfg.LowWatermark {
+		err = p.reserve(ctx)
+	}
+	p.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	reclaimed, err := p.store.ReclaimCodes(ctx, now.Add(-p.cfg.Lease))
+	if err != nil {
+		return err
+	}
+	if reclaimed > 0 {
+		log.Printf("Reclaimed %d codes reserved by stopped instances", reclaimed)
+	}
+	return nil
+}
+
+// Release возвращает неиспользованный резерв экземпляра в пул
+func (p *Pool) Release(ctx context.Context) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.codes = nil
+	return p.store.ReleaseCodes(ctx, p.cfg.Instance)
+}
+
+// Len возвращает число кодов, оставшихся в памяти
+func (p *Pool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.codes)
+}
+
+// touch продлевает резерв и оставляет в памяти только коды, которые всё ещё закреплены за
+// экземпляром; при ошибке резерв в памяти сбрасывается целиком
+func (p *Pool) touch(ctx context.Context, now time.Time) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	held, err := p.store.TouchReservedCodes(ctx, p.cfg.Instance, now)
+	if err != nil {
+		p.codes = nil
+		return err
+	}
+	owned := make(map[string]bool, len(held))
+	for _, code := range held {
+		owned[code] = true
+	}
+	kept := p.codes[:0]
+	for _, code := range p.codes {
+		if owned[code] {
+			kept = append(kept, code)
+		}
+	}
+	if lost := len(p.codes) - len(kept); lost > 0 {
+		log.Printf("Dropped %d codes whose reservation has expired", lost)
+	}
+	p.codes = kept
+	return nil
+}
+
+// reserve добавляет к резерву в памяти пачку кодов; вызывается под mu
+func (p *Pool) reserve(ctx context.Context) error {
+	codes, err := p.store.ReserveCodes(ctx, p.cfg.Instance, p.cfg.Batch, p.now())
+	if err != nil {
+		return err
+	}
+	p.codes = append(codes, p.codes...)
+	return nil
+}
+
+// fill генерирует StorageBatch кодов и добавляет в хранилище те, что ещё не заняты
+func (p *Pool) fill(ctx context.Context) (int, error) {
+	codes := make([]string, 0, p.cfg.StorageBatch)
+	for i := 0; i < p.cfg.StorageBatch; i++ {
+		code, err := p.cfg.Generate()
+		if err != nil {
+			return 0, err
+		}
+		codes = append(codes, code)
+	}
+	return p.store.FillCodePool(ctx, codes)
+}
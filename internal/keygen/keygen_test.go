@@ -0,0 +1,268 @@
+package keygen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryStore — пул кодов в памяти с той же логикой резерва, что и в базе
+type memoryStore struct {
+	mu       sync.Mutex
+	codes    map[string]*reservation
+	used     map[string]bool
+	reserves int
+	touchErr error
+}
+
+type reservation struct {
+	instance string
+	at       time.Time
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{codes: make(map[string]*reservation), used: make(map[string]bool)}
+}
+
+func (m *memoryStore) FillCodePool(ctx context.Context, codes []string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	added := 0
+	for _, code := range codes {
+		if _, ok := m.codes[code]; !ok && !m.used[code] {
+			m.codes[code] = &reservation{}
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (m *memoryStore) CountFreeCodes(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, r := range m.codes {
+		if r.instance == "" {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memoryStore) ReserveCodes(ctx context.Context, instance string, n int, now time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.reserves++
+	var codes []string
+	for code, r := range m.codes {
+		if r.instance == "" && len(codes) < n {
+			r.instance, r.at = instance, now
+			codes = append(codes, code)
+		}
+	}
+	return codes, nil
+}
+
+func (m *memoryStore) TouchReservedCodes(ctx context.Context, instance string, now time.Time) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.touchErr != nil {
+		return nil, m.touchErr
+	}
+	var held []string
+	for code, r := range m.codes {
+		if r.instance == instance {
+			r.at = now
+			held = append(held, code)
+		}
+	}
+	return held, nil
+}
+
+func (m *memoryStore) ReleaseCodes(ctx context.Context, instance string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, r := range m.codes {
+		if r.instance == instance {
+			*r = reservation{}
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) ConsumeCode(ctx context.Context, code string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.codes, code)
+	m.used[code] = true
+	return nil
+}
+
+func (m *memoryStore) ReclaimCodes(ctx context.Context, staleBefore time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for _, r := range m.codes {
+		if r.instance != "" && r.at.Before(staleBefore) {
+			*r = reservation{}
+			n++
+		}
+	}
+	return n, nil
+}
+
+func sequence() func() (string, error) {
+	var mu sync.Mutex
+	n := 0
+	return func() (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		n++
+		return fmt.Sprintf("c%05d", n), nil
+	}
+}
+
+func TestPool_UniqueAcrossInstances(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	generate := sequence()
+	a := NewPool(store, Config{Instance: "a", Batch: 10, StorageBatch: 50, StorageLowWatermark: 20, Generate: generate})
+	b := NewPool(store, Config{Instance: "b", Batch: 10, StorageBatch: 50, StorageLowWatermark: 20, Generate: generate})
+
+	seen := make(map[string]bool)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, p := range []*Pool{a, b} {
+		wg.Add(1)
+		go func(p *Pool) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				code, err := p.Next(ctx)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				mu.Lock()
+				if seen[code] {
+					t.Errorf("code %s issued twice", code)
+				}
+				seen[code] = true
+				mu.Unlock()
+				_ = p.Consume(ctx, code)
+			}
+		}(p)
+	}
+	wg.Wait()
+	if len(seen) != 200 {
+		t.Fatalf("expected 200 codes, got %d", len(seen))
+	}
+}
+
+func TestPool_Maintain(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	p := NewPool(store, Config{Instance: "a", Batch: 8, StorageBatch: 40, StorageLowWatermark: 30, Generate: sequence()})
+
+	if err := p.Maintain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if p.Len() != 8 {
+		t.Fatalf("expected reserved batch, got %d codes", p.Len())
+	}
+	if free, _ := store.CountFreeCodes(ctx); free != 32 {
+		t.Fatalf("expected 32 free codes, got %d", free)
+	}
+
+	// Резерв выше LowWatermark — новых пачек нет
+	for i := 0; i < 5; i++ {
+		code, _ := p.Next(ctx)
+		_ = p.Consume(ctx, code)
+	}
+	reserves := store.reserves
+	if err := p.Maintain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if store.reserves != reserves {
+		t.Fatalf("unexpected reservation above low watermark")
+	}
+
+	// Меньше LowWatermark (2) — Next просит пополнение
+	for i := 0; i < 2; i++ {
+		code, _ := p.Next(ctx)
+		_ = p.Consume(ctx, code)
+	}
+	select {
+	case <-p.refill:
+	default:
+		t.Fatalf("expected refill request below low watermark")
+	}
+
+	if err := p.Release(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if free, _ := store.CountFreeCodes(ctx); free != 33 {
+		t.Fatalf("expected unused codes released, got %d free", free)
+	}
+}
+
+func TestPool_ReclaimsCrashedInstance(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	crashed := NewPool(store, Config{Instance: "crashed", Batch: 5, StorageBatch: 5, Generate: sequence()})
+	if _, err := crashed.Next(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if free, _ := store.CountFreeCodes(ctx); free != 0 {
+		t.Fatalf("expected all codes reserved, got %d free", free)
+	}
+
+	now := time.Now()
+	alive := NewPool(store, Config{Instance: "alive", Batch: 5, StorageBatch: 5, StorageLowWatermark: 1, Lease: time.Minute, Generate: sequence()})
+	alive.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if err := alive.Maintain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if free, _ := store.CountFreeCodes(ctx); free != 5 {
+		t.Fatalf("expected crashed reservation returned to pool, got %d free", free)
+	}
+}
+
+func TestPool_DropsLostReservation(t *testing.T) {
+	ctx := context.Background()
+	store := newMemoryStore()
+	generate := sequence()
+	a := NewPool(store, Config{Instance: "a", Batch: 4, StorageBatch: 8, StorageLowWatermark: 1, Generate: generate})
+	if err := a.Maintain(ctx); err != nil || a.Len() != 4 {
+		t.Fatalf("expected reserved batch, got %d codes, %v", a.Len(), err)
+	}
+
+	// Экземпляр «завис» дольше Lease: его резерв вернули в пул и забрал другой
+	if _, err := store.ReclaimCodes(ctx, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	b := NewPool(store, Config{Instance: "b", Batch: 8, StorageBatch: 8, StorageLowWatermark: 1, Generate: generate})
+	if err := b.Maintain(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Maintain(ctx); err != nil {
+		t.Fatal(err)
+	}
+	taken := make(map[string]bool)
+	for _, code := range b.codes {
+		taken[code] = true
+	}
+	for _, code := range a.codes {
+		if taken[code] {
+			t.Fatalf("code %s is held by both instances", code)
+		}
+	}
+
+	store.touchErr = errors.New("connection reset")
+	if err := a.Maintain(ctx); err == nil || a.Len() != 0 {
+		t.Fatalf("expected failed touch to drop reservation, got %d codes, %v", a.Len(), err)
+	}
+}
@@ -0,0 +1,232 @@
+package metadata
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+
+	"golang.org/x/net/html"
+)
+
+const (
+	defaultTimeout      = 5 * time.Second
+	defaultMaxBytes     = 512 << 10
+	defaultMaxRedirects = 3
+	defaultUserAgent    = "URLcutterBot/1.0 (+link preview)"
+
+	maxTitleLength       = 300
+	maxDescriptionLength = 1000
+)
+
+type Config struct {
+	// Policy проверяет адрес страницы и каждый редирект; nil — политика по умолчанию
+	Policy *policy.Policy
+	// Timeout ограничивает весь запрос вместе с чтением тела
+	Timeout time.Duration
+	// MaxBytes — сколько байт страницы читать; метаданные обычно в начале <head>
+	MaxBytes int64
+	// MaxRedirects — сколько редиректов проходить до страницы
+	MaxRedirects int
+	UserAgent    string
+	// AllowPrivate разрешает соединения с приватными адресами (только для тестов)
+	AllowPrivate bool
+}
+
+// Fetcher загружает страницу назначения и извлекает из неё заголовок, описание,
+// картинку Open Graph и favicon
+type Fetcher struct {
+	cfg    Config
+	client *http.Client
+}
+
+func NewFetcher(cfg Config) *Fetcher {
+	if cfg.Policy == nil {
+		cfg.Policy = policy.New(policy.Config{})
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.MaxBytes == 0 {
+		cfg.MaxBytes = defaultMaxBytes
+	}
+	if cfg.MaxRedirects == 0 {
+		cfg.MaxRedirects = defaultMaxRedirects
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = defaultUserAgent
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		dialer.Control = policy.DenyPrivateControl
+	}
+	f := &Fetcher{cfg: cfg}
+	f.client = &http.Client{
+		Timeout: cfg.Timeout,
+		Transport: &http.Transport{
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   cfg.Timeout,
+			ResponseHeaderTimeout: cfg.Timeout,
+			MaxIdleConns:          10,
+			IdleConnTimeout:       30 * time.Second,
+		},
+		CheckRedirect: f.checkRedirect,
+	}
+	return f
+}
+
+func (f *Fetcher) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > f.cfg.MaxRedirects {
+		return fmt.Errorf("stopped after %d redirects", f.cfg.MaxRedirects)
+	}
+	_, err := f.cfg.Policy.Check(req.Context(), req.URL.String())
+	return err
+}
+
+// Fetch загружает страницу raw и возвращает её метаданные. Для ответов не в HTML
+// заполняется только favicon сайта.
+func (f *Fetcher) Fetch(ctx context.Context, raw string) (*models.LinkMetadata, error) {
+	checked, err := f.cfg.Policy.Check(ctx, raw)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checked, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", f.cfg.UserAgent)
+	req.Header.Set("Accept", "text/html,application/xhtml+xml;q=0.9,*/*;q=0.1")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	base := resp.Request.URL
+	meta := &models.LinkMetadata{}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType == "text/html" || mediaType == "application/xhtml+xml" {
+		parse(io.LimitReader(resp.Body, f.cfg.MaxBytes), base, meta)
+	}
+	if meta.Favicon == "" {
+		meta.Favicon = base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String()
+	}
+	return meta, nil
+}
+
+// parse читает <head> и заполняет meta; og:* важнее обычных title и description
+func parse(r io.Reader, base *url.URL, meta *models.LinkMetadata) {
+	var title, description, ogTitle, ogDescription, image, icon string
+	finish := func() {
+		meta.Title = clean(first(ogTitle, title), maxTitleLength)
+		meta.Description = clean(first(ogDescription, description), maxDescriptionLength)
+		meta.Image = resolve(base, image)
+		meta.Favicon = resolve(base, icon)
+	}
+
+	z := html.NewTokenizer(r)
+	inTitle := false
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			finish()
+			return
+		case html.TextToken:
+			if inTitle && title == "" {
+				title = string(z.Text())
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "title":
+				inTitle = false
+			case "head":
+				// Всё нужное находится в <head>, тело страницы не читаем
+				finish()
+				return
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			attrs := map[string]string{}
+			for hasAttr {
+				var k, v []byte
+				k, v, hasAttr = z.TagAttr()
+				attrs[string(k)] = string(v)
+			}
+
+			switch string(name) {
+			case "title":
+				inTitle = tt == html.StartTagToken
+			case "meta":
+				key := strings.ToLower(first(attrs["property"], attrs["name"]))
+				content := attrs["content"]
+				switch key {
+				case "og:title":
+					ogTitle = first(ogTitle, content)
+				case "og:description":
+					ogDescription = first(ogDescription, content)
+				case "description":
+					description = first(description, content)
+				case "og:image", "og:image:url", "og:image:secure_url", "twitter:image":
+					image = first(image, content)
+				}
+			case "link":
+				for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+					if rel == "icon" && icon == "" {
+						icon = attrs["href"]
+					}
+				}
+			case "body":
+				finish()
+				return
+			}
+		}
+	}
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// clean схлопывает пробелы и обрезает строку до limit символов
+func clean(s string, limit int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+	return string(runes[:limit])
+}
+
+// resolve превращает относительную ссылку в абсолютную; допускаются только http(s)
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	u, err := base.Parse(ref)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
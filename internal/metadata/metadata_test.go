@@ -0,0 +1,113 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+	"urlcutter/internal/policy"
+)
+
+const page = `<!doctype html>
+<html><head>
+<title>  Plain
+  title </title>
+<meta name="description" content="Plain description">
+<meta property="og:title" content="OG title">
+<meta property="og:image" content="/img/cover.png">
+<link rel="shortcut icon" href="/static/icon.ico">
+</head><body><meta property="og:description" content="ignored"></body></html>`
+
+func newTestFetcher(cfg Config) *Fetcher {
+	cfg.Policy = policy.New(policy.Config{AllowPrivate: true})
+	cfg.AllowPrivate = true
+	return NewFetcher(cfg)
+}
+
+func TestFetch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	meta, err := newTestFetcher(Config{}).Fetch(context.Background(), srv.URL+"/old")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.Title != "OG title" || meta.Description != "Plain description" {
+		t.Fatalf("unexpected text metadata: %+v", meta)
+	}
+	if meta.Image != srv.URL+"/img/cover.png" || meta.Favicon != srv.URL+"/static/icon.ico" {
+		t.Fatalf("expected absolute image and favicon, got %+v", meta)
+	}
+}
+
+func TestFetch_NotHTML(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-1.4 <title>nope</title>"))
+	}))
+	defer srv.Close()
+
+	meta, err := newTestFetcher(Config{}).Fetch(context.Background(), srv.URL+"/doc.pdf")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if meta.Title != "" || meta.Favicon != srv.URL+"/favicon.ico" {
+		t.Fatalf("expected only default favicon, got %+v", meta)
+	}
+}
+
+func TestFetch_Limits(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(200 * time.Millisecond)
+		case "/large":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><head>" + strings.Repeat("<!-- padding -->", 1000) + "<title>late</title>"))
+		case "/missing":
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	f := newTestFetcher(Config{Timeout: 50 * time.Millisecond, MaxBytes: 1024})
+	if _, err := f.Fetch(context.Background(), srv.URL+"/slow"); err == nil {
+		t.Fatalf("expected timeout")
+	}
+	if meta, err := f.Fetch(context.Background(), srv.URL+"/large"); err != nil || meta.Title != "" {
+		t.Fatalf("expected title beyond size limit to be ignored, got %+v, %v", meta, err)
+	}
+	if _, err := f.Fetch(context.Background(), srv.URL+"/missing"); err == nil {
+		t.Fatalf("expected error for 404")
+	}
+}
+
+func TestFetch_PrivateAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(page))
+	}))
+	defer srv.Close()
+
+	// Политика по умолчанию не пропускает адрес ещё до запроса
+	if _, err := NewFetcher(Config{}).Fetch(context.Background(), srv.URL); err == nil {
+		t.Fatalf("expected private address to be rejected by policy")
+	}
+
+	// Даже если политика пропустила имя, соединение с приватным адресом запрещено
+	f := NewFetcher(Config{Policy: policy.New(policy.Config{AllowPrivate: true})})
+	_, err := f.Fetch(context.Background(), srv.URL)
+	var validationErr *policy.ValidationError
+	if !errors.As(err, &validationErr) || validationErr.Code != policy.CodePrivateAddress {
+		t.Fatalf("expected dial to be rejected, got %v", err)
+	}
+}
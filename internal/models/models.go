@@ -5,17 +5,357 @@ import (
 )
 
 type URL struct {
-	Id        string    `json:"id" db:"id"`
-	Original  string    `json:"original_url" db:"original_url"`
-	Short     string    `json:"short_url" db:"short_url"`
+	Id       string `json:"id" db:"id"`
+	Original string `json:"original_url" db:"original_url"`
+	// Canonical — каноническая форма Original, по ней ищутся дубликаты
+	Canonical string `json:"canonical_url,omitempty" db:"canonical_url"`
+	Short     string `json:"short_url" db:"short_url"`
+	// Domain — брендированный домен ссылки; пусто — домен сервиса по умолчанию
+	Domain    string    `json:"domain,omitempty" db:"domain"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	Clicks    int       `json:"clicks" db:"clicks"`
+	// Owner не отдаётся в JSON: ссылка видна без ключа в /api/v1/url/{short}
+	Owner    string `json:"-" db:"owner_id"`
+	Disabled bool   `json:"disabled" db:"disabled"`
+	// DisabledReason — почему ссылка отключена, например правило блок-листа
+	DisabledReason string `json:"disabled_reason,omitempty" db:"disabled_reason"`
+	// RedirectType — HTTP-статус редиректа (301, 302, 307, 308), 0 — значение по умолчанию
+	RedirectType int `json:"redirect_type,omitempty" db:"redirect_type"`
+	// ForwardQuery добавляет query-параметры перехода к целевому URL
+	ForwardQuery bool `json:"forward_query,omitempty" db:"forward_query"`
+	// ForwardPath дописывает путь после кода (/abc123/extra) к пути целевого URL
+	ForwardPath bool `json:"forward_path,omitempty" db:"forward_path"`
+	UTM         UTM  `json:"utm"`
+	// Rules — правила таргетинга, проверяются по порядку до перехода на Original
+	Rules []TargetingRule `json:"rules,omitempty" db:"targeting_rules"`
+	// Variants — варианты A/B-теста, между которыми делится трафик
+	Variants []Variant `json:"variants,omitempty" db:"variants"`
+	// StickyVariants закрепляет вариант за посетителем через cookie
+	StickyVariants bool `json:"sticky_variants,omitempty" db:"sticky_variants"`
+	// Interstitial показывает страницу предпросмотра вместо немедленного редиректа
+	Interstitial bool `json:"interstitial,omitempty" db:"interstitial"`
+	// NotBefore и NotAfter — окно, в котором ссылка активна; nil — без ограничения
+	NotBefore *time.Time `json:"not_before,omitempty" db:"not_before"`
+	NotAfter  *time.Time `json:"not_after,omitempty" db:"not_after"`
+	// FallbackURL — куда вести после NotAfter; если пусто, ссылка считается истёкшей
+	FallbackURL string `json:"fallback_url,omitempty" db:"fallback_url"`
+	// Metadata — заголовок, описание и картинки страницы назначения, собираются в фоне
+	Metadata LinkMetadata `json:"metadata"`
+	// Social переопределяет собранные метаданные в карточке ссылки для соцсетей и мессенджеров
+	Social SocialOverride `json:"social"`
+	// Health — результат последней проверки доступности, nil — ещё не проверялась
+	Health *HealthCheck `json:"health,omitempty"`
+}
+
+// LinkMetadata — данные страницы назначения для отображения ссылки
+type LinkMetadata struct {
+	Title       string `json:"title,omitempty" db:"meta_title"`
+	Description string `json:"description,omitempty" db:"meta_description"`
+	Image       string `json:"image,omitempty" db:"meta_image"`
+	Favicon     string `json:"favicon,omitempty" db:"meta_favicon"`
+	// FetchedAt — время последней попытки, Error — её ошибка, если страница не загрузилась
+	FetchedAt *time.Time `json:"fetched_at,omitempty" db:"meta_fetched_at"`
+	Error     string     `json:"error,omitempty" db:"meta_error"`
+}
+
+// Domain — брендированный короткий домен, подключённый владельцем
+type Domain struct {
+	Host      string    `json:"host" db:"host"`
+	Owner     string    `json:"owner,omitempty" db:"owner_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type CreateDomainRequest struct {
+	Host string `json:"host"`
+}
+
+// SocialOverride — заголовок, описание и картинка карточки ссылки, заданные вручную
+type SocialOverride struct {
+	Title       string `json:"title,omitempty" db:"social_title"`
+	Description string `json:"description,omitempty" db:"social_description"`
+	Image       string `json:"image,omitempty" db:"social_image"`
+}
+
+// Unfurl — данные карточки ссылки для ботов, которые строят превью
+type Unfurl struct {
+	Title       string
+	Description string
+	Image       string
+	// URL — короткая ссылка, Destination — куда она ведёт
+	URL         string
+	Destination string
+}
+
+// HealthCheck — результат одной проверки доступности адреса назначения
+type HealthCheck struct {
+	Short      string    `json:"short_url"`
+	Domain     string    `json:"domain,omitempty"`
+	URL        string    `json:"url"`
+	StatusCode int       `json:"status_code,omitempty"`
+	LatencyMs  int64     `json:"latency_ms"`
+	Error      string    `json:"error,omitempty"`
+	Broken     bool      `json:"broken"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// Состояния ссылки относительно окна активности
+const (
+	StatusScheduled = "scheduled"
+	StatusActive    = "active"
+	StatusExpired   = "expired"
+	StatusDisabled  = "disabled"
+)
+
+// Статусы безопасности ссылки на странице предпросмотра
+const (
+	SafetyOK      = "ok"
+	SafetyWarning = "warning"
+	SafetyBlocked = "blocked"
+)
+
+// Preview — данные страницы предпросмотра ссылки
+type Preview struct {
+	Short        string    `json:"short_url"`
+	Domain       string    `json:"domain,omitempty"`
+	Destination  string    `json:"destination"`
+	CreatedAt    time.Time `json:"created_at"`
+	Safety       string    `json:"safety"`
+	SafetyReason string    `json:"safety_reason,omitempty"`
+}
+
+type Variant struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// ClickEvent — один переход по короткой ссылке
+type ClickEvent struct {
+	Short       string    `json:"short_url"`
+	Domain      string    `json:"domain,omitempty"`
+	Variant     string    `json:"variant,omitempty"`
+	Destination string    `json:"destination"`
+	Device      string    `json:"device,omitempty"`
+	Country     string    `json:"country,omitempty"`
+	OccurredAt  time.Time `json:"occurred_at"`
+}
+
+// VariantStats — переходы по одному варианту A/B-теста
+type VariantStats struct {
+	Variant string  `json:"variant"`
+	Clicks  int     `json:"clicks"`
+	Share   float64 `json:"share"`
+}
+
+type StatsResponse struct {
+	Short    string         `json:"short_url"`
+	Domain   string         `json:"domain,omitempty"`
+	Clicks   int            `json:"clicks"`
+	Variants []VariantStats `json:"variants"`
+}
+
+// TargetingRule отправляет посетителя на URL, если совпали все заданные условия.
+// Пустое условие совпадает с любым значением.
+type TargetingRule struct {
+	URL string `json:"url"`
+	// OS — ios, android, windows, macos, linux, chromeos, other
+	OS []string `json:"os,omitempty"`
+	// Device — mobile, tablet, desktop, bot
+	Device []string `json:"device,omitempty"`
+	// Language — языки из Accept-Language, "en" совпадает с "en-US"
+	Language []string `json:"language,omitempty"`
+	// Country — коды стран ISO 3166-1 alpha-2
+	Country []string `json:"country,omitempty"`
+	// TimeFrom и TimeTo — окно по времени суток в UTC в формате "15:04", может переходить через полночь
+	TimeFrom string `json:"time_from,omitempty"`
+	TimeTo   string `json:"time_to,omitempty"`
+	// Weekdays — дни недели: mon, tue, wed, thu, fri, sat, sun
+	Weekdays []string `json:"weekdays,omitempty"`
+}
+
+// UTM — метки кампании, которые добавляются к целевому URL при переходе
+type UTM struct {
+	Source   string `json:"source,omitempty" db:"utm_source"`
+	Medium   string `json:"medium,omitempty" db:"utm_medium"`
+	Campaign string `json:"campaign,omitempty" db:"utm_campaign"`
+	Term     string `json:"term,omitempty" db:"utm_term"`
+	Content  string `json:"content,omitempty" db:"utm_content"`
+}
+
+// URLInfo — данные ссылки для info API вместе с итоговым адресом перехода
+type URLInfo struct {
+	URL
+	LinkURLs
+	FinalURL string `json:"final_url"`
+	Status   string `json:"status"`
 }
 
 type CreateURLRequest struct {
-	URL string `json:"url" validate:"required, url"`
+	URL            string          `json:"url" validate:"required, url"`
+	Domain         string          `json:"domain,omitempty"`
+	RedirectType   int             `json:"redirect_type,omitempty"`
+	ForwardQuery   bool            `json:"forward_query,omitempty"`
+	ForwardPath    bool            `json:"forward_path,omitempty"`
+	UTM            UTM             `json:"utm"`
+	Rules          []TargetingRule `json:"rules,omitempty"`
+	Variants       []Variant       `json:"variants,omitempty"`
+	StickyVariants bool            `json:"sticky_variants,omitempty"`
+	Interstitial   bool            `json:"interstitial,omitempty"`
+	NotBefore      *time.Time      `json:"not_before,omitempty"`
+	NotAfter       *time.Time      `json:"not_after,omitempty"`
+	FallbackURL    string          `json:"fallback_url,omitempty"`
+	Social         SocialOverride  `json:"social"`
 }
 
+// RedirectRequest — данные перехода по короткой ссылке, нужные для выбора цели
+type RedirectRequest struct {
+	Short string
+	// Host — хост запроса, по нему выбирается домен ссылки
+	Host string
+	// Rest — путь после кода без ведущего слэша
+	Rest string
+	// RawQuery — query-строка перехода
+	RawQuery string
+	// Данные посетителя для правил таргетинга
+	UserAgent      string
+	AcceptLanguage string
+	Country        string
+	Time           time.Time
+	// Variant — вариант A/B-теста, закреплённый за посетителем ранее
+	Variant string
+	// Confirmed — запрос пришёл POST-ом; для ссылки с Interstitial это подтверждение
+	// перехода со страницы предпросмотра, для остальных ссылок поле не учитывается
+	Confirmed bool
+}
+
+// RedirectTarget — куда и с каким статусом перенаправить посетителя
+type RedirectTarget struct {
+	Location string
+	Status   int
+	// Variant — выбранный вариант A/B-теста; Sticky — закрепить его за посетителем
+	Variant string
+	Sticky  bool
+	// Interstitial — показать страницу предпросмотра вместо редиректа; переход ещё не учтён
+	Interstitial bool
+	// Unfurl — запрос пришёл от бота превью, ему нужна карточка ссылки вместо редиректа
+	Unfurl *Unfurl
+}
+
+// CreateURLResponse — созданная ссылка; ShortURL, как и раньше, содержит только код
 type CreateURLResponse struct {
 	ShortURL string `json:"short_url"`
+	Domain   string `json:"domain,omitempty"`
+	LinkURLs
+}
+
+// LinkURLs — абсолютные адреса ссылки и её страниц API; пусто, если публичный адрес
+// сервиса не настроен
+type LinkURLs struct {
+	ShortLink string `json:"short_link,omitempty"`
+	QRURL     string `json:"qr_url,omitempty"`
+	StatsURL  string `json:"stats_url,omitempty"`
+}
+
+type BatchCreateURLRequest struct {
+	URLs []string `json:"urls"`
+	// Domain — брендированный домен владельца для всех ссылок пачки, пустой — домен по умолчанию
+	Domain string `json:"domain,omitempty"`
+}
+
+type BatchCreateURLResponse struct {
+	Results []CreateURLResponse `json:"results"`
+}
+
+// Quota — лимиты владельца ссылок, 0 означает отсутствие ограничения
+type Quota struct {
+	MaxTotal     int `json:"max_total"`
+	MaxMonthly   int `json:"max_monthly"`
+	MaxActive    int `json:"max_active"`
+	MaxBatchSize int `json:"max_batch_size"`
+}
+
+// UsageCounts — сколько ссылок владелец уже создал
+type UsageCounts struct {
+	Total   int `json:"total"`
+	Monthly int `json:"monthly"`
+	Active  int `json:"active"`
+}
+
+type UsageResponse struct {
+	Owner  string      `json:"owner"`
+	Limits Quota       `json:"limits"`
+	Usage  UsageCounts `json:"usage"`
+}
+
+// События ссылок, на которые можно подписать вебхук
+const (
+	EventLinkCreated        = "link.created"
+	EventLinkUpdated        = "link.updated"
+	EventLinkDisabled       = "link.disabled"
+	EventLinkExpired        = "link.expired"
+	EventLinkClickThreshold = "link.clicks_threshold"
+)
+
+// Webhook — подписка владельца на события его ссылок
+type Webhook struct {
+	ID    string `json:"id" db:"id"`
+	Owner string `json:"owner,omitempty" db:"owner_id"`
+	URL   string `json:"url" db:"url"`
+	// Secret подписывает тела запросов; отдаётся только при создании подписки
+	Secret    string    `json:"secret,omitempty" db:"secret"`
+	Events    []string  `json:"events" db:"events"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// APIKey — ключ API владельца; сам ключ не хранится, только его SHA-256
+type APIKey struct {
+	Hash      string    `json:"-" db:"key_hash"`
+	Owner     string    `json:"owner" db:"owner_id"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type CreateWebhookRequest struct {
+	URL string `json:"url"`
+	// Events — на какие события подписаться; пусто — на все
+	Events []string `json:"events"`
+}
+
+// WebhookEvent — тело запроса вебхука
+type WebhookEvent struct {
+	// ID одинаков у повторов одного события, по нему получатель отбрасывает дубликаты
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	CreatedAt time.Time `json:"created_at"`
+	Link      *URL      `json:"link"`
+	ShortLink string    `json:"short_link,omitempty"`
+	// Threshold — пройденный порог переходов для link.clicks_threshold
+	Threshold int `json:"threshold,omitempty"`
+}
+
+// WebhookMessage — событие в очереди доставки одной подписке
+type WebhookMessage struct {
+	ID        int64
+	WebhookID string
+	EventID   string
+	EventType string
+	URL       string
+	Secret    string
+	Payload   []byte
+	// Attempts — сколько попыток доставки уже сделано
+	Attempts int
+}
+
+// WebhookDelivery — запись журнала доставки: одна попытка отправить событие
+type WebhookDelivery struct {
+	WebhookID   string    `json:"webhook_id"`
+	EventID     string    `json:"event_id"`
+	EventType   string    `json:"event_type"`
+	Attempt     int       `json:"attempt"`
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	Success     bool      `json:"success"`
+	DurationMs  int64     `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+	// NextAttemptAt — время повтора; nil, если доставка завершена успешно или попытки кончились
+	NextAttemptAt *time.Time `json:"next_attempt_at,omitempty"`
 }
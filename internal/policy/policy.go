@@ -0,0 +1,312 @@
+package policy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"golang.org/x/net/idna"
+)
+
+// Коды ошибок валидации, отдаются клиенту в поле code
+const (
+	CodeTooLong          = "too_long"
+	CodeMalformed        = "malformed"
+	CodeSchemeNotAllowed = "scheme_not_allowed"
+	CodeMissingHost      = "missing_host"
+	CodeInvalidHost      = "invalid_host"
+	CodePrivateAddress   = "private_address"
+	CodeDomainDenied     = "domain_denied"
+	CodeDomainNotAllowed = "domain_not_allowed"
+	CodeUnresolvable     = "unresolvable_host"
+	CodeBlocked          = "blocked"
+	CodeRedirectLoop     = "redirect_loop"
+	CodeShortenerChain   = "shortener_chain"
+)
+
+const (
+	defaultMaxURLLength   = 2048
+	defaultResolveTimeout = 2 * time.Second
+)
+
+// ValidationError описывает, почему URL не прошёл проверку
+type ValidationError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// Resolver — часть net.Resolver, нужная политике; подменяется в тестах
+type Resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+type Config struct {
+	// AllowedSchemes — разрешённые схемы, по умолчанию http и https
+	AllowedSchemes []string
+	// MaxURLLength — максимальная длина URL, по умолчанию 2048
+	MaxURLLength int
+	// AllowPrivate разрешает loopback, приватные и link-local адреса
+	AllowPrivate bool
+	// SkipResolve отключает проверку адресов, в которые резолвится имя хоста. Без неё
+	// запрет приватных адресов держится только на проверке при соединении
+	// (DenyPrivateControl) там, где она подключена.
+	SkipResolve    bool
+	ResolveTimeout time.Duration
+	Resolver       Resolver
+	// AllowDomains — если список не пуст, разрешены только эти домены и их поддомены
+	AllowDomains []string
+	// DenyDomains — запрещённые домены вместе с поддоменами
+	DenyDomains []string
+}
+
+type Policy struct {
+	cfg     Config
+	schemes map[string]bool
+	allow   []string
+	deny    []string
+}
+
+func New(cfg Config) *Policy {
+	if len(cfg.AllowedSchemes) == 0 {
+		cfg.AllowedSchemes = []string{"http", "https"}
+	}
+	if cfg.MaxURLLength == 0 {
+		cfg.MaxURLLength = defaultMaxURLLength
+	}
+	if cfg.ResolveTimeout == 0 {
+		cfg.ResolveTimeout = defaultResolveTimeout
+	}
+	if cfg.Resolver == nil {
+		cfg.Resolver = net.DefaultResolver
+	}
+
+	p := &Policy{cfg: cfg, schemes: make(map[string]bool)}
+	for _, s := range cfg.AllowedSchemes {
+		p.schemes[strings.ToLower(s)] = true
+	}
+	p.allow = normalizeDomains(cfg.AllowDomains)
+	p.deny = normalizeDomains(cfg.DenyDomains)
+	return p
+}
+
+// Check проверяет URL и возвращает его нормализованную форму (хост в нижнем регистре и в punycode,
+// IPv4 в сокращённой или числовой записи — в виде a.b.c.d). ctx ограничивает резолв имени.
+func (p *Policy) Check(ctx context.Context, raw string) (string, error) {
+	if len(raw) > p.cfg.MaxURLLength {
+		return "", invalid(CodeTooLong, "URL is longer than %d characters", p.cfg.MaxURLLength)
+	}
+
+	parsed, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", invalid(CodeMalformed, "invalid URL")
+	}
+
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	if !p.schemes[parsed.Scheme] {
+		return "", invalid(CodeSchemeNotAllowed, "scheme %q is not allowed", parsed.Scheme)
+	}
+
+	hostname := parsed.Hostname()
+	if hostname == "" {
+		return "", invalid(CodeMissingHost, "URL must contain a host")
+	}
+
+	host := strings.TrimSuffix(strings.ToLower(hostname), ".")
+	if addr, ok := parseIPv4Host(host); ok {
+		host = addr.String()
+	} else if _, err := netip.ParseAddr(host); err != nil {
+		if host, err = idna.Lookup.ToASCII(host); err != nil {
+			return "", invalid(CodeInvalidHost, "invalid host %q", hostname)
+		}
+	}
+	if port := parsed.Port(); port != "" {
+		parsed.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		parsed.Host = "[" + host + "]"
+	} else {
+		parsed.Host = host
+	}
+
+	if err := p.checkDomain(host); err != nil {
+		return "", err
+	}
+	if err := p.checkAddress(ctx, host); err != nil {
+		return "", err
+	}
+
+	return parsed.String(), nil
+}
+
+func (p *Policy) checkDomain(host string) error {
+	if matchDomain(host, p.deny) {
+		return invalid(CodeDomainDenied, "domain %q is not allowed", host)
+	}
+	if len(p.allow) > 0 && !matchDomain(host, p.allow) {
+		return invalid(CodeDomainNotAllowed, "domain %q is not in the allow list", host)
+	}
+	return nil
+}
+
+func (p *Policy) checkAddress(ctx context.Context, host string) error {
+	if p.cfg.AllowPrivate {
+		return nil
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if IsPrivate(addr) {
+			return invalid(CodePrivateAddress, "address %s is not allowed", host)
+		}
+		return nil
+	}
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return invalid(CodePrivateAddress, "host %q is not allowed", host)
+	}
+	if p.cfg.SkipResolve {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.ResolveTimeout)
+	defer cancel()
+
+	addrs, err := p.cfg.Resolver.LookupIPAddr(ctx, host)
+	if err != nil || len(addrs) == 0 {
+		return invalid(CodeUnresolvable, "host %q cannot be resolved", host)
+	}
+	for _, a := range addrs {
+		if addr, ok := netip.AddrFromSlice(a.IP); ok && IsPrivate(addr) {
+			return invalid(CodePrivateAddress, "host %q resolves to a private address", host)
+		}
+	}
+	return nil
+}
+
+// parseIPv4Host разбирает IPv4 во всех записях, которые понимают inet_aton и браузеры:
+// 2130706433, 127.1, 0x7f.0.0.1, 0177.0.0.1. Иначе такие хосты выглядели бы именами и
+// обходили запрет приватных адресов.
+func parseIPv4Host(host string) (netip.Addr, bool) {
+	parts := strings.Split(host, ".")
+	if len(parts) > 4 {
+		return netip.Addr{}, false
+	}
+	values := make([]uint64, len(parts))
+	for i, part := range parts {
+		base := 10
+		switch {
+		case strings.HasPrefix(part, "0x"):
+			part, base = part[2:], 16
+			if part == "" {
+				part = "0"
+			}
+		case len(part) > 1 && part[0] == '0':
+			part, base = part[1:], 8
+		}
+		v, err := strconv.ParseUint(part, base, 32)
+		if err != nil {
+			return netip.Addr{}, false
+		}
+		values[i] = v
+	}
+
+	// Все части, кроме последней, — отдельные байты; последняя занимает оставшиеся
+	var ip uint64
+	for i, v := range values[:len(values)-1] {
+		if v > 0xff {
+			return netip.Addr{}, false
+		}
+		ip |= v << (8 * (3 - i))
+	}
+	last := values[len(values)-1]
+	if last >= 1<<(8*(5-len(values))) {
+		return netip.Addr{}, false
+	}
+	ip |= last
+	return netip.AddrFrom4([4]byte{byte(ip >> 24), byte(ip >> 16), byte(ip >> 8), byte(ip)}), true
+}
+
+// IsPrivate сообщает, что адрес не должен быть доступен извне: loopback, приватные сети,
+// link-local (в т.ч. 169.254.169.254), CGNAT, multicast и unspecified
+func IsPrivate(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() ||
+		cgnat.Contains(addr)
+}
+
+var cgnat = netip.MustParsePrefix("100.64.0.0/10")
+
+// DenyPrivateControl — Control для net.Dialer, который не даёт подключиться к приватному
+// адресу уже после резолва имени, поэтому подмена DNS между проверкой URL и запросом не помогает
+func DenyPrivateControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if IsPrivate(addrPort.Addr()) {
+		return invalid(CodePrivateAddress, "connection to %s is not allowed", addrPort.Addr())
+	}
+	return nil
+}
+
+// LoadDomainList читает список доменов из файла: по одному на строку, # — комментарий
+func LoadDomainList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var domains []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			domains = append(domains, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read domain list %s: %w", path, err)
+	}
+	return domains, nil
+}
+
+func normalizeDomains(domains []string) []string {
+	result := make([]string, 0, len(domains))
+	for _, d := range domains {
+		d = strings.Trim(strings.ToLower(strings.TrimSpace(d)), ".")
+		if ascii, err := idna.Lookup.ToASCII(d); err == nil {
+			d = ascii
+		}
+		if d != "" {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+func matchDomain(host string, domains []string) bool {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func invalid(code, format string, args ...interface{}) *ValidationError {
+	return &ValidationError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
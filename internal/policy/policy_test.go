@@ -0,0 +1,164 @@
+package policy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakeResolver map[string][]string
+
+func (f fakeResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	ips, ok := f[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+	var addrs []net.IPAddr
+	for _, ip := range ips {
+		addrs = append(addrs, net.IPAddr{IP: net.ParseIP(ip)})
+	}
+	return addrs, nil
+}
+
+func TestCheck_Rejects(t *testing.T) {
+	ctx := context.Background()
+	p := New(Config{DenyDomains: []string{"evil.com"}})
+
+	cases := map[string]string{
+		"javascript:alert(1)":    CodeSchemeNotAllowed,
+		"file:///etc/passwd":     CodeSchemeNotAllowed,
+		"data:text/html,hi":      CodeSchemeNotAllowed,
+		"not-a-url":              CodeSchemeNotAllowed,
+		"http://":                CodeMissingHost,
+		"http://127.0.0.1/admin": CodePrivateAddress,
+		"http://169.254.169.254/latest/meta-data": CodePrivateAddress,
+		"http://[::1]:8080/":                      CodePrivateAddress,
+		"http://10.0.0.5/":                        CodePrivateAddress,
+		"http://localhost:8080/abc123":            CodePrivateAddress,
+		"https://sub.evil.com/path":               CodeDomainDenied,
+		"https://" + strings.Repeat("a", 2100):    CodeTooLong,
+	}
+	for raw, code := range cases {
+		_, err := p.Check(ctx, raw)
+		var verr *ValidationError
+		if !errors.As(err, &verr) || verr.Code != code {
+			t.Errorf("%s: expected %s, got %v", raw, code, err)
+		}
+	}
+}
+
+func TestCheck_NormalizesHost(t *testing.T) {
+	ctx := context.Background()
+	p := New(Config{SkipResolve: true})
+
+	got, err := p.Check(ctx, "HTTPS://Пример.РФ/Path?q=1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got != "https://xn--e1afmkfd.xn--p1ai/Path?q=1" {
+		t.Fatalf("unexpected normalized url: %s", got)
+	}
+}
+
+func TestCheck_AllowList(t *testing.T) {
+	ctx := context.Background()
+	p := New(Config{SkipResolve: true, AllowDomains: []string{"example.com"}})
+
+	if _, err := p.Check(ctx, "https://docs.example.com/x"); err != nil {
+		t.Fatalf("expected subdomain to be allowed: %v", err)
+	}
+	if _, err := p.Check(ctx, "https://example.org/"); err == nil {
+		t.Fatalf("expected domain outside allow list to be rejected")
+	}
+}
+
+func TestCheck_ResolvesHosts(t *testing.T) {
+	ctx := context.Background()
+	p := New(Config{Resolver: fakeResolver{
+		"public.example":   {"93.184.216.34"},
+		"internal.example": {"93.184.216.34", "192.168.1.10"},
+	}})
+
+	if _, err := p.Check(ctx, "https://public.example/"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var verr *ValidationError
+	if _, err := p.Check(ctx, "https://internal.example/"); !errors.As(err, &verr) || verr.Code != CodePrivateAddress {
+		t.Fatalf("expected private address error, got %v", err)
+	}
+	if _, err := p.Check(ctx, "https://missing.example/"); !errors.As(err, &verr) || verr.Code != CodeUnresolvable {
+		t.Fatalf("expected unresolvable error, got %v", err)
+	}
+
+	skip := New(Config{SkipResolve: true, Resolver: fakeResolver{}})
+	if _, err := skip.Check(ctx, "https://internal.example/"); err != nil {
+		t.Fatalf("expected names not resolved with SkipResolve, got %v", err)
+	}
+}
+
+func TestCheck_NumericIPv4(t *testing.T) {
+	ctx := context.Background()
+	p := New(Config{SkipResolve: true})
+
+	for _, raw := range []string{
+		"http://2130706433/",
+		"http://127.1/",
+		"http://0x7f.0.0.1/",
+		"http://0177.0.0.1/",
+		"http://0xa9.254.43518/",
+		"http://0/",
+	} {
+		var verr *ValidationError
+		if _, err := p.Check(ctx, raw); !errors.As(err, &verr) || verr.Code != CodePrivateAddress {
+			t.Errorf("%s: expected private address error, got %v", raw, err)
+		}
+	}
+
+	got, err := p.Check(ctx, "http://0x5d.0xb8.0xd8.0x22:8080/x")
+	if err != nil || got != "http://93.184.216.34:8080/x" {
+		t.Fatalf("expected normalized address, got %q, %v", got, err)
+	}
+	if _, err := p.Check(ctx, "http://123.example/"); err != nil {
+		t.Fatalf("names with numeric labels are not addresses: %v", err)
+	}
+}
+
+type blockingResolver struct{}
+
+func (blockingResolver) LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestCheck_ResolveUsesContext(t *testing.T) {
+	p := New(Config{ResolveTimeout: time.Hour, Resolver: blockingResolver{}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var verr *ValidationError
+	if _, err := p.Check(ctx, "https://public.example/"); !errors.As(err, &verr) || verr.Code != CodeUnresolvable {
+		t.Fatalf("expected cancelled lookup, got %v", err)
+	}
+}
+
+func TestLoadDomainList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deny.txt")
+	content := "# phishing\nevil.com\n\n  bad.example  # trailing comment\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	domains, err := LoadDomainList(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(domains) != 2 || domains[0] != "evil.com" || domains[1] != "bad.example" {
+		t.Fatalf("unexpected domains: %v", domains)
+	}
+}
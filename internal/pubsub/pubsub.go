@@ -0,0 +1,108 @@
+package pubsub
+
+import (
+	"sync"
+	"sync/atomic"
+	"urlcutter/internal/models"
+)
+
+const defaultBuffer = 64
+
+// Broker раздаёт события переходов подписчикам внутри процесса. Publish никогда не
+// блокирует редирект: подписчик, буфер которого заполнен, отключается.
+type Broker struct {
+	buffer int
+
+	mu     sync.RWMutex
+	topics map[string]map[*Subscription]struct{}
+}
+
+// Subscription — подписка на одну тему. Events закрывается после Close или
+// при отключении медленного подписчика.
+type Subscription struct {
+	Events <-chan models.ClickEvent
+
+	events chan models.ClickEvent
+	topic  string
+	broker *Broker
+	closed bool
+	slow   atomic.Bool
+}
+
+// NewBroker создаёт брокер, в котором у каждого подписчика буфер на buffer событий
+func NewBroker(buffer int) *Broker {
+	if buffer <= 0 {
+		buffer = defaultBuffer
+	}
+	return &Broker{buffer: buffer, topics: make(map[string]map[*Subscription]struct{})}
+}
+
+func (b *Broker) Subscribe(topic string) *Subscription {
+	events := make(chan models.ClickEvent, b.buffer)
+	sub := &Subscription{Events: events, events: events, topic: topic, broker: b}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs, ok := b.topics[topic]
+	if !ok {
+		subs = make(map[*Subscription]struct{})
+		b.topics[topic] = subs
+	}
+	subs[sub] = struct{}{}
+	return sub
+}
+
+// Publish отправляет событие подписчикам темы, не дожидаясь их
+func (b *Broker) Publish(topic string, event models.ClickEvent) {
+	var slow []*Subscription
+
+	b.mu.RLock()
+	for sub := range b.topics[topic] {
+		select {
+		case sub.events <- event:
+		default:
+			slow = append(slow, sub)
+		}
+	}
+	b.mu.RUnlock()
+
+	for _, sub := range slow {
+		sub.slow.Store(true)
+		b.remove(sub)
+	}
+}
+
+// Subscribers возвращает число подписчиков темы
+func (b *Broker) Subscribers(topic string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.topics[topic])
+}
+
+// remove отписывает и закрывает канал. Канал закрывается под блокировкой записи, поэтому
+// Publish не может отправить в закрытый канал.
+func (b *Broker) remove(sub *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if sub.closed {
+		return
+	}
+	sub.closed = true
+	close(sub.events)
+
+	subs := b.topics[sub.topic]
+	delete(subs, sub)
+	if len(subs) == 0 {
+		delete(b.topics, sub.topic)
+	}
+}
+
+// Close отписывает подписчика; повторный вызов ничего не делает
+func (s *Subscription) Close() {
+	s.broker.remove(s)
+}
+
+// Slow сообщает, что подписка закрыта брокером из-за переполнения буфера
+func (s *Subscription) Slow() bool {
+	return s.slow.Load()
+}
@@ -0,0 +1,75 @@
+package pubsub
+
+import (
+	"sync"
+	"testing"
+	"urlcutter/internal/models"
+)
+
+func TestPublish(t *testing.T) {
+	b := NewBroker(4)
+	a1, a2 := b.Subscribe("a"), b.Subscribe("a")
+	other := b.Subscribe("b")
+
+	b.Publish("a", models.ClickEvent{Short: "abc123"})
+
+	for _, sub := range []*Subscription{a1, a2} {
+		if event := <-sub.Events; event.Short != "abc123" {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	}
+	select {
+	case event := <-other.Events:
+		t.Fatalf("unexpected event for other topic: %+v", event)
+	default:
+	}
+
+	a1.Close()
+	a1.Close()
+	if _, ok := <-a1.Events; ok {
+		t.Fatalf("expected closed channel")
+	}
+	if n := b.Subscribers("a"); n != 1 {
+		t.Fatalf("expected 1 subscriber, got %d", n)
+	}
+}
+
+func TestPublish_SlowConsumer(t *testing.T) {
+	b := NewBroker(2)
+	slow := b.Subscribe("a")
+	fast := b.Subscribe("a")
+
+	for i := 0; i < 3; i++ {
+		b.Publish("a", models.ClickEvent{Short: "abc123"})
+		<-fast.Events
+	}
+
+	received := 0
+	for range slow.Events {
+		received++
+	}
+	if received != 2 || !slow.Slow() {
+		t.Fatalf("expected slow subscriber disconnected after buffer, got %d events, slow=%v", received, slow.Slow())
+	}
+	if fast.Slow() || b.Subscribers("a") != 1 {
+		t.Fatalf("fast subscriber must stay subscribed")
+	}
+}
+
+func TestPublish_ConcurrentClose(t *testing.T) {
+	b := NewBroker(1)
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		sub := b.Subscribe("a")
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			b.Publish("a", models.ClickEvent{})
+		}()
+		go func() {
+			defer wg.Done()
+			sub.Close()
+		}()
+	}
+	wg.Wait()
+}
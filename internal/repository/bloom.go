@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+	"urlcutter/internal/models"
+	"urlcutter/pkg/bloom"
+)
+
+const (
+	defaultBloomCodes = 1000000
+	defaultBloomRate  = 0.01
+	// bloomSyncOverlap — насколько раньше последнего виденного кода начинается следующая
+	// синхронизация: покрывает долгие транзакции, закоммиченные позже более новых
+	bloomSyncOverlap = time.Minute
+	// defaultBloomRecheck — как часто промах может запускать внеочередную синхронизацию
+	defaultBloomRecheck = time.Second
+)
+
+type BloomConfig struct {
+	// ExpectedCodes — на сколько кодов рассчитан фильтр; если кодов больше, растёт доля
+	// ложных срабатываний, и их проверяет хранилище
+	ExpectedCodes     int
+	FalsePositiveRate float64
+	// SyncInterval — как часто подтягивать коды, созданные другими экземплярами.
+	// 0 — ссылки создаёт только этот экземпляр, и промах фильтра окончателен.
+	SyncInterval time.Duration
+	// RecheckInterval — при SyncInterval промах запускает внеочередную синхронизацию, но
+	// не чаще раза в RecheckInterval (по умолчанию секунда): код, только что созданный
+	// другим экземпляром, находится почти сразу, а остальные промахи отвечает фильтр
+	RecheckInterval time.Duration
+}
+
+// BloomStats — счётчики фильтра с момента создания
+type BloomStats struct {
+	// Rejected — поиски, на которые фильтр ответил «нет» без чтения ссылки
+	Rejected uint64 `json:"rejected"`
+	Passed   uint64 `json:"passed"`
+	// Checked — внеочередные синхронизации, запущенные промахом (только при SyncInterval)
+	Checked uint64 `json:"checked"`
+	// Added — сколько различных кодов попало в фильтр
+	Added uint64 `json:"added"`
+	// FalsePositiveRate — оценка текущей доли ложных срабатываний
+	FalsePositiveRate float64 `json:"false_positive_rate"`
+}
+
+// BloomRepository отвечает «не найдено» на поиск кодов, которых точно нет, не читая
+// ссылку из хранилища. Фильтр строится из всех кодов при создании и пополняется при
+// Create; коды, созданные другими экземплярами, подтягивает Sync.
+type BloomRepository struct {
+	Repository
+
+	filter *bloom.Filter
+	// shared — ссылки создают и другие экземпляры, промах может досинхронизировать фильтр
+	shared  bool
+	recheck time.Duration
+	stop    func()
+	// rechecked — время последней внеочередной синхронизации в наносекундах
+	rechecked atomic.Int64
+
+	mu     sync.Mutex
+	synced time.Time
+
+	rejected, passed, checked atomic.Uint64
+}
+
+// NewBloomRepository загружает коды всех ссылок из repo и, если задан SyncInterval,
+// запускает синхронизацию; её останавливает Close
+func NewBloomRepository(repo Repository, cfg BloomConfig) (*BloomRepository, error) {
+	if cfg.ExpectedCodes == 0 {
+		cfg.ExpectedCodes = defaultBloomCodes
+	}
+	if cfg.FalsePositiveRate == 0 {
+		cfg.FalsePositiveRate = defaultBloomRate
+	}
+	if cfg.RecheckInterval == 0 {
+		cfg.RecheckInterval = defaultBloomRecheck
+	}
+	b := &BloomRepository{
+		Repository: repo,
+		filter:     bloom.New(cfg.ExpectedCodes, cfg.FalsePositiveRate),
+		shared:     cfg.SyncInterval > 0,
+		recheck:    cfg.RecheckInterval,
+		stop:       func() {},
+	}
+	if err := b.Sync(context.Background()); err != nil {
+		return nil, err
+	}
+	if b.shared {
+		b.stop = b.Watch(cfg.SyncInterval)
+	}
+	return b, nil
+}
+
+// Close останавливает синхронизацию, запущенную NewBloomRepository
+func (b *BloomRepository) Close() {
+	b.stop()
+}
+
+func (b *BloomRepository) FindByShort(ctx context.Context, domain, short string) (*models.URL, error) {
+	key := bloomKey(domain, short)
+	if !b.filter.Test(key) && !(b.shared && b.resync(ctx, key)) {
+		b.rejected.Add(1)
+		return nil, nil
+	}
+	b.passed.Add(1)
+	return b.Repository.FindByShort(ctx, domain, short)
+}
+
+// resync подтягивает коды, созданные после последней синхронизации, если с прошлой
+// внеочередной синхронизации прошло не меньше recheck, и снова проверяет key. Поток
+// случайных кодов стоит хранилищу одного лёгкого запроса за интервал, а не запроса на
+// каждый промах.
+func (b *BloomRepository) resync(ctx context.Context, key string) bool {
+	now := time.Now().UnixNano()
+	last := b.rechecked.Load()
+	if now-last < int64(b.recheck) || !b.rechecked.CompareAndSwap(last, now) {
+		return false
+	}
+	b.checked.Add(1)
+	if err := b.Sync(ctx); err != nil {
+		log.Printf("Failed to sync code filter: %v", err)
+		return false
+	}
+	return b.filter.Test(key)
+}
+
+// Create добавляет код в фильтр до вставки: так ссылка находится сразу после записи,
+// а неудавшаяся вставка даёт лишь ложное срабатывание
+func (b *BloomRepository) Create(ctx context.Context, url *models.URL, events ...*models.WebhookEvent) error {
+	b.filter.Add(bloomKey(url.Domain, url.Short))
+	return b.Repository.Create(ctx, url, events...)
+}
+
+// Sync добавляет в фильтр коды, созданные после прошлой синхронизации
+func (b *BloomRepository) Sync(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	since := time.Time{}
+	if !b.synced.IsZero() {
+		since = b.synced.Add(-bloomSyncOverlap)
+	}
+	latest := b.synced
+	err := b.Repository.ScanCodes(ctx, since, func(domain, short string, insertedAt time.Time) {
+		b.filter.Add(bloomKey(domain, short))
+		if insertedAt.After(latest) {
+			latest = insertedAt
+		}
+	})
+	if err != nil {
+		return err
+	}
+	b.synced = latest
+	return nil
+}
+
+// Watch вызывает Sync каждые interval, пока не вызван stop. NewBloomRepository запускает
+// его сам при заданном SyncInterval.
+func (b *BloomRepository) Watch(interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := b.Sync(ctx); err != nil {
+					log.Printf("Failed to sync code filter: %v", err)
+				}
+			}
+		}
+	}()
+	return cancel
+}
+
+func (b *BloomRepository) Stats() BloomStats {
+	return BloomStats{
+		Rejected:          b.rejected.Load(),
+		Passed:            b.passed.Load(),
+		Checked:           b.checked.Load(),
+		Added:             b.filter.Added(),
+		FalsePositiveRate: b.filter.FalsePositiveRate(),
+	}
+}
+
+func bloomKey(domain, short string) string {
+	return domain + "/" + short
+}
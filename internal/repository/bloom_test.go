@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+	"urlcutter/internal/models"
+)
+
+func TestBloomRepository(t *testing.T) {
+	ctx := context.Background()
+	stub := newStubRepository()
+	created := time.Now().Add(-time.Hour)
+	_ = stub.Create(ctx, &models.URL{Short: "abc123", CreatedAt: created})
+	_ = stub.Create(ctx, &models.URL{Short: "abc123", Domain: "go.brand.example", CreatedAt: created})
+
+	b, err := NewBloomRepository(stub, BloomConfig{ExpectedCodes: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if url, _ := b.FindByShort(ctx, "go.brand.example", "abc123"); url == nil {
+		t.Fatalf("expected existing link")
+	}
+	for _, short := range []string{"zzz999", "yyy888", "xxx777"} {
+		if url, _ := b.FindByShort(ctx, "", short); url != nil {
+			t.Fatalf("unexpected link %s", short)
+		}
+	}
+	if stub.finds != 1 || b.Stats().Rejected != 3 {
+		t.Fatalf("expected misses answered by filter, got %d lookups, stats %+v", stub.finds, b.Stats())
+	}
+
+	_ = b.Create(ctx, &models.URL{Short: "new111", CreatedAt: time.Now()})
+	if url, _ := b.FindByShort(ctx, "", "new111"); url == nil {
+		t.Fatalf("expected created link to be found")
+	}
+
+	// Ссылки, созданные другими экземплярами в обход фильтра; часы второго отстают на два часа
+	_ = stub.Create(ctx, &models.URL{Short: "peer11", CreatedAt: time.Now()})
+	_ = stub.Create(ctx, &models.URL{Short: "peer22", CreatedAt: time.Now().Add(-2 * time.Hour)})
+	if url, _ := b.FindByShort(ctx, "", "peer11"); url != nil {
+		t.Fatalf("expected unknown code before sync")
+	}
+	if err := b.Sync(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, short := range []string{"peer11", "peer22"} {
+		if url, _ := b.FindByShort(ctx, "", short); url == nil {
+			t.Fatalf("expected code %s from sync to be found", short)
+		}
+	}
+	if stub.scans != 2 {
+		t.Fatalf("expected initial load and one sync, got %d scans", stub.scans)
+	}
+}
+
+func TestBloomRepository_Shared(t *testing.T) {
+	ctx := context.Background()
+	stub := newStubRepository()
+	_ = stub.Create(ctx, &models.URL{Short: "abc123", CreatedAt: time.Now()})
+
+	b, err := NewBloomRepository(stub, BloomConfig{ExpectedCodes: 1000, SyncInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	// Код другого экземпляра находится до ближайшей синхронизации: промах досинхронизирует фильтр
+	_ = stub.Create(ctx, &models.URL{Short: "peer11", CreatedAt: time.Now()})
+	if url, _ := b.FindByShort(ctx, "", "peer11"); url == nil {
+		t.Fatalf("expected code created by another instance to be found")
+	}
+	// Следующие промахи в пределах RecheckInterval хранилище не трогают
+	for _, short := range []string{"zzz999", "yyy888"} {
+		if url, _ := b.FindByShort(ctx, "", short); url != nil {
+			t.Fatalf("unexpected link %s", short)
+		}
+	}
+	if stats := b.Stats(); stub.scans != 2 || stub.finds != 1 || stats.Checked != 1 || stats.Rejected != 2 {
+		t.Fatalf("expected one resync for all misses, got %d scans, %d lookups, stats %+v", stub.scans, stub.finds, stats)
+	}
+
+	b.rechecked.Store(0)
+	if url, _ := b.FindByShort(ctx, "", "zzz999"); url != nil || stub.scans != 3 {
+		t.Fatalf("expected resync after the interval, got %d scans", stub.scans)
+	}
+	if added := b.Stats().Added; added != 2 {
+		t.Fatalf("expected re-scanned codes not to be counted, got %d", added)
+	}
+}
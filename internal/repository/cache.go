@@ -0,0 +1,388 @@
+package repository
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+	"urlcutter/internal/models"
+)
+
+const (
+	defaultCacheSize        = 10000
+	defaultCacheTTL         = time.Minute
+	defaultCacheNegativeTTL = 10 * time.Second
+)
+
+type CacheConfig struct {
+	// Size — сколько ссылок, доменов и UTM-меток владельцев хранится в кеше; при
+	// переполнении вытесняются те, что дольше всего не читались
+	Size int
+	// TTL ограничивает, сколько экземпляр может не замечать изменений, сделанных другими
+	// экземплярами; свои изменения сбрасывают кеш сразу
+	TTL time.Duration
+	// NegativeTTL — сколько помнится отсутствие ссылки или домена
+	NegativeTTL time.Duration
+}
+
+// CacheStats — счётчики кеша с момента создания
+type CacheStats struct {
+	Hits uint64 `json:"hits"`
+	// NegativeHits — попадания в запомненное отсутствие, входят в Hits
+	NegativeHits uint64 `json:"negative_hits"`
+	Misses       uint64 `json:"misses"`
+	Evictions    uint64 `json:"evictions"`
+	Links        int    `json:"links"`
+	Domains      int    `json:"domains"`
+	UTMDefaults  int    `json:"utm_defaults"`
+}
+
+// CachedRepository кеширует в памяти поиск ссылок, доменов и UTM-меток владельцев, которые
+// читаются при каждом редиректе.
+// Остальные методы передаются в repo; методы, меняющие ссылку, сбрасывают её из кеша.
+type CachedRepository struct {
+	Repository
+
+	cfg     CacheConfig
+	links   *lru[models.URL]
+	domains *lru[models.Domain]
+	utm     *lru[models.UTM]
+	now     func() time.Time
+
+	hits, negativeHits, misses, evictions atomic.Uint64
+}
+
+func NewCachedRepository(repo Repository, cfg CacheConfig) *CachedRepository {
+	if cfg.Size == 0 {
+		cfg.Size = defaultCacheSize
+	}
+	if cfg.TTL == 0 {
+		cfg.TTL = defaultCacheTTL
+	}
+	if cfg.NegativeTTL == 0 {
+		cfg.NegativeTTL = defaultCacheNegativeTTL
+	}
+	return &CachedRepository{
+		Repository: repo,
+		cfg:        cfg,
+		links:      newLRU(cfg.Size, cloneURL),
+		domains:    newLRU(cfg.Size, clone[models.Domain]),
+		utm:        newLRU(cfg.Size, clone[models.UTM]),
+		now:        time.Now,
+	}
+}
+
+func (c *CachedRepository) FindByShort(ctx context.Context, domain, short string) (*models.URL, error) {
+	key := domain + "/" + short
+	if url, ok := c.links.get(key, c.now()); ok {
+		c.hit(url == nil)
+		return url, nil
+	}
+	c.misses.Add(1)
+
+	gen := c.links.begin(key)
+	url, err := c.Repository.FindByShort(ctx, domain, short)
+	if err != nil {
+		c.links.abort(key)
+		return nil, err
+	}
+	store(c, c.links, key, url, gen)
+	return url, nil
+}
+
+func (c *CachedRepository) FindDomain(ctx context.Context, host string) (*models.Domain, error) {
+	if domain, ok := c.domains.get(host, c.now()); ok {
+		c.hit(domain == nil)
+		return domain, nil
+	}
+	c.misses.Add(1)
+
+	gen := c.domains.begin(host)
+	domain, err := c.Repository.FindDomain(ctx, host)
+	if err != nil {
+		c.domains.abort(host)
+		return nil, err
+	}
+	store(c, c.domains, host, domain, gen)
+	return domain, nil
+}
+
+func (c *CachedRepository) GetUTMDefaults(ctx context.Context, owner string) (*models.UTM, error) {
+	if utm, ok := c.utm.get(owner, c.now()); ok && utm != nil {
+		c.hit(false)
+		return utm, nil
+	}
+	c.misses.Add(1)
+
+	gen := c.utm.begin(owner)
+	utm, err := c.Repository.GetUTMDefaults(ctx, owner)
+	if err != nil {
+		c.utm.abort(owner)
+		return nil, err
+	}
+	store(c, c.utm, owner, utm, gen)
+	return utm, nil
+}
+
+func (c *CachedRepository) SetUTMDefaults(ctx context.Context, owner string, utm *models.UTM) error {
+	defer c.utm.remove(owner)
+	return c.Repository.SetUTMDefaults(ctx, owner, utm)
+}
+
+func (c *CachedRepository) Create(ctx context.Context, url *models.URL, events ...*models.WebhookEvent) error {
+	// Запомненное отсутствие кода сбрасывается после вставки, иначе новая ссылка
+	// не открывалась бы до конца NegativeTTL
+	defer c.links.remove(url.Domain + "/" + url.Short)
+	return c.Repository.Create(ctx, url, events...)
+}
+
+// IncrementClicks обновляет счётчик и в кешированной копии, чтобы частые переходы
+// не сбрасывали кеш
+func (c *CachedRepository) IncrementClicks(ctx context.Context, domain, short string) (int, error) {
+	clicks, err := c.Repository.IncrementClicks(ctx, domain, short)
+	if err != nil {
+		return 0, err
+	}
+	c.links.update(domain+"/"+short, func(url *models.URL) {
+		url.Clicks = clicks
+	})
+	return clicks, nil
+}
+
+func (c *CachedRepository) Disable(ctx context.Context, domain, short, reason string, events ...*models.WebhookEvent) error {
+	defer c.links.remove(domain + "/" + short)
+	return c.Repository.Disable(ctx, domain, short, reason, events...)
+}
+
+func (c *CachedRepository) UpdateMetadata(ctx context.Context, domain, short string, meta *models.LinkMetadata, events ...*models.WebhookEvent) error {
+	defer c.links.remove(domain + "/" + short)
+	return c.Repository.UpdateMetadata(ctx, domain, short, meta, events...)
+}
+
+func (c *CachedRepository) RecordHealthCheck(ctx context.Context, check *models.HealthCheck) error {
+	defer c.links.remove(check.Domain + "/" + check.Short)
+	return c.Repository.RecordHealthCheck(ctx, check)
+}
+
+func (c *CachedRepository) CreateDomain(ctx context.Context, domain *models.Domain) error {
+	defer c.domains.remove(domain.Host)
+	return c.Repository.CreateDomain(ctx, domain)
+}
+
+// Stats возвращает счётчики попаданий и промахов
+func (c *CachedRepository) Stats() CacheStats {
+	return CacheStats{
+		Hits:         c.hits.Load(),
+		NegativeHits: c.negativeHits.Load(),
+		Misses:       c.misses.Load(),
+		Evictions:    c.evictions.Load(),
+		Links:        c.links.len(),
+		Domains:      c.domains.len(),
+		UTMDefaults:  c.utm.len(),
+	}
+}
+
+func (c *CachedRepository) hit(negative bool) {
+	c.hits.Add(1)
+	if negative {
+		c.negativeHits.Add(1)
+	}
+}
+
+// store запоминает найденное значение на TTL, а отсутствие (nil) — на NegativeTTL.
+// Значение, прочитанное до сброса ключа (gen устарел), не сохраняется.
+func store[T any](c *CachedRepository, cache *lru[T], key string, value *T, gen uint64) {
+	ttl := c.cfg.TTL
+	if value == nil {
+		ttl = c.cfg.NegativeTTL
+	}
+	if cache.setFetched(key, value, c.now().Add(ttl), gen) {
+		c.evictions.Add(1)
+	}
+}
+
+// lru — кеш с вытеснением давно не читанных записей и сроком жизни записи. Значения
+// копируются функцией copy при записи и чтении, поэтому вызывающий может менять
+// полученную копию; nil хранится как запомненное отсутствие.
+type lru[T any] struct {
+	mu    sync.Mutex
+	size  int
+	copy  func(*T) *T
+	order *list.List
+	items map[string]*list.Element
+	// fetches — ключи, которые сейчас читаются из хранилища. remove увеличивает их
+	// поколение, и прочитанное до сброса значение не попадает в кеш.
+	fetches map[string]*lruFetch
+}
+
+type lruFetch struct {
+	gen     uint64
+	readers int
+}
+
+type lruEntry[T any] struct {
+	key     string
+	value   *T
+	expires time.Time
+}
+
+func newLRU[T any](size int, copy func(*T) *T) *lru[T] {
+	return &lru[T]{
+		size:    size,
+		copy:    copy,
+		order:   list.New(),
+		items:   make(map[string]*list.Element),
+		fetches: make(map[string]*lruFetch),
+	}
+}
+
+func (c *lru[T]) get(key string, now time.Time) (*T, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	entry := el.Value.(*lruEntry[T])
+	if !now.Before(entry.expires) {
+		c.order.Remove(el)
+		delete(c.items, key)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return c.copy(entry.value), true
+}
+
+// begin отмечает начало чтения key из хранилища и возвращает поколение ключа для
+// setFetched; чтение, закончившееся ошибкой, завершает abort
+func (c *lru[T]) begin(key string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fetch, ok := c.fetches[key]
+	if !ok {
+		fetch = &lruFetch{}
+		c.fetches[key] = fetch
+	}
+	fetch.readers++
+	return fetch.gen
+}
+
+func (c *lru[T]) abort(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.finish(key)
+}
+
+// setFetched завершает чтение, начатое begin, и сохраняет значение, если ключ не
+// сбрасывался с тех пор. Сообщает, пришлось ли вытеснить другую запись.
+func (c *lru[T]) setFetched(key string, value *T, expires time.Time, gen uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.finish(key) != gen {
+		return false
+	}
+	return c.set(key, value, expires)
+}
+
+// finish уменьшает число читающих key и возвращает его текущее поколение; вызывается под mu
+func (c *lru[T]) finish(key string) uint64 {
+	fetch, ok := c.fetches[key]
+	if !ok {
+		return 0
+	}
+	if fetch.readers--; fetch.readers == 0 {
+		delete(c.fetches, key)
+	}
+	return fetch.gen
+}
+
+// set сохраняет запись и сообщает, пришлось ли вытеснить другую; вызывается под mu
+func (c *lru[T]) set(key string, value *T, expires time.Time) bool {
+	if el, ok := c.items[key]; ok {
+		entry := el.Value.(*lruEntry[T])
+		entry.value, entry.expires = c.copy(value), expires
+		c.order.MoveToFront(el)
+		return false
+	}
+
+	c.items[key] = c.order.PushFront(&lruEntry[T]{key: key, value: c.copy(value), expires: expires})
+	if c.order.Len() <= c.size {
+		return false
+	}
+	oldest := c.order.Back()
+	c.order.Remove(oldest)
+	delete(c.items, oldest.Value.(*lruEntry[T]).key)
+	return true
+}
+
+// update меняет сохранённое значение на месте, если оно есть
+func (c *lru[T]) update(key string, fn func(*T)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok && el.Value.(*lruEntry[T]).value != nil {
+		fn(el.Value.(*lruEntry[T]).value)
+	}
+}
+
+func (c *lru[T]) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if fetch, ok := c.fetches[key]; ok {
+		fetch.gen++
+	}
+	if el, ok := c.items[key]; ok {
+		c.order.Remove(el)
+		delete(c.items, key)
+	}
+}
+
+func (c *lru[T]) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// clone копирует значения без ссылочных полей
+func clone[T any](value *T) *T {
+	if value == nil {
+		return nil
+	}
+	copied := *value
+	return &copied
+}
+
+// cloneURL копирует ссылку вместе с правилами, вариантами, окном активности, метаданными
+// и последней проверкой, чтобы изменения копии не доходили до кеша
+func cloneURL(url *models.URL) *models.URL {
+	if url == nil {
+		return nil
+	}
+	copied := *url
+	if url.Rules != nil {
+		copied.Rules = make([]models.TargetingRule, len(url.Rules))
+		for i, rule := range url.Rules {
+			rule.OS = cloneStrings(rule.OS)
+			rule.Device = cloneStrings(rule.Device)
+			rule.Language = cloneStrings(rule.Language)
+			rule.Country = cloneStrings(rule.Country)
+			rule.Weekdays = cloneStrings(rule.Weekdays)
+			copied.Rules[i] = rule
+		}
+	}
+	if url.Variants != nil {
+		copied.Variants = append([]models.Variant(nil), url.Variants...)
+	}
+	copied.NotBefore = clone(url.NotBefore)
+	copied.NotAfter = clone(url.NotAfter)
+	copied.Metadata.FetchedAt = clone(url.Metadata.FetchedAt)
+	copied.Health = clone(url.Health)
+	return &copied
+}
+
+func cloneStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string(nil), values...)
+}
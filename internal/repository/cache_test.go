@@ -0,0 +1,249 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+	"urlcutter/internal/models"
+)
+
+// stubRepository считает обращения к хранилищу; остальные методы не нужны тестам кеша
+type stubRepository struct {
+	Repository
+	links   map[string]*models.URL
+	domains map[string]*models.Domain
+	utm     map[string]*models.UTM
+	// inserted — время записи по «часам базы», в отличие от CreatedAt
+	inserted map[string]time.Time
+	finds    int
+	scans    int
+	// onFind вызывается посреди FindByShort, после чтения ссылки
+	onFind func()
+}
+
+func newStubRepository() *stubRepository {
+	return &stubRepository{
+		links:    make(map[string]*models.URL),
+		domains:  make(map[string]*models.Domain),
+		utm:      make(map[string]*models.UTM),
+		inserted: make(map[string]time.Time),
+	}
+}
+
+func (s *stubRepository) FindByShort(ctx context.Context, domain, short string) (*models.URL, error) {
+	s.finds++
+	url, ok := s.links[domain+"/"+short]
+	if ok {
+		copied := *url
+		url = &copied
+	}
+	if s.onFind != nil {
+		s.onFind()
+	}
+	return url, nil
+}
+
+func (s *stubRepository) FindDomain(ctx context.Context, host string) (*models.Domain, error) {
+	s.finds++
+	return s.domains[host], nil
+}
+
+func (s *stubRepository) Create(ctx context.Context, url *models.URL, events ...*models.WebhookEvent) error {
+	s.links[url.Domain+"/"+url.Short] = url
+	s.inserted[url.Domain+"/"+url.Short] = time.Now()
+	return nil
+}
+
+func (s *stubRepository) ScanCodes(ctx context.Context, since time.Time, visit func(domain, short string, insertedAt time.Time)) error {
+	s.scans++
+	for key, url := range s.links {
+		if inserted := s.inserted[key]; !inserted.Before(since) {
+			visit(url.Domain, url.Short, inserted)
+		}
+	}
+	return nil
+}
+
+func (s *stubRepository) IncrementClicks(ctx context.Context, domain, short string) (int, error) {
+	s.links[domain+"/"+short].Clicks++
+	return s.links[domain+"/"+short].Clicks, nil
+}
+
+func (s *stubRepository) Disable(ctx context.Context, domain, short, reason string, events ...*models.WebhookEvent) error {
+	s.links[domain+"/"+short].Disabled = true
+	return nil
+}
+
+func (s *stubRepository) GetUTMDefaults(ctx context.Context, owner string) (*models.UTM, error) {
+	s.finds++
+	if utm, ok := s.utm[owner]; ok {
+		return utm, nil
+	}
+	return &models.UTM{}, nil
+}
+
+func (s *stubRepository) SetUTMDefaults(ctx context.Context, owner string, utm *models.UTM) error {
+	s.utm[owner] = utm
+	return nil
+}
+
+func TestCachedRepository_FindByShort(t *testing.T) {
+	ctx := context.Background()
+	stub := newStubRepository()
+	_ = stub.Create(ctx, &models.URL{Short: "abc123", Original: "https://example.com"})
+	now := time.Now()
+	c := NewCachedRepository(stub, CacheConfig{TTL: time.Minute, NegativeTTL: time.Second})
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		url, err := c.FindByShort(ctx, "", "abc123")
+		if err != nil || url == nil || url.Original != "https://example.com" {
+			t.Fatalf("unexpected result %+v, %v", url, err)
+		}
+		// Изменения копии не должны попадать в кеш
+		url.Original = "changed"
+	}
+	if stub.finds != 1 {
+		t.Fatalf("expected 1 storage lookup, got %d", stub.finds)
+	}
+
+	_, _ = c.IncrementClicks(ctx, "", "abc123")
+	if url, _ := c.FindByShort(ctx, "", "abc123"); url.Clicks != 1 || stub.finds != 1 {
+		t.Fatalf("expected cached clicks to follow increments, got %d after %d lookups", url.Clicks, stub.finds)
+	}
+
+	_ = c.Disable(ctx, "", "abc123", "abuse")
+	if url, _ := c.FindByShort(ctx, "", "abc123"); !url.Disabled || stub.finds != 2 {
+		t.Fatalf("expected disable to invalidate cache")
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, _ = c.FindByShort(ctx, "", "abc123")
+	if stub.finds != 3 {
+		t.Fatalf("expected lookup after TTL, got %d lookups", stub.finds)
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 3 || stats.Misses != 3 || stats.Links != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCachedRepository_DeepCopy(t *testing.T) {
+	ctx := context.Background()
+	stub := newStubRepository()
+	notAfter := time.Now().Add(time.Hour)
+	_ = stub.Create(ctx, &models.URL{Short: "abc123", NotAfter: &notAfter,
+		Rules:    []models.TargetingRule{{URL: "https://example.com/ios", OS: []string{"ios"}}},
+		Variants: []models.Variant{{Name: "a", URL: "https://example.com/a", Weight: 1}}})
+	c := NewCachedRepository(stub, CacheConfig{})
+	_, _ = c.FindByShort(ctx, "", "abc123")
+
+	url, _ := c.FindByShort(ctx, "", "abc123")
+	url.Rules[0].OS[0] = "android"
+	url.Variants[0].Weight = 100
+	*url.NotAfter = notAfter.Add(time.Hour)
+
+	cached, _ := c.FindByShort(ctx, "", "abc123")
+	if cached.Rules[0].OS[0] != "ios" || cached.Variants[0].Weight != 1 || !cached.NotAfter.Equal(notAfter) {
+		t.Fatalf("expected cached link unaffected by caller changes, got %+v", cached)
+	}
+}
+
+func TestCachedRepository_InvalidateDuringFetch(t *testing.T) {
+	ctx := context.Background()
+	stub := newStubRepository()
+	_ = stub.Create(ctx, &models.URL{Short: "abc123"})
+	c := NewCachedRepository(stub, CacheConfig{})
+
+	// Ссылку отключают, пока чтение старой версии ещё не вернулось
+	stub.onFind = func() {
+		stub.onFind = nil
+		_ = c.Disable(ctx, "", "abc123", "spam")
+	}
+	if url, _ := c.FindByShort(ctx, "", "abc123"); url == nil || url.Disabled {
+		t.Fatalf("expected the version read before disabling, got %+v", url)
+	}
+	if url, _ := c.FindByShort(ctx, "", "abc123"); url == nil || !url.Disabled {
+		t.Fatalf("expected stale read not to be cached, got %+v", url)
+	}
+	if stub.finds != 2 || len(c.links.fetches) != 0 {
+		t.Fatalf("expected a second lookup and no pending fetches, got %d lookups, %d fetches", stub.finds, len(c.links.fetches))
+	}
+}
+
+func TestCachedRepository_Negative(t *testing.T) {
+	ctx := context.Background()
+	stub := newStubRepository()
+	now := time.Now()
+	c := NewCachedRepository(stub, CacheConfig{NegativeTTL: time.Second})
+	c.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if url, _ := c.FindByShort(ctx, "", "zzz999"); url != nil {
+			t.Fatalf("expected missing link")
+		}
+	}
+	if stub.finds != 1 || c.Stats().NegativeHits != 1 {
+		t.Fatalf("expected cached miss, got %d lookups, stats %+v", stub.finds, c.Stats())
+	}
+
+	_ = c.Create(ctx, &models.URL{Short: "zzz999", Original: "https://example.com"})
+	if url, _ := c.FindByShort(ctx, "", "zzz999"); url == nil {
+		t.Fatalf("expected created link to be visible immediately")
+	}
+
+	_, _ = c.FindByShort(ctx, "", "other1")
+	now = now.Add(2 * time.Second)
+	_, _ = c.FindByShort(ctx, "", "other1")
+	if stub.finds != 4 {
+		t.Fatalf("expected negative entry to expire, got %d lookups", stub.finds)
+	}
+}
+
+func TestCachedRepository_Eviction(t *testing.T) {
+	ctx := context.Background()
+	stub := newStubRepository()
+	stub.domains["go.brand.example"] = &models.Domain{Host: "go.brand.example"}
+	for _, short := range []string{"aaa111", "bbb222", "ccc333"} {
+		_ = stub.Create(ctx, &models.URL{Short: short})
+	}
+	c := NewCachedRepository(stub, CacheConfig{Size: 2})
+
+	_, _ = c.FindByShort(ctx, "", "aaa111")
+	_, _ = c.FindByShort(ctx, "", "bbb222")
+	_, _ = c.FindByShort(ctx, "", "aaa111")
+	_, _ = c.FindByShort(ctx, "", "ccc333")
+
+	stub.finds = 0
+	_, _ = c.FindByShort(ctx, "", "aaa111")
+	_, _ = c.FindByShort(ctx, "", "bbb222")
+	if stub.finds != 1 || c.Stats().Evictions != 2 {
+		t.Fatalf("expected least recently used link evicted, got %d lookups, stats %+v", stub.finds, c.Stats())
+	}
+
+	_, _ = c.FindDomain(ctx, "go.brand.example")
+	if d, _ := c.FindDomain(ctx, "go.brand.example"); d == nil || stub.finds != 2 {
+		t.Fatalf("expected cached domain, got %+v after %d lookups", d, stub.finds)
+	}
+}
+
+func TestCachedRepository_UTMDefaults(t *testing.T) {
+	ctx := context.Background()
+	stub := newStubRepository()
+	c := NewCachedRepository(stub, CacheConfig{})
+
+	for i := 0; i < 3; i++ {
+		if utm, err := c.GetUTMDefaults(ctx, "acme"); err != nil || *utm != (models.UTM{}) {
+			t.Fatalf("unexpected defaults %+v, %v", utm, err)
+		}
+	}
+	if stub.finds != 1 {
+		t.Fatalf("expected 1 storage lookup, got %d", stub.finds)
+	}
+
+	_ = c.SetUTMDefaults(ctx, "acme", &models.UTM{Source: "mail"})
+	if utm, _ := c.GetUTMDefaults(ctx, "acme"); utm.Source != "mail" || stub.finds != 2 {
+		t.Fatalf("expected defaults reloaded after update, got %+v after %d lookups", utm, stub.finds)
+	}
+}
@@ -1,55 +1,917 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 	"urlcutter/internal/models"
 )
 
+// Repository хранит ссылки и всё, что к ним относится. Create, Disable и UpdateMetadata
+// принимают события вебхуков и кладут их в очередь доставки в одной транзакции с изменением
+// ссылки: событие попадает в очередь тогда и только тогда, когда изменение сохранено.
 type Repository interface {
-	Create(url *models.URL) error
-	FindByShort(short string) (*models.URL, error)
-	FindByOriginal(original string) (*models.URL, error)
-	IncrementClicks(short string) error
+	Create(ctx context.Context, url *models.URL, events ...*models.WebhookEvent) error
+	FindByShort(ctx context.Context, domain, short string) (*models.URL, error)
+	FindDuplicate(ctx context.Context, domain, canonical, original, owner string) (*models.URL, error)
+	// IncrementClicks увеличивает счётчик переходов и возвращает его новое значение
+	IncrementClicks(ctx context.Context, domain, short string) (int, error)
+	CountByOwner(ctx context.Context, owner string, since time.Time) (*models.UsageCounts, error)
+	ListActive(ctx context.Context) ([]*models.URL, error)
+	// ListExpired возвращает неотключённые ссылки, окно которых закончилось к now, а
+	// link.expired ещё не записан
+	ListExpired(ctx context.Context, now time.Time) ([]*models.URL, error)
+	MarkExpiredNotified(ctx context.Context, domain, short string, events ...*models.WebhookEvent) error
+	ScanCodes(ctx context.Context, since time.Time, visit func(domain, short string, insertedAt time.Time)) error
+	Disable(ctx context.Context, domain, short, reason string, events ...*models.WebhookEvent) error
+	UpdateMetadata(ctx context.Context, domain, short string, meta *models.LinkMetadata, events ...*models.WebhookEvent) error
+	RecordHealthCheck(ctx context.Context, check *models.HealthCheck) error
+	// PruneHealthChecks удаляет из истории проверки старше before
+	PruneHealthChecks(ctx context.Context, before time.Time) (int, error)
+	ListBroken(ctx context.Context, owner string) ([]*models.URL, error)
+	HealthHistory(ctx context.Context, domain, short string, limit int) ([]models.HealthCheck, error)
+	GetUTMDefaults(ctx context.Context, owner string) (*models.UTM, error)
+	SetUTMDefaults(ctx context.Context, owner string, utm *models.UTM) error
+	RecordClick(ctx context.Context, event *models.ClickEvent) error
+	VariantStats(ctx context.Context, domain, short string) ([]models.VariantStats, error)
+	CreateDomain(ctx context.Context, domain *models.Domain) error
+	FindDomain(ctx context.Context, host string) (*models.Domain, error)
+	ListDomains(ctx context.Context, owner string) ([]*models.Domain, error)
+	CreateAPIKey(ctx context.Context, key *models.APIKey) error
+	FindAPIKey(ctx context.Context, hash string) (*models.APIKey, error)
+	CreateWebhook(ctx context.Context, webhook *models.Webhook) error
+	FindWebhook(ctx context.Context, owner, id string) (*models.Webhook, error)
+	ListWebhooks(ctx context.Context, owner string) ([]*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, owner, id string) error
+	EnqueueWebhookEvent(ctx context.Context, owner string, event *models.WebhookEvent) error
+	ClaimWebhookMessages(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*models.WebhookMessage, error)
+	RecordWebhookDelivery(ctx context.Context, messageID int64, delivery *models.WebhookDelivery) error
+	WebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error)
+	FillCodePool(ctx context.Context, codes []string) (int, error)
+	CountFreeCodes(ctx context.Context) (int, error)
+	ReserveCodes(ctx context.Context, instance string, n int, now time.Time) ([]string, error)
+	TouchReservedCodes(ctx context.Context, instance string, now time.Time) ([]string, error)
+	ReleaseCodes(ctx context.Context, instance string) error
+	ConsumeCode(ctx context.Context, code string) error
+	ReclaimCodes(ctx context.Context, staleBefore time.Time) (int, error)
+}
+
+const defaultQueryTimeout = 5 * time.Second
+
+// ErrCodeTaken возвращает Create, если код на домене уже занят другой ссылкой
+var ErrCodeTaken = errors.New("short code is already taken")
+
+// errAlreadyNotified откатывает транзакцию MarkExpiredNotified, если ссылку уже отметили
+var errAlreadyNotified = errors.New("expiry already notified")
+
+// defaultOperationTimeouts — запросы, которые проходят по всей таблице
+var defaultOperationTimeouts = map[string]time.Duration{
+	"ListActive":   time.Minute,
+	"ScanCodes":    time.Minute,
+	"FillCodePool": time.Minute,
+}
+
+// Timeouts ограничивает время запросов к базе сверх ограничений ctx. Operations задаёт
+// лимит отдельным методам Repository по имени, например "ListActive"; остальным
+// достаётся Default.
+type Timeouts struct {
+	Default    time.Duration
+	Operations map[string]time.Duration
 }
 
 type URLRepository struct {
-	db *sql.DB
+	db       *sql.DB
+	timeouts Timeouts
+}
+
+// Option настраивает URLRepository при создании
+type Option func(*URLRepository)
+
+// WithTimeouts дополняет лимиты по умолчанию: Default заменяет лимит по умолчанию,
+// а Operations — лимиты перечисленных методов
+func WithTimeouts(t Timeouts) Option {
+	return func(r *URLRepository) {
+		if t.Default != 0 {
+			r.timeouts.Default = t.Default
+		}
+		for op, d := range t.Operations {
+			r.timeouts.Operations[op] = d
+		}
+	}
+}
+
+func NewURLRepository(db *sql.DB, opts ...Option) *URLRepository {
+	r := &URLRepository{
+		db:       db,
+		timeouts: Timeouts{Default: defaultQueryTimeout, Operations: make(map[string]time.Duration)},
+	}
+	for op, d := range defaultOperationTimeouts {
+		r.timeouts.Operations[op] = d
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// timeout ограничивает ctx лимитом операции op
+func (r *URLRepository) timeout(ctx context.Context, op string) (context.Context, context.CancelFunc) {
+	d, ok := r.timeouts.Operations[op]
+	if !ok {
+		d = r.timeouts.Default
+	}
+	return context.WithTimeout(ctx, d)
+}
+
+const urlColumns = `id, original_url, canonical_url, short_url, created_at, clicks, owner_id, disabled, disabled_reason, redirect_type,
+                    forward_query, forward_path, utm_source, utm_medium, utm_campaign, utm_term, utm_content,
+                    targeting_rules, variants, sticky_variants, interstitial,
+                    not_before, not_after, fallback_url, domain,
+                    meta_title, meta_description, meta_image, meta_favicon, meta_fetched_at, meta_error,
+                    social_title, social_description, social_image,
+                    health_status, health_latency_ms, health_error, broken, health_checked_at`
+
+func (r *URLRepository) Create(ctx context.Context, url *models.URL, events ...*models.WebhookEvent) error {
+	ctx, cancel := r.timeout(ctx, "Create")
+	defer cancel()
+
+	query := `INSERT INTO urls (` + urlColumns + `) 
+	          VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, $24, $25,
+	                  $26, $27, $28, $29, $30, $31, $32, $33, $34, $35, $36, $37, $38, $39)`
+	rules, err := marshalList(url.Rules)
+	if err != nil {
+		return err
+	}
+	variants, err := marshalList(url.Variants)
+	if err != nil {
+		return err
+	}
+	var health models.HealthCheck
+	var checkedAt *time.Time
+	if url.Health != nil {
+		health, checkedAt = *url.Health, &url.Health.CheckedAt
+	}
+	return r.withEvents(ctx, events, func(db execer) error {
+		_, err := db.ExecContext(ctx, query, url.Id, url.Original, url.Canonical, url.Short, url.CreatedAt, url.Clicks, url.Owner,
+			url.Disabled, url.DisabledReason, url.RedirectType, url.ForwardQuery, url.ForwardPath,
+			url.UTM.Source, url.UTM.Medium, url.UTM.Campaign, url.UTM.Term, url.UTM.Content, rules,
+			variants, url.StickyVariants, url.Interstitial, url.NotBefore, url.NotAfter, url.FallbackURL, url.Domain,
+			url.Metadata.Title, url.Metadata.Description, url.Metadata.Image, url.Metadata.Favicon, url.Metadata.FetchedAt,
+			url.Metadata.Error, url.Social.Title, url.Social.Description, url.Social.Image,
+			health.StatusCode, health.LatencyMs, health.Error, health.Broken, checkedAt)
+		if isUniqueViolation(err) {
+			return ErrCodeTaken
+		}
+		return err
+	})
+}
+
+// isUniqueViolation распознаёт нарушение уникальности (SQLSTATE 23505) по ошибке драйвера
+func isUniqueViolation(err error) bool {
+	var state interface{ SQLState() string }
+	return errors.As(err, &state) && state.SQLState() == "23505"
+}
+
+// execer — общая часть *sql.DB и *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// withEvents выполняет change и кладёт events в очередь вебхуков в одной транзакции;
+// без событий change выполняется вне транзакции
+func (r *URLRepository) withEvents(ctx context.Context, events []*models.WebhookEvent, change func(db execer) error) error {
+	if len(events) == 0 {
+		return change(r.db)
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := change(tx); err != nil {
+		return err
+	}
+	for _, event := range events {
+		if err := enqueueWebhookEvent(ctx, tx, event.Link.Owner, event); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// FindByShort ищет ссылку по коду на домене; пустой domain — домен по умолчанию
+func (r *URLRepository) FindByShort(ctx context.Context, domain, short string) (*models.URL, error) {
+	ctx, cancel := r.timeout(ctx, "FindByShort")
+	defer cancel()
+
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE domain = $1 AND short_url = $2`
+	return scanURL(r.db.QueryRowContext(ctx, query, domain, short))
+}
+
+// FindDuplicate ищет среди ссылок owner на домене активную ссылку с той же канонической
+// формой, а для ссылок, созданных до её появления, — с тем же original. Подходят только
+// ссылки без собственных настроек перехода: статуса, пересылки, меток, правил, вариантов,
+// расписания и карточки.
+func (r *URLRepository) FindDuplicate(ctx context.Context, domain, canonical, original, owner string) (*models.URL, error) {
+	ctx, cancel := r.timeout(ctx, "FindDuplicate")
+	defer cancel()
+
+	query := `SELECT ` + urlColumns + ` FROM urls
+	          WHERE domain = $4 AND owner_id = $3 AND (canonical_url = $1 OR (canonical_url = '' AND original_url = $2))
+	            AND NOT disabled AND redirect_type = 0 AND NOT forward_query AND NOT forward_path
+	            AND utm_source = '' AND utm_medium = '' AND utm_campaign = '' AND utm_term = '' AND utm_content = ''
+	            AND targeting_rules = '[]' AND variants = '[]' AND NOT sticky_variants AND NOT interstitial
+	            AND not_before IS NULL AND not_after IS NULL AND fallback_url = ''
+	            AND social_title = '' AND social_description = '' AND social_image = ''
+	          ORDER BY created_at LIMIT 1`
+	return scanURL(r.db.QueryRowContext(ctx, query, canonical, original, owner, domain))
+}
+
+func (r *URLRepository) IncrementClicks(ctx context.Context, domain, short string) (int, error) {
+	ctx, cancel := r.timeout(ctx, "IncrementClicks")
+	defer cancel()
+
+	query := `UPDATE urls SET clicks = clicks + 1 WHERE domain = $1 AND short_url = $2 RETURNING clicks`
+	var clicks int
+	err := r.db.QueryRowContext(ctx, query, domain, short).Scan(&clicks)
+	return clicks, err
+}
+
+// CountByOwner считает ссылки владельца: всего, созданные начиная с since и активные
+func (r *URLRepository) CountByOwner(ctx context.Context, owner string, since time.Time) (*models.UsageCounts, error) {
+	ctx, cancel := r.timeout(ctx, "CountByOwner")
+	defer cancel()
+
+	query := `SELECT COUNT(*),
+	                 COUNT(*) FILTER (WHERE created_at >= $2),
+	                 COUNT(*) FILTER (WHERE NOT disabled AND (not_after IS NULL OR not_after > NOW()))
+	          FROM urls WHERE owner_id = $1`
+
+	var counts models.UsageCounts
+	err := r.db.QueryRowContext(ctx, query, owner, since).Scan(&counts.Total, &counts.Monthly, &counts.Active)
+	if err != nil {
+		return nil, err
+	}
+	return &counts, nil
+}
+
+// ListActive возвращает все неотключённые ссылки
+func (r *URLRepository) ListActive(ctx context.Context) ([]*models.URL, error) {
+	ctx, cancel := r.timeout(ctx, "ListActive")
+	defer cancel()
+
+	query := `SELECT ` + urlColumns + ` FROM urls WHERE NOT disabled ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []*models.URL
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
 }
 
-func NewURLRepository(db *sql.DB) *URLRepository {
-	return &URLRepository{db: db}
+// ScanCodes передаёт в visit коды всех ссылок, включая отключённые, записанных начиная
+// с since. Время записи ставит база, а не экземпляр, поэтому расхождение часов
+// экземпляров не прячет коды от следующего сканирования.
+func (r *URLRepository) ScanCodes(ctx context.Context, since time.Time, visit func(domain, short string, insertedAt time.Time)) error {
+	ctx, cancel := r.timeout(ctx, "ScanCodes")
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `SELECT domain, short_url, inserted_at FROM urls WHERE inserted_at >= $1`, since)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var domain, short string
+		var insertedAt time.Time
+		if err := rows.Scan(&domain, &short, &insertedAt); err != nil {
+			return err
+		}
+		visit(domain, short, insertedAt)
+	}
+	return rows.Err()
+}
+
+func (r *URLRepository) Disable(ctx context.Context, domain, short, reason string, events ...*models.WebhookEvent) error {
+	ctx, cancel := r.timeout(ctx, "Disable")
+	defer cancel()
+
+	query := `UPDATE urls SET disabled = TRUE, disabled_reason = $3 WHERE domain = $1 AND short_url = $2`
+	return r.withEvents(ctx, events, func(db execer) error {
+		_, err := db.ExecContext(ctx, query, domain, short, reason)
+		return err
+	})
 }
 
-func (r *URLRepository) Create(url *models.URL) error {
-	query := `INSERT INTO urls (id, original_url, short_url, created_at, clicks) 
-	          VALUES ($1, $2, $3, $4, $5)`
-	_, err := r.db.Exec(query, url.Id, url.Original, url.Short, url.CreatedAt, url.Clicks)
+// UpdateMetadata сохраняет результат загрузки страницы назначения
+func (r *URLRepository) UpdateMetadata(ctx context.Context, domain, short string, meta *models.LinkMetadata, events ...*models.WebhookEvent) error {
+	ctx, cancel := r.timeout(ctx, "UpdateMetadata")
+	defer cancel()
+
+	query := `UPDATE urls SET meta_title = $3, meta_description = $4, meta_image = $5, meta_favicon = $6,
+	              meta_fetched_at = $7, meta_error = $8
+	          WHERE domain = $1 AND short_url = $2`
+	return r.withEvents(ctx, events, func(db execer) error {
+		_, err := db.ExecContext(ctx, query, domain, short, meta.Title, meta.Description, meta.Image, meta.Favicon,
+			meta.FetchedAt, meta.Error)
+		return err
+	})
+}
+
+// RecordHealthCheck добавляет проверку в историю и запоминает её как последнюю у ссылки
+func (r *URLRepository) RecordHealthCheck(ctx context.Context, check *models.HealthCheck) error {
+	ctx, cancel := r.timeout(ctx, "RecordHealthCheck")
+	defer cancel()
+
+	query := `WITH history AS (
+	              INSERT INTO link_health_checks (short_url, domain, url, status_code, latency_ms, error, broken, checked_at)
+	              VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	          )
+	          UPDATE urls SET health_status = $4, health_latency_ms = $5, health_error = $6, broken = $7,
+	              health_checked_at = $8
+	          WHERE domain = $2 AND short_url = $1`
+	_, err := r.db.ExecContext(ctx, query, check.Short, check.Domain, check.URL, check.StatusCode, check.LatencyMs,
+		check.Error, check.Broken, check.CheckedAt)
 	return err
 }
 
-func (r *URLRepository) FindByShort(short string) (*models.URL, error) {
-	query := `SELECT id, original_url, short_url, created_at, clicks FROM urls WHERE short_url = $1`
-	row := r.db.QueryRow(query, short)
+func (r *URLRepository) PruneHealthChecks(ctx context.Context, before time.Time) (int, error) {
+	ctx, cancel := r.timeout(ctx, "PruneHealthChecks")
+	defer cancel()
 
-	var url models.URL
-	err := row.Scan(&url.Id, &url.Original, &url.Short, &url.CreatedAt, &url.Clicks)
+	res, err := r.db.ExecContext(ctx, `DELETE FROM link_health_checks WHERE checked_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// ListExpired возвращает неотключённые ссылки с not_after не позже now, о завершении
+// которых ещё не отправлено событие
+func (r *URLRepository) ListExpired(ctx context.Context, now time.Time) ([]*models.URL, error) {
+	ctx, cancel := r.timeout(ctx, "ListExpired")
+	defer cancel()
+
+	query := `SELECT ` + urlColumns + ` FROM urls
+	          WHERE NOT disabled AND not_after <= $1 AND expired_notified_at IS NULL ORDER BY not_after`
+	rows, err := r.db.QueryContext(ctx, query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []*models.URL
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+// MarkExpiredNotified отмечает, что link.expired для ссылки записан, и в той же
+// транзакции кладёт events в очередь. Ссылка, уже отмеченная другим экземпляром,
+// событий повторно не получает.
+func (r *URLRepository) MarkExpiredNotified(ctx context.Context, domain, short string, events ...*models.WebhookEvent) error {
+	ctx, cancel := r.timeout(ctx, "MarkExpiredNotified")
+	defer cancel()
+
+	err := r.withEvents(ctx, events, func(db execer) error {
+		query := `UPDATE urls SET expired_notified_at = not_after
+		          WHERE domain = $1 AND short_url = $2 AND expired_notified_at IS NULL`
+		res, err := db.ExecContext(ctx, query, domain, short)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			return errAlreadyNotified
+		}
+		return nil
+	})
+	if errors.Is(err, errAlreadyNotified) {
+		return nil
+	}
+	return err
+}
+
+// ListBroken возвращает активные ссылки владельца, последняя проверка которых не прошла
+func (r *URLRepository) ListBroken(ctx context.Context, owner string) ([]*models.URL, error) {
+	ctx, cancel := r.timeout(ctx, "ListBroken")
+	defer cancel()
+
+	query := `SELECT ` + urlColumns + ` FROM urls
+	          WHERE owner_id = $1 AND broken AND NOT disabled ORDER BY health_checked_at DESC`
+	rows, err := r.db.QueryContext(ctx, query, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []*models.URL
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	return urls, rows.Err()
+}
+
+// HealthHistory возвращает последние limit проверок ссылки, новые первыми
+func (r *URLRepository) HealthHistory(ctx context.Context, domain, short string, limit int) ([]models.HealthCheck, error) {
+	ctx, cancel := r.timeout(ctx, "HealthHistory")
+	defer cancel()
+
+	query := `SELECT short_url, domain, url, status_code, latency_ms, error, broken, checked_at
+	          FROM link_health_checks WHERE domain = $1 AND short_url = $2
+	          ORDER BY checked_at DESC LIMIT $3`
+	rows, err := r.db.QueryContext(ctx, query, domain, short, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var checks []models.HealthCheck
+	for rows.Next() {
+		var c models.HealthCheck
+		if err := rows.Scan(&c.Short, &c.Domain, &c.URL, &c.StatusCode, &c.LatencyMs, &c.Error, &c.Broken, &c.CheckedAt); err != nil {
+			return nil, err
+		}
+		checks = append(checks, c)
+	}
+	return checks, rows.Err()
+}
+
+// GetUTMDefaults возвращает UTM-метки владельца по умолчанию; если их нет — пустые
+func (r *URLRepository) GetUTMDefaults(ctx context.Context, owner string) (*models.UTM, error) {
+	ctx, cancel := r.timeout(ctx, "GetUTMDefaults")
+	defer cancel()
+
+	query := `SELECT utm_source, utm_medium, utm_campaign, utm_term, utm_content
+	          FROM workspace_utm_defaults WHERE owner_id = $1`
+
+	var utm models.UTM
+	err := r.db.QueryRowContext(ctx, query, owner).Scan(&utm.Source, &utm.Medium, &utm.Campaign, &utm.Term, &utm.Content)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	return &utm, nil
+}
+
+func (r *URLRepository) SetUTMDefaults(ctx context.Context, owner string, utm *models.UTM) error {
+	ctx, cancel := r.timeout(ctx, "SetUTMDefaults")
+	defer cancel()
+
+	query := `INSERT INTO workspace_utm_defaults (owner_id, utm_source, utm_medium, utm_campaign, utm_term, utm_content)
+	          VALUES ($1, $2, $3, $4, $5, $6)
+	          ON CONFLICT (owner_id) DO UPDATE SET
+	              utm_source = EXCLUDED.utm_source, utm_medium = EXCLUDED.utm_medium,
+	              utm_campaign = EXCLUDED.utm_campaign, utm_term = EXCLUDED.utm_term,
+	              utm_content = EXCLUDED.utm_content`
+	_, err := r.db.ExecContext(ctx, query, owner, utm.Source, utm.Medium, utm.Campaign, utm.Term, utm.Content)
+	return err
+}
+
+func (r *URLRepository) RecordClick(ctx context.Context, event *models.ClickEvent) error {
+	ctx, cancel := r.timeout(ctx, "RecordClick")
+	defer cancel()
+
+	query := `INSERT INTO click_events (short_url, domain, variant, destination, device, country, occurred_at)
+	          VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	_, err := r.db.ExecContext(ctx, query, event.Short, event.Domain, event.Variant, event.Destination, event.Device, event.Country, event.OccurredAt)
+	return err
+}
+
+// VariantStats считает переходы по каждому варианту ссылки
+func (r *URLRepository) VariantStats(ctx context.Context, domain, short string) ([]models.VariantStats, error) {
+	ctx, cancel := r.timeout(ctx, "VariantStats")
+	defer cancel()
+
+	query := `SELECT variant, COUNT(*) FROM click_events WHERE domain = $1 AND short_url = $2
+	          GROUP BY variant ORDER BY variant`
+	rows, err := r.db.QueryContext(ctx, query, domain, short)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stats []models.VariantStats
+	for rows.Next() {
+		var s models.VariantStats
+		if err := rows.Scan(&s.Variant, &s.Clicks); err != nil {
+			return nil, err
+		}
+		stats = append(stats, s)
+	}
+	return stats, rows.Err()
+}
+
+func (r *URLRepository) CreateDomain(ctx context.Context, domain *models.Domain) error {
+	ctx, cancel := r.timeout(ctx, "CreateDomain")
+	defer cancel()
+
+	query := `INSERT INTO domains (host, owner_id, created_at) VALUES ($1, $2, $3)`
+	_, err := r.db.ExecContext(ctx, query, domain.Host, domain.Owner, domain.CreatedAt)
+	return err
+}
 
+// FindDomain возвращает подключённый домен или nil, если хост не зарегистрирован
+func (r *URLRepository) FindDomain(ctx context.Context, host string) (*models.Domain, error) {
+	ctx, cancel := r.timeout(ctx, "FindDomain")
+	defer cancel()
+
+	query := `SELECT host, owner_id, created_at FROM domains WHERE host = $1`
+
+	var domain models.Domain
+	err := r.db.QueryRowContext(ctx, query, host).Scan(&domain.Host, &domain.Owner, &domain.CreatedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
+	return &domain, nil
+}
 
-	return &url, nil
+func (r *URLRepository) ListDomains(ctx context.Context, owner string) ([]*models.Domain, error) {
+	ctx, cancel := r.timeout(ctx, "ListDomains")
+	defer cancel()
+
+	query := `SELECT host, owner_id, created_at FROM domains WHERE owner_id = $1 ORDER BY host`
+	rows, err := r.db.QueryContext(ctx, query, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var domains []*models.Domain
+	for rows.Next() {
+		var domain models.Domain
+		if err := rows.Scan(&domain.Host, &domain.Owner, &domain.CreatedAt); err != nil {
+			return nil, err
+		}
+		domains = append(domains, &domain)
+	}
+	return domains, rows.Err()
+}
+
+func (r *URLRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	ctx, cancel := r.timeout(ctx, "CreateAPIKey")
+	defer cancel()
+
+	query := `INSERT INTO api_keys (key_hash, owner_id, created_at) VALUES ($1, $2, $3)`
+	_, err := r.db.ExecContext(ctx, query, key.Hash, key.Owner, key.CreatedAt)
+	return err
+}
+
+// FindAPIKey возвращает ключ по хешу или nil, если такого ключа нет
+func (r *URLRepository) FindAPIKey(ctx context.Context, hash string) (*models.APIKey, error) {
+	ctx, cancel := r.timeout(ctx, "FindAPIKey")
+	defer cancel()
+
+	var key models.APIKey
+	query := `SELECT key_hash, owner_id, created_at FROM api_keys WHERE key_hash = $1`
+	err := r.db.QueryRowContext(ctx, query, hash).Scan(&key.Hash, &key.Owner, &key.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func (r *URLRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	ctx, cancel := r.timeout(ctx, "CreateWebhook")
+	defer cancel()
+
+	events, err := marshalList(webhook.Events)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO webhooks (id, owner_id, url, secret, events, created_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err = r.db.ExecContext(ctx, query, webhook.ID, webhook.Owner, webhook.URL, webhook.Secret, events, webhook.CreatedAt)
+	return err
+}
+
+// FindWebhook возвращает подписку владельца или nil, если её нет
+func (r *URLRepository) FindWebhook(ctx context.Context, owner, id string) (*models.Webhook, error) {
+	ctx, cancel := r.timeout(ctx, "FindWebhook")
+	defer cancel()
+
+	query := `SELECT id, owner_id, url, secret, events, created_at FROM webhooks WHERE owner_id = $1 AND id = $2`
+	webhook, err := scanWebhook(r.db.QueryRowContext(ctx, query, owner, id))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return webhook, err
+}
+
+func (r *URLRepository) ListWebhooks(ctx context.Context, owner string) ([]*models.Webhook, error) {
+	ctx, cancel := r.timeout(ctx, "ListWebhooks")
+	defer cancel()
+
+	query := `SELECT id, owner_id, url, secret, events, created_at FROM webhooks WHERE owner_id = $1 ORDER BY created_at`
+	rows, err := r.db.QueryContext(ctx, query, owner)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var webhooks []*models.Webhook
+	for rows.Next() {
+		webhook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	return webhooks, rows.Err()
+}
+
+// DeleteWebhook удаляет подписку вместе с её очередью доставки
+func (r *URLRepository) DeleteWebhook(ctx context.Context, owner, id string) error {
+	ctx, cancel := r.timeout(ctx, "DeleteWebhook")
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM webhooks WHERE owner_id = $1 AND id = $2`, owner, id)
+	return err
+}
+
+// EnqueueWebhookEvent кладёт событие в очередь доставки каждой подписке владельца на
+// его тип, существовавшей на момент event.CreatedAt. Повтор события с тем же ID в
+// очередь не попадает.
+func (r *URLRepository) EnqueueWebhookEvent(ctx context.Context, owner string, event *models.WebhookEvent) error {
+	ctx, cancel := r.timeout(ctx, "EnqueueWebhookEvent")
+	defer cancel()
+
+	return enqueueWebhookEvent(ctx, r.db, owner, event)
+}
+
+func enqueueWebhookEvent(ctx context.Context, db execer, owner string, event *models.WebhookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	query := `INSERT INTO webhook_outbox (webhook_id, event_id, event_type, payload, next_attempt_at, created_at)
+	          SELECT id, $2, $3, $4, $5, $5 FROM webhooks WHERE owner_id = $1 AND events ? $3 AND created_at <= $5
+	          ON CONFLICT (webhook_id, event_id) DO NOTHING`
+	_, err = db.ExecContext(ctx, query, owner, event.ID, event.Type, string(payload), event.CreatedAt)
+	return err
+}
+
+// ClaimWebhookMessages забирает до limit сообщений, время доставки которых наступило, и
+// откладывает их до leaseUntil. Если экземпляр упадёт, не записав результат, после
+// leaseUntil сообщения заберёт другой.
+func (r *URLRepository) ClaimWebhookMessages(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*models.WebhookMessage, error) {
+	ctx, cancel := r.timeout(ctx, "ClaimWebhookMessages")
+	defer cancel()
+
+	query := `WITH due AS (
+	              SELECT id FROM webhook_outbox
+	              WHERE status = 'pending' AND next_attempt_at <= $1
+	              ORDER BY next_attempt_at LIMIT $3
+	              FOR UPDATE SKIP LOCKED
+	          ), claimed AS (
+	              UPDATE webhook_outbox o SET next_attempt_at = $2 FROM due WHERE o.id = due.id
+	              RETURNING o.id, o.webhook_id, o.event_id, o.event_type, o.payload, o.attempts
+	          )
+	          SELECT c.id, c.webhook_id, c.event_id, c.event_type, c.payload, c.attempts, w.url, w.secret
+	          FROM claimed c JOIN webhooks w ON w.id = c.webhook_id`
+	rows, err := r.db.QueryContext(ctx, query, now, leaseUntil, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []*models.WebhookMessage
+	for rows.Next() {
+		var m models.WebhookMessage
+		var payload string
+		if err := rows.Scan(&m.ID, &m.WebhookID, &m.EventID, &m.EventType, &payload, &m.Attempts, &m.URL, &m.Secret); err != nil {
+			return nil, err
+		}
+		m.Payload = []byte(payload)
+		messages = append(messages, &m)
+	}
+	return messages, rows.Err()
+}
+
+// RecordWebhookDelivery пишет попытку в журнал и переводит сообщение очереди в
+// delivered, failed или назначает повтор
+func (r *URLRepository) RecordWebhookDelivery(ctx context.Context, messageID int64, delivery *models.WebhookDelivery) error {
+	ctx, cancel := r.timeout(ctx, "RecordWebhookDelivery")
+	defer cancel()
+
+	query := `WITH log AS (
+	              INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, attempt, status_code, error, success,
+	                  duration_ms, attempted_at, next_attempt_at)
+	              VALUES ($2, $3, $4, $5, $6, $7, $8, $9, $10, $11::timestamp)
+	          )
+	          UPDATE webhook_outbox SET attempts = $5,
+	              status = CASE WHEN $8 THEN 'delivered' WHEN $11::timestamp IS NULL THEN 'failed' ELSE 'pending' END,
+	              next_attempt_at = COALESCE($11::timestamp, next_attempt_at)
+	          WHERE id = $1`
+	_, err := r.db.ExecContext(ctx, query, messageID, delivery.WebhookID, delivery.EventID, delivery.EventType, delivery.Attempt,
+		delivery.StatusCode, delivery.Error, delivery.Success, delivery.DurationMs, delivery.AttemptedAt,
+		delivery.NextAttemptAt)
+	return err
+}
+
+// WebhookDeliveries возвращает последние limit попыток доставки подписки, новые первыми
+func (r *URLRepository) WebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	ctx, cancel := r.timeout(ctx, "WebhookDeliveries")
+	defer cancel()
+
+	query := `SELECT webhook_id, event_id, event_type, attempt, status_code, error, success, duration_ms,
+	              attempted_at, next_attempt_at
+	          FROM webhook_deliveries WHERE webhook_id = $1
+	          ORDER BY attempted_at DESC, id DESC LIMIT $2`
+	rows, err := r.db.QueryContext(ctx, query, webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		if err := rows.Scan(&d.WebhookID, &d.EventID, &d.EventType, &d.Attempt, &d.StatusCode, &d.Error, &d.Success,
+			&d.DurationMs, &d.AttemptedAt, &d.NextAttemptAt); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
 }
 
-func (r *URLRepository) FindByOriginal(original string) (*models.URL, error) {
-	query := `SELECT id, original_url, short_url, created_at, clicks FROM urls WHERE original_url = $1`
-	row := r.db.QueryRow(query, original)
+// FillCodePool добавляет в пул коды, которых ещё нет ни в пуле, ни среди ссылок
+func (r *URLRepository) FillCodePool(ctx context.Context, codes []string) (int, error) {
+	ctx, cancel := r.timeout(ctx, "FillCodePool")
+	defer cancel()
 
+	query := `INSERT INTO code_pool (code)
+	          SELECT c FROM unnest($1::text[]) AS c
+	          WHERE NOT EXISTS (SELECT 1 FROM urls WHERE short_url = c)
+	          ON CONFLICT (code) DO NOTHING`
+	// Коды состоят из букв и цифр, поэтому литерал массива не нужно экранировать
+	res, err := r.db.ExecContext(ctx, query, "{"+strings.Join(codes, ",")+"}")
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (r *URLRepository) CountFreeCodes(ctx context.Context) (int, error) {
+	ctx, cancel := r.timeout(ctx, "CountFreeCodes")
+	defer cancel()
+
+	var n int
+	err := r.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM code_pool WHERE reserved_by IS NULL`).Scan(&n)
+	return n, err
+}
+
+// ReserveCodes закрепляет за экземпляром до n свободных кодов; параллельные экземпляры
+// получают разные коды
+func (r *URLRepository) ReserveCodes(ctx context.Context, instance string, n int, now time.Time) ([]string, error) {
+	ctx, cancel := r.timeout(ctx, "ReserveCodes")
+	defer cancel()
+
+	query := `UPDATE code_pool SET reserved_by = $1, reserved_at = $2
+	          WHERE code IN (
+	              SELECT code FROM code_pool WHERE reserved_by IS NULL
+	              LIMIT $3 FOR UPDATE SKIP LOCKED
+	          )
+	          RETURNING code`
+	rows, err := r.db.QueryContext(ctx, query, instance, now, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+func (r *URLRepository) TouchReservedCodes(ctx context.Context, instance string, now time.Time) ([]string, error) {
+	ctx, cancel := r.timeout(ctx, "TouchReservedCodes")
+	defer cancel()
+
+	rows, err := r.db.QueryContext(ctx, `UPDATE code_pool SET reserved_at = $2 WHERE reserved_by = $1 RETURNING code`, instance, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var codes []string
+	for rows.Next() {
+		var code string
+		if err := rows.Scan(&code); err != nil {
+			return nil, err
+		}
+		codes = append(codes, code)
+	}
+	return codes, rows.Err()
+}
+
+// ReleaseCodes возвращает в пул резерв экземпляра; коды, уже занятые ссылками, удаляются
+func (r *URLRepository) ReleaseCodes(ctx context.Context, instance string) error {
+	ctx, cancel := r.timeout(ctx, "ReleaseCodes")
+	defer cancel()
+
+	query := `WITH used AS (
+	              DELETE FROM code_pool p WHERE reserved_by = $1
+	                  AND EXISTS (SELECT 1 FROM urls WHERE short_url = p.code)
+	          )
+	          UPDATE code_pool p SET reserved_by = NULL, reserved_at = NULL
+	          WHERE reserved_by = $1 AND NOT EXISTS (SELECT 1 FROM urls WHERE short_url = p.code)`
+	_, err := r.db.ExecContext(ctx, query, instance)
+	return err
+}
+
+func (r *URLRepository) ConsumeCode(ctx context.Context, code string) error {
+	ctx, cancel := r.timeout(ctx, "ConsumeCode")
+	defer cancel()
+
+	_, err := r.db.ExecContext(ctx, `DELETE FROM code_pool WHERE code = $1`, code)
+	return err
+}
+
+// ReclaimCodes возвращает в пул просроченный резерв. Коды, которые упавший экземпляр
+// успел отдать ссылкам, удаляются.
+func (r *URLRepository) ReclaimCodes(ctx context.Context, staleBefore time.Time) (int, error) {
+	ctx, cancel := r.timeout(ctx, "ReclaimCodes")
+	defer cancel()
+
+	query := `WITH used AS (
+	              DELETE FROM code_pool p WHERE reserved_at < $1
+	                  AND EXISTS (SELECT 1 FROM urls WHERE short_url = p.code)
+	          )
+	          UPDATE code_pool p SET reserved_by = NULL, reserved_at = NULL
+	          WHERE reserved_at < $1 AND NOT EXISTS (SELECT 1 FROM urls WHERE short_url = p.code)`
+	res, err := r.db.ExecContext(ctx, query, staleBefore)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func scanWebhook(row scanner) (*models.Webhook, error) {
+	var webhook models.Webhook
+	var events []byte
+	if err := row.Scan(&webhook.ID, &webhook.Owner, &webhook.URL, &webhook.Secret, &events, &webhook.CreatedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(events, &webhook.Events); err != nil {
+		return nil, fmt.Errorf("webhook %s events: %w", webhook.ID, err)
+	}
+	return &webhook, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanURL(row scanner) (*models.URL, error) {
 	var url models.URL
-	err := row.Scan(&url.Id, &url.Original, &url.Short, &url.CreatedAt, &url.Clicks)
+	var rules, variants []byte
+	var health models.HealthCheck
+	var checkedAt *time.Time
+	err := row.Scan(&url.Id, &url.Original, &url.Canonical, &url.Short, &url.CreatedAt, &url.Clicks, &url.Owner,
+		&url.Disabled, &url.DisabledReason, &url.RedirectType, &url.ForwardQuery, &url.ForwardPath,
+		&url.UTM.Source, &url.UTM.Medium, &url.UTM.Campaign, &url.UTM.Term, &url.UTM.Content, &rules,
+		&variants, &url.StickyVariants, &url.Interstitial, &url.NotBefore, &url.NotAfter, &url.FallbackURL, &url.Domain,
+		&url.Metadata.Title, &url.Metadata.Description, &url.Metadata.Image, &url.Metadata.Favicon, &url.Metadata.FetchedAt,
+		&url.Metadata.Error, &url.Social.Title, &url.Social.Description, &url.Social.Image,
+		&health.StatusCode, &health.LatencyMs, &health.Error, &health.Broken, &checkedAt)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -57,11 +919,29 @@ func (r *URLRepository) FindByOriginal(original string) (*models.URL, error) {
 		return nil, err
 	}
 
+	if checkedAt != nil {
+		health.Short, health.Domain, health.URL, health.CheckedAt = url.Short, url.Domain, url.Original, *checkedAt
+		url.Health = &health
+	}
+
+	if len(rules) > 0 {
+		if err := json.Unmarshal(rules, &url.Rules); err != nil {
+			return nil, fmt.Errorf("decode targeting rules of %s: %w", url.Short, err)
+		}
+	}
+	if len(variants) > 0 {
+		if err := json.Unmarshal(variants, &url.Variants); err != nil {
+			return nil, fmt.Errorf("decode variants of %s: %w", url.Short, err)
+		}
+	}
+
 	return &url, nil
 }
 
-func (r *URLRepository) IncrementClicks(short string) error {
-	query := `UPDATE urls SET clicks = clicks + 1 WHERE short_url = $1`
-	_, err := r.db.Exec(query, short)
-	return err
+// marshalList кодирует список для JSONB-колонки; nil сохраняется как []
+func marshalList[T any](list []T) ([]byte, error) {
+	if list == nil {
+		list = []T{}
+	}
+	return json.Marshal(list)
 }
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestURLRepository_Timeouts(t *testing.T) {
+	r := NewURLRepository(nil, WithTimeouts(Timeouts{
+		Default:    time.Second,
+		Operations: map[string]time.Duration{"FindByShort": 3 * time.Second},
+	}))
+
+	for op, want := range map[string]time.Duration{
+		"Create":      time.Second,
+		"FindByShort": 3 * time.Second,
+		"ListActive":  time.Minute,
+	} {
+		ctx, cancel := r.timeout(context.Background(), op)
+		deadline, ok := ctx.Deadline()
+		cancel()
+		if left := time.Until(deadline); !ok || left > want || left < want-time.Second/2 {
+			t.Fatalf("%s: expected deadline in %v, got %v", op, want, left)
+		}
+	}
+
+	parent, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ctx, cancelOp := r.timeout(parent, "ListActive")
+	defer cancelOp()
+	if deadline, _ := ctx.Deadline(); time.Until(deadline) > 10*time.Millisecond {
+		t.Fatalf("operation timeout must not extend the caller's deadline")
+	}
+}
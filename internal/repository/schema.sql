@@ -0,0 +1,163 @@
+CREATE TABLE IF NOT EXISTS urls (
+    id           VARCHAR(10) NOT NULL,
+    original_url TEXT        NOT NULL,
+    canonical_url TEXT       NOT NULL DEFAULT '',
+    short_url    VARCHAR(10) NOT NULL,
+    domain       VARCHAR(255) NOT NULL DEFAULT '',
+    created_at   TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    inserted_at  TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    clicks       INT         DEFAULT 0,
+    owner_id     VARCHAR(64) NOT NULL DEFAULT '',
+    disabled     BOOLEAN     NOT NULL DEFAULT FALSE,
+    disabled_reason TEXT     NOT NULL DEFAULT '',
+    redirect_type SMALLINT   NOT NULL DEFAULT 0,
+    forward_query BOOLEAN    NOT NULL DEFAULT FALSE,
+    forward_path  BOOLEAN    NOT NULL DEFAULT FALSE,
+    utm_source   TEXT        NOT NULL DEFAULT '',
+    utm_medium   TEXT        NOT NULL DEFAULT '',
+    utm_campaign TEXT        NOT NULL DEFAULT '',
+    utm_term     TEXT        NOT NULL DEFAULT '',
+    utm_content  TEXT        NOT NULL DEFAULT '',
+    targeting_rules JSONB    NOT NULL DEFAULT '[]',
+    variants     JSONB       NOT NULL DEFAULT '[]',
+    sticky_variants BOOLEAN  NOT NULL DEFAULT FALSE,
+    interstitial BOOLEAN     NOT NULL DEFAULT FALSE,
+    not_before   TIMESTAMP,
+    not_after    TIMESTAMP,
+    fallback_url TEXT        NOT NULL DEFAULT '',
+    meta_title   TEXT        NOT NULL DEFAULT '',
+    meta_description TEXT    NOT NULL DEFAULT '',
+    meta_image   TEXT        NOT NULL DEFAULT '',
+    meta_favicon TEXT        NOT NULL DEFAULT '',
+    meta_fetched_at TIMESTAMP,
+    meta_error   TEXT        NOT NULL DEFAULT '',
+    social_title TEXT        NOT NULL DEFAULT '',
+    social_description TEXT  NOT NULL DEFAULT '',
+    social_image TEXT        NOT NULL DEFAULT '',
+    health_status SMALLINT   NOT NULL DEFAULT 0,
+    health_latency_ms INT    NOT NULL DEFAULT 0,
+    health_error TEXT        NOT NULL DEFAULT '',
+    broken       BOOLEAN     NOT NULL DEFAULT FALSE,
+    health_checked_at TIMESTAMP,
+    expired_notified_at TIMESTAMP,
+    PRIMARY KEY (domain, id),
+    UNIQUE (domain, short_url)
+);
+
+CREATE INDEX IF NOT EXISTS idx_urls_canonical_url ON urls (canonical_url, owner_id);
+CREATE INDEX IF NOT EXISTS idx_urls_owner_created ON urls (owner_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_urls_inserted ON urls (inserted_at);
+CREATE INDEX IF NOT EXISTS idx_urls_broken ON urls (owner_id) WHERE broken;
+CREATE INDEX IF NOT EXISTS idx_urls_expiring ON urls (not_after) WHERE expired_notified_at IS NULL AND NOT disabled;
+
+-- История проверок доступности адресов назначения
+CREATE TABLE IF NOT EXISTS link_health_checks (
+    id          BIGSERIAL   PRIMARY KEY,
+    short_url   VARCHAR(10) NOT NULL,
+    domain      VARCHAR(255) NOT NULL DEFAULT '',
+    url         TEXT        NOT NULL,
+    status_code SMALLINT    NOT NULL DEFAULT 0,
+    latency_ms  INT         NOT NULL DEFAULT 0,
+    error       TEXT        NOT NULL DEFAULT '',
+    broken      BOOLEAN     NOT NULL DEFAULT FALSE,
+    checked_at  TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_link_health_checks_link ON link_health_checks (domain, short_url, checked_at);
+CREATE INDEX IF NOT EXISTS idx_link_health_checks_checked ON link_health_checks (checked_at);
+
+-- Брендированные домены; один и тот же код может существовать на разных доменах
+CREATE TABLE IF NOT EXISTS domains (
+    host         VARCHAR(255) PRIMARY KEY,
+    owner_id     VARCHAR(64) NOT NULL DEFAULT '',
+    created_at   TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_domains_owner ON domains (owner_id);
+
+CREATE TABLE IF NOT EXISTS workspace_utm_defaults (
+    owner_id     VARCHAR(64) PRIMARY KEY,
+    utm_source   TEXT        NOT NULL DEFAULT '',
+    utm_medium   TEXT        NOT NULL DEFAULT '',
+    utm_campaign TEXT        NOT NULL DEFAULT '',
+    utm_term     TEXT        NOT NULL DEFAULT '',
+    utm_content  TEXT        NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS click_events (
+    id          BIGSERIAL   PRIMARY KEY,
+    short_url   VARCHAR(10) NOT NULL,
+    domain      VARCHAR(255) NOT NULL DEFAULT '',
+    variant     TEXT        NOT NULL DEFAULT '',
+    destination TEXT        NOT NULL,
+    device      TEXT        NOT NULL DEFAULT '',
+    country     VARCHAR(2)  NOT NULL DEFAULT '',
+    occurred_at TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_click_events_short ON click_events (domain, short_url, occurred_at);
+
+-- Ключи API: владелец запроса определяется только по ключу из этой таблицы, сам ключ не хранится
+CREATE TABLE IF NOT EXISTS api_keys (
+    key_hash    CHAR(64)    PRIMARY KEY,
+    owner_id    VARCHAR(64) NOT NULL,
+    created_at  TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Подписки владельцев на события ссылок
+CREATE TABLE IF NOT EXISTS webhooks (
+    id          VARCHAR(32) PRIMARY KEY,
+    owner_id    VARCHAR(64) NOT NULL DEFAULT '',
+    url         TEXT        NOT NULL,
+    secret      TEXT        NOT NULL,
+    events      JSONB       NOT NULL DEFAULT '[]',
+    created_at  TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_owner ON webhooks (owner_id);
+
+-- Очередь доставки: событие попадает сюда до отправки и остаётся, пока не доставлено
+-- или не исчерпаны попытки, поэтому не теряется при падении сервиса
+CREATE TABLE IF NOT EXISTS webhook_outbox (
+    id              BIGSERIAL   PRIMARY KEY,
+    webhook_id      VARCHAR(32) NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event_id        TEXT        NOT NULL,
+    event_type      VARCHAR(64) NOT NULL,
+    payload         TEXT        NOT NULL,
+    status          VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts        INT         NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at      TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_outbox_due ON webhook_outbox (next_attempt_at) WHERE status = 'pending';
+
+-- Журнал попыток доставки
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id              BIGSERIAL   PRIMARY KEY,
+    webhook_id      VARCHAR(32) NOT NULL REFERENCES webhooks (id) ON DELETE CASCADE,
+    event_id        TEXT        NOT NULL,
+    event_type      VARCHAR(64) NOT NULL,
+    attempt         INT         NOT NULL,
+    status_code     SMALLINT    NOT NULL DEFAULT 0,
+    error           TEXT        NOT NULL DEFAULT '',
+    success         BOOLEAN     NOT NULL DEFAULT FALSE,
+    duration_ms     INT         NOT NULL DEFAULT 0,
+    attempted_at    TIMESTAMP   NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    next_attempt_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries (webhook_id, attempted_at);
+
+-- Пул заранее сгенерированных кодов. reserved_by — экземпляр, которому выдан код;
+-- резерв, который экземпляр перестал продлевать, возвращается в пул
+CREATE TABLE IF NOT EXISTS code_pool (
+    code        VARCHAR(10) PRIMARY KEY,
+    reserved_by VARCHAR(128),
+    reserved_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_code_pool_free ON code_pool (code) WHERE reserved_by IS NULL;
+CREATE INDEX IF NOT EXISTS idx_code_pool_reserved ON code_pool (reserved_by, reserved_at);
+CREATE INDEX IF NOT EXISTS idx_urls_short ON urls (short_url);
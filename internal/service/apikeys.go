@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"urlcutter/internal/models"
+)
+
+// ErrUnauthorized — ключ API не передан там, где он обязателен, или не найден
+var ErrUnauthorized = errors.New("unauthorized")
+
+// IssueAPIKey выпускает ключ API владельца. Ключ возвращается один раз: в базе остаётся
+// только его хеш, а владелец ссылок и квот — идентификатор owner, а не сам ключ.
+func (s *URLService) IssueAPIKey(ctx context.Context, owner string) (string, error) {
+	if owner == "" {
+		return "", fmt.Errorf("owner is required")
+	}
+	key, err := randomHex(32)
+	if err != nil {
+		return "", err
+	}
+	if err := s.repo.CreateAPIKey(ctx, &models.APIKey{Hash: hashAPIKey(key), Owner: owner, CreatedAt: s.now()}); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// Authenticate возвращает владельца ключа API; неизвестный ключ — ErrUnauthorized
+func (s *URLService) Authenticate(ctx context.Context, key string) (string, error) {
+	if key == "" {
+		return "", ErrUnauthorized
+	}
+	found, err := s.repo.FindAPIKey(ctx, hashAPIKey(key))
+	if err != nil {
+		return "", err
+	}
+	if found == nil {
+		return "", ErrUnauthorized
+	}
+	return found.Owner, nil
+}
+
+// hashAPIKey — ключи случайные и длинные, поэтому соли и медленного хеша не нужно
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
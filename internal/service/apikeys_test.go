@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo)
+
+	key, err := svc.IssueAPIKey(ctx, "acme")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for hash, stored := range repo.apiKeys {
+		if hash == key || stored.Owner != "acme" {
+			t.Fatalf("expected only the key hash stored for acme, got %+v", stored)
+		}
+	}
+
+	if owner, err := svc.Authenticate(ctx, key); err != nil || owner != "acme" {
+		t.Fatalf("expected acme, got %q, %v", owner, err)
+	}
+	for _, forged := range []string{"", "acme", key + "0"} {
+		if _, err := svc.Authenticate(ctx, forged); !errors.Is(err, ErrUnauthorized) {
+			t.Fatalf("%q: expected unauthorized, got %v", forged, err)
+		}
+	}
+}
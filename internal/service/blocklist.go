@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"urlcutter/internal/blocklist"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+)
+
+// blocklistReason — префикс причины отключения ссылки блок-листом
+const blocklistReason = "blocklist: "
+
+// DisabledError возвращается при переходе по отключённой ссылке
+type DisabledError struct {
+	Short    string
+	Original string
+	Reason   string
+	// Blocked — ссылка отключена из-за блок-листа
+	Blocked bool
+}
+
+func (e *DisabledError) Error() string {
+	return fmt.Sprintf("link %s is disabled: %s", e.Short, e.Reason)
+}
+
+// WithBlocklist включает проверку целевых URL по блок-листу
+func WithBlocklist(b *blocklist.Blocklist) Option {
+	return func(s *URLService) {
+		s.blocklist = b
+	}
+}
+
+func (s *URLService) checkBlocklist(original string) error {
+	if s.blocklist == nil {
+		return nil
+	}
+	if rule, ok := s.blocklist.Match(original); ok {
+		return &policy.ValidationError{
+			Code:    policy.CodeBlocked,
+			Message: fmt.Sprintf("destination is blocked by rule %q", rule),
+		}
+	}
+	return nil
+}
+
+// RescanBlocklist отключает существующие ссылки, попавшие в блок-лист, и возвращает их количество.
+// Вызывается после обновления списка.
+func (s *URLService) RescanBlocklist(ctx context.Context) (int, error) {
+	if s.blocklist == nil {
+		return 0, nil
+	}
+
+	urls, err := s.repo.ListActive(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	disabled := 0
+	for _, u := range urls {
+		rule, ok := s.matchLink(u)
+		if !ok {
+			continue
+		}
+		u.Disabled, u.DisabledReason = true, blocklistReason+rule
+		if err := s.repo.Disable(ctx, u.Domain, u.Short, u.DisabledReason, s.linkEvents(models.EventLinkDisabled, u)...); err != nil {
+			return disabled, err
+		}
+		log.Printf("Disabled link %s: destination matches blocklist rule %q", u.Short, rule)
+		disabled++
+	}
+	return disabled, nil
+}
+
+// matchLink проверяет основной и резервный адреса ссылки, адреса её правил таргетинга и вариантов
+func (s *URLService) matchLink(u *models.URL) (string, bool) {
+	for _, destination := range []string{u.Original, u.FallbackURL} {
+		if rule, ok := s.blocklist.Match(destination); destination != "" && ok {
+			return rule, true
+		}
+	}
+	for _, r := range u.Rules {
+		if rule, ok := s.blocklist.Match(r.URL); ok {
+			return rule, true
+		}
+	}
+	for _, v := range u.Variants {
+		if rule, ok := s.blocklist.Match(v.URL); ok {
+			return rule, true
+		}
+	}
+	return "", false
+}
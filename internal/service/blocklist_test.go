@@ -0,0 +1,57 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	"urlcutter/internal/blocklist"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+)
+
+func TestBlocklist_CreateAndRescan(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("evil.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bl, err := blocklist.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Original: "https://phish.example/login", Short: "abc123", CreatedAt: time.Now()})
+	svc := newTestService(repo, WithBlocklist(bl))
+
+	var verr *policy.ValidationError
+	if _, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://evil.example/"}); !errors.As(err, &verr) || verr.Code != policy.CodeBlocked {
+		t.Fatalf("expected blocked error, got %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("evil.example\n.phish.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Время изменения файла может совпасть с прошлым чтением
+	future := time.Now().Add(time.Second)
+	_ = os.Chtimes(path, future, future)
+	if changed, err := bl.Reload(); err != nil || !changed {
+		t.Fatalf("expected blocklist reload, got %v, %v", changed, err)
+	}
+
+	n, err := svc.RescanBlocklist(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("expected 1 disabled link, got %d, %v", n, err)
+	}
+
+	var disabledErr *DisabledError
+	if _, err := svc.Redirect(ctx, &models.RedirectRequest{Short: "abc123"}); !errors.As(err, &disabledErr) {
+		t.Fatalf("expected disabled error, got %v", err)
+	}
+	if len(repo.incremented) != 0 {
+		t.Fatalf("clicks must not be counted for disabled links")
+	}
+}
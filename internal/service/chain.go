@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"urlcutter/internal/policy"
+)
+
+// Что делать со ссылками на сторонние сокращатели
+const (
+	ChainReject = "reject"
+	ChainExpand = "expand"
+)
+
+const (
+	defaultMaxHops       = 5
+	defaultExpandTimeout = 3 * time.Second
+)
+
+type ChainConfig struct {
+	// OwnDomains — хосты нашего сервиса, например "localhost:8080" или "sho.rt"
+	OwnDomains []string
+	// ShortenerHosts — известные сторонние сокращатели (bit.ly, t.co, ...)
+	ShortenerHosts []string
+	// Mode — ChainReject (по умолчанию) или ChainExpand
+	Mode string
+	// MaxHops ограничивает длину цепочки при разворачивании и поиске циклов
+	MaxHops int
+	// Client используется для разворачивания; редиректы он не должен выполнять сам
+	Client *http.Client
+}
+
+// WithChainPolicy включает защиту от петель редиректов и цепочек сокращателей
+func WithChainPolicy(cfg ChainConfig) Option {
+	return func(s *URLService) {
+		if cfg.Mode == "" {
+			cfg.Mode = ChainReject
+		}
+		if cfg.MaxHops == 0 {
+			cfg.MaxHops = defaultMaxHops
+		}
+		if cfg.Client == nil {
+			cfg.Client = &http.Client{
+				Timeout: defaultExpandTimeout,
+				CheckRedirect: func(*http.Request, []*http.Request) error {
+					return http.ErrUseLastResponse
+				},
+			}
+		}
+		s.chain = &cfg
+	}
+}
+
+// resolveOwnDomain заменяет ссылку на наш же сервис конечным адресом целевого кода.
+// Второе значение сообщает, что URL указывал на наш домен.
+func (s *URLService) resolveOwnDomain(ctx context.Context, raw string) (string, bool, error) {
+	if s.chain == nil {
+		return raw, false, nil
+	}
+
+	visited := make(map[string]bool)
+	current := raw
+	for hop := 0; hop <= s.chain.MaxHops; hop++ {
+		parsed, err := url.Parse(current)
+		if err != nil {
+			return current, hop > 0, nil
+		}
+		domain, own, err := s.ownDomain(ctx, parsed)
+		if err != nil {
+			return "", true, err
+		}
+		if !own {
+			return current, hop > 0, nil
+		}
+
+		code := strings.Trim(parsed.Path, "/")
+		if code == "" || strings.Contains(code, "/") {
+			return "", true, invalidDestination(policy.CodeRedirectLoop, "destination points to this service but not to a short link")
+		}
+		if visited[domain+"/"+code] {
+			return "", true, invalidDestination(policy.CodeRedirectLoop, "redirect loop through %s", code)
+		}
+		visited[domain+"/"+code] = true
+
+		target, err := s.repo.FindByShort(ctx, domain, code)
+		if err != nil {
+			return "", true, err
+		}
+		if target == nil {
+			return "", true, invalidDestination(policy.CodeRedirectLoop, "short link %s does not exist", code)
+		}
+		current = target.Original
+	}
+	return "", true, invalidDestination(policy.CodeRedirectLoop, "redirect chain is longer than %d hops", s.chain.MaxHops)
+}
+
+// ownDomain сообщает, что URL указывает на наш сервис: на домен по умолчанию из OwnDomains
+// или на подключённый брендированный домен, который и возвращается
+func (s *URLService) ownDomain(ctx context.Context, u *url.URL) (string, bool, error) {
+	if matchHost(u, s.chain.OwnDomains) {
+		return "", true, nil
+	}
+	host, err := normalizeDomain(u.Host)
+	if err != nil {
+		return "", false, nil
+	}
+	domain, err := s.repo.FindDomain(ctx, host)
+	if err != nil || domain == nil {
+		return "", false, err
+	}
+	return domain.Host, true, nil
+}
+
+// checkShortener отклоняет или разворачивает ссылки на известные сокращатели
+func (s *URLService) checkShortener(ctx context.Context, raw string) (string, error) {
+	if s.chain == nil || len(s.chain.ShortenerHosts) == 0 {
+		return raw, nil
+	}
+
+	visited := make(map[string]bool)
+	current := raw
+	for hop := 0; hop <= s.chain.MaxHops; hop++ {
+		parsed, err := url.Parse(current)
+		if err != nil || !matchHost(parsed, s.chain.ShortenerHosts) {
+			return current, nil
+		}
+		if s.chain.Mode != ChainExpand {
+			return "", invalidDestination(policy.CodeShortenerChain, "links to %s are not allowed, use the final destination", parsed.Host)
+		}
+		if visited[current] {
+			return "", invalidDestination(policy.CodeRedirectLoop, "redirect loop through %s", current)
+		}
+		visited[current] = true
+
+		next, err := s.expand(ctx, current)
+		if err != nil {
+			return "", invalidDestination(policy.CodeShortenerChain, "cannot expand %s: %v", current, err)
+		}
+		// Сокращатель может вести на наш же сервис: такой адрес заменяется целью нашей
+		// ссылки, и петли через него ищутся так же, как для прямых ссылок
+		resolved, own, err := s.resolveOwnDomain(ctx, next)
+		if err != nil {
+			return "", err
+		}
+		if own {
+			current = resolved
+			continue
+		}
+		// Каждый промежуточный адрес проходит ту же политику, что и исходный
+		if current, err = s.policy.Check(ctx, next); err != nil {
+			return "", err
+		}
+	}
+	return "", invalidDestination(policy.CodeShortenerChain, "shortener chain is longer than %d hops", s.chain.MaxHops)
+}
+
+func (s *URLService) expand(ctx context.Context, raw string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, raw, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.chain.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+
+	location := resp.Header.Get("Location")
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 || location == "" {
+		return "", fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	next, err := resp.Request.URL.Parse(location)
+	if err != nil {
+		return "", err
+	}
+	return next.String(), nil
+}
+
+// matchHost сравнивает хост URL со списком; запись без порта совпадает с любым портом
+func matchHost(u *url.URL, hosts []string) bool {
+	host := strings.ToLower(u.Host)
+	hostname := strings.ToLower(u.Hostname())
+	for _, h := range hosts {
+		h = strings.ToLower(h)
+		if h == host || h == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+func invalidDestination(code, format string, args ...interface{}) error {
+	return &policy.ValidationError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
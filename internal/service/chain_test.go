@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+)
+
+// redirectTransport отвечает редиректом по заранее заданной таблице
+type redirectTransport map[string]string
+
+func (rt redirectTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp := &http.Response{StatusCode: http.StatusOK, Header: make(http.Header), Body: http.NoBody, Request: req}
+	if location, ok := rt[req.URL.String()]; ok {
+		resp.StatusCode = http.StatusMovedPermanently
+		resp.Header.Set("Location", location)
+	}
+	return resp, nil
+}
+
+func TestCreateShortURL_OwnDomain(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Original: "https://example.com/page", Short: "abc123", CreatedAt: time.Now()})
+	svc := newTestService(repo, WithChainPolicy(ChainConfig{OwnDomains: []string{"localhost:8080", "sho.rt"}}))
+
+	resp, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "http://localhost:8080/abc123"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.ShortURL != "abc123" {
+		t.Fatalf("expected own-domain link to resolve to existing code, got %q", resp.ShortURL)
+	}
+
+	var verr *policy.ValidationError
+	if _, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://SHO.RT/missing"}); !errors.As(err, &verr) || verr.Code != policy.CodeRedirectLoop {
+		t.Fatalf("expected redirect loop error for unknown code, got %v", err)
+	}
+
+	// Старые данные могут уже содержать петлю
+	_ = repo.Create(ctx, &models.URL{Id: "loop1", Original: "https://sho.rt/loop2", Short: "loop1", CreatedAt: time.Now()})
+	_ = repo.Create(ctx, &models.URL{Id: "loop2", Original: "https://sho.rt/loop1", Short: "loop2", CreatedAt: time.Now()})
+	if _, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://sho.rt/loop1"}); !errors.As(err, &verr) || verr.Code != policy.CodeRedirectLoop {
+		t.Fatalf("expected redirect loop error, got %v", err)
+	}
+}
+
+func TestCreateShortURL_ShortenerChain(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo, WithChainPolicy(ChainConfig{ShortenerHosts: []string{"bit.ly"}}))
+
+	var verr *policy.ValidationError
+	if _, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://bit.ly/xyz"}); !errors.As(err, &verr) || verr.Code != policy.CodeShortenerChain {
+		t.Fatalf("expected shortener chain error, got %v", err)
+	}
+
+	client := &http.Client{
+		Transport: redirectTransport{
+			"https://bit.ly/xyz":   "https://bit.ly/inner",
+			"https://bit.ly/inner": "https://example.com/final",
+			"https://bit.ly/evil":  "http://169.254.169.254/",
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	svc = newTestService(repo, WithChainPolicy(ChainConfig{
+		ShortenerHosts: []string{"bit.ly"},
+		Mode:           ChainExpand,
+		Client:         client,
+	}))
+
+	if _, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://bit.ly/xyz"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if repo.originalToURL["https://example.com/final"] == nil {
+		t.Fatalf("expected expanded destination to be stored")
+	}
+	if _, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://bit.ly/evil"}); !errors.As(err, &verr) || verr.Code != policy.CodePrivateAddress {
+		t.Fatalf("expected private address error after expansion, got %v", err)
+	}
+}
+
+func TestCreateShortURL_ShortenerToOwnDomain(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Original: "https://example.com/page", Short: "abc123", CreatedAt: time.Now()})
+	_ = repo.Create(ctx, &models.URL{Id: "loop1", Original: "https://bit.ly/loop", Short: "loop1", CreatedAt: time.Now()})
+	client := &http.Client{
+		Transport: redirectTransport{
+			"https://bit.ly/own":  "https://sho.rt/abc123",
+			"https://bit.ly/loop": "https://sho.rt/loop1",
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	svc := newTestService(repo, WithChainPolicy(ChainConfig{
+		OwnDomains:     []string{"sho.rt"},
+		ShortenerHosts: []string{"bit.ly"},
+		Mode:           ChainExpand,
+		Client:         client,
+	}))
+
+	resp, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://bit.ly/own"})
+	if err != nil || resp.ShortURL != "abc123" {
+		t.Fatalf("expected shortener to our link to resolve to its destination, got %+v, %v", resp, err)
+	}
+
+	var verr *policy.ValidationError
+	if _, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://bit.ly/loop"}); !errors.As(err, &verr) || verr.Code != policy.CodeRedirectLoop {
+		t.Fatalf("expected redirect loop through shortener, got %v", err)
+	}
+}
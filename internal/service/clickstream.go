@@ -0,0 +1,62 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"urlcutter/internal/models"
+	"urlcutter/internal/pubsub"
+)
+
+// WithClickStream включает раздачу переходов подписчикам в реальном времени
+func WithClickStream(b *pubsub.Broker) Option {
+	return func(s *URLService) {
+		s.clicks = b
+	}
+}
+
+// SubscribeClicks подписывает владельца на переходы по его ссылке; чужая ссылка
+// неотличима от несуществующей
+func (s *URLService) SubscribeClicks(ctx context.Context, owner, domain, short string) (*pubsub.Subscription, error) {
+	if s.clicks == nil {
+		return nil, fmt.Errorf("click stream is not configured")
+	}
+	if owner == "" {
+		return nil, fmt.Errorf("owner is required")
+	}
+	link, err := s.findLink(ctx, domain, short)
+	if err != nil {
+		return nil, err
+	}
+	if link == nil || link.Owner != owner {
+		return nil, fmt.Errorf("URL not found")
+	}
+	return s.clicks.Subscribe(linkTopic(link.Domain, link.Short)), nil
+}
+
+// SubscribeOwnerClicks подписывает на переходы по всем ссылкам владельца
+func (s *URLService) SubscribeOwnerClicks(ctx context.Context, owner string) (*pubsub.Subscription, error) {
+	if s.clicks == nil {
+		return nil, fmt.Errorf("click stream is not configured")
+	}
+	if owner == "" {
+		return nil, fmt.Errorf("owner is required")
+	}
+	return s.clicks.Subscribe(ownerTopic(owner)), nil
+}
+
+// publishClick отправляет переход подписчикам ссылки и её владельца
+func (s *URLService) publishClick(owner string, event *models.ClickEvent) {
+	if s.clicks == nil {
+		return
+	}
+	s.clicks.Publish(linkTopic(event.Domain, event.Short), *event)
+	s.clicks.Publish(ownerTopic(owner), *event)
+}
+
+func linkTopic(domain, short string) string {
+	return "link:" + domain + "/" + short
+}
+
+func ownerTopic(owner string) string {
+	return "owner:" + owner
+}
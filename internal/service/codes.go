@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"log"
+	"urlcutter/internal/keygen"
+	"urlcutter/pkg/shortener"
+)
+
+// maxCreateAttempts — сколько кодов пробует create, прежде чем вернуть ErrCodeTaken
+const maxCreateAttempts = 5
+
+// WithCodePool включает выдачу кодов из заранее сгенерированного пула
+func WithCodePool(p *keygen.Pool) Option {
+	return func(s *URLService) {
+		s.codes = p
+	}
+}
+
+func (s *URLService) nextCode(ctx context.Context) (string, error) {
+	if s.codes == nil {
+		return shortener.GenerateShortURL()
+	}
+	return s.codes.Next(ctx)
+}
+
+// consumeCode убирает код созданной ссылки из пула. Если это не удалось, код будет
+// удалён при возврате резерва.
+func (s *URLService) consumeCode(ctx context.Context, code string) {
+	if s.codes == nil {
+		return
+	}
+	if err := s.codes.Consume(context.WithoutCancel(ctx), code); err != nil {
+		log.Printf("Failed to consume code %s: %v", code, err)
+	}
+}
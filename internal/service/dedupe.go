@@ -0,0 +1,45 @@
+package service
+
+import (
+	"context"
+	"urlcutter/internal/models"
+	"urlcutter/pkg/canonical"
+)
+
+type DedupeConfig struct {
+	// Canonical задаёт правила канонизации, например удаление utm-параметров
+	Canonical canonical.Options
+}
+
+// WithDedupe настраивает поиск уже сокращённых URL
+func WithDedupe(cfg DedupeConfig) Option {
+	return func(s *URLService) {
+		s.dedupe = cfg
+	}
+}
+
+// findDuplicate возвращает ссылку owner на тот же адрес на домене domain и каноническую
+// форму original. Дубликаты ищутся только среди ссылок того же владельца: чужая ссылка
+// могла бы пропасть или поменять настройки без его ведома.
+func (s *URLService) findDuplicate(ctx context.Context, domain, owner, original string) (*models.URL, string, error) {
+	key, err := canonical.Canonicalize(original, s.dedupe.Canonical)
+	if err != nil {
+		return nil, "", err
+	}
+
+	existing, err := s.repo.FindDuplicate(ctx, domain, key, original, owner)
+	if err != nil {
+		return nil, "", err
+	}
+	return existing, key, nil
+}
+
+// hasLinkOptions сообщает, что у ссылки есть собственные настройки перехода. Такая ссылка
+// не выдаётся вместо новой и сама не заменяется существующей: иначе запрос получил бы
+// ссылку с другим статусом, метками, правилами или расписанием.
+func hasLinkOptions(link *models.URL) bool {
+	return link.RedirectType != 0 || link.ForwardQuery || link.ForwardPath || link.UTM != (models.UTM{}) ||
+		len(link.Rules) > 0 || len(link.Variants) > 0 || link.StickyVariants || link.Interstitial ||
+		link.NotBefore != nil || link.NotAfter != nil || link.FallbackURL != "" ||
+		link.Social != (models.SocialOverride{})
+}
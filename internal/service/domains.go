@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+
+	"golang.org/x/net/idna"
+)
+
+const (
+	CodeInvalidDomain = "invalid_domain"
+	CodeUnknownDomain = "unknown_domain"
+	CodeDomainTaken   = "domain_taken"
+)
+
+// AddDomain подключает брендированный домен владельца. Один хост может принадлежать
+// только одному владельцу.
+func (s *URLService) AddDomain(ctx context.Context, owner, host string) (*models.Domain, error) {
+	normalized, err := normalizeDomain(host)
+	if err != nil {
+		return nil, &policy.ValidationError{Code: CodeInvalidDomain, Message: err.Error()}
+	}
+
+	existing, err := s.repo.FindDomain(ctx, normalized)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, &policy.ValidationError{Code: CodeDomainTaken, Message: fmt.Sprintf("domain %s is already registered", normalized)}
+	}
+
+	domain := &models.Domain{Host: normalized, Owner: owner, CreatedAt: s.now()}
+	if err := s.repo.CreateDomain(ctx, domain); err != nil {
+		return nil, err
+	}
+	return domain, nil
+}
+
+func (s *URLService) ListDomains(ctx context.Context, owner string) ([]*models.Domain, error) {
+	domains, err := s.repo.ListDomains(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	if domains == nil {
+		domains = []*models.Domain{}
+	}
+	return domains, nil
+}
+
+// ownedDomain проверяет, что владелец может создавать ссылки на домене host;
+// пустой host — домен сервиса по умолчанию
+func (s *URLService) ownedDomain(ctx context.Context, owner, host string) (string, error) {
+	if host == "" {
+		return "", nil
+	}
+	normalized, err := normalizeDomain(host)
+	if err != nil {
+		return "", &policy.ValidationError{Code: CodeInvalidDomain, Message: err.Error()}
+	}
+
+	domain, err := s.repo.FindDomain(ctx, normalized)
+	if err != nil {
+		return "", err
+	}
+	if domain == nil || domain.Owner != owner {
+		return "", &policy.ValidationError{Code: CodeUnknownDomain, Message: fmt.Sprintf("domain %s is not registered for this workspace", normalized)}
+	}
+	return domain.Host, nil
+}
+
+// requestDomain определяет домен ссылок по хосту запроса: зарегистрированный домен
+// или домен по умолчанию для всех остальных хостов
+func (s *URLService) requestDomain(ctx context.Context, host string) (string, error) {
+	if host == "" {
+		return "", nil
+	}
+	normalized, err := normalizeDomain(host)
+	if err != nil {
+		return "", nil
+	}
+
+	domain, err := s.repo.FindDomain(ctx, normalized)
+	if err != nil || domain == nil {
+		return "", err
+	}
+	return domain.Host, nil
+}
+
+// normalizeDomain приводит хост к виду, в котором он хранится: нижний регистр,
+// punycode, без порта и завершающей точки
+func normalizeDomain(host string) (string, error) {
+	host = strings.TrimSpace(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" || strings.ContainsAny(host, "/?#@ ") {
+		return "", fmt.Errorf("invalid domain %q", host)
+	}
+
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil || !strings.Contains(ascii, ".") {
+		return "", fmt.Errorf("invalid domain %q", host)
+	}
+	return ascii, nil
+}
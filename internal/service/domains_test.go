@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+)
+
+func TestAddDomain(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo)
+
+	domain, err := svc.AddDomain(ctx, "ws1", "Go.Brand.Example.")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if domain.Host != "go.brand.example" || domain.Owner != "ws1" {
+		t.Fatalf("unexpected domain: %+v", domain)
+	}
+
+	for host, code := range map[string]string{
+		"go.brand.example": CodeDomainTaken,
+		"localhost":        CodeInvalidDomain,
+		"brand.example/x":  CodeInvalidDomain,
+	} {
+		var validationErr *policy.ValidationError
+		if _, err := svc.AddDomain(ctx, "ws2", host); !errors.As(err, &validationErr) || validationErr.Code != code {
+			t.Fatalf("%s: expected %s, got %v", host, code, err)
+		}
+	}
+}
+
+func TestCreateShortURL_Domain(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo)
+	if _, err := svc.AddDomain(ctx, "ws1", "go.brand.example"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := svc.CreateShortURL(ctx, "ws1", &models.CreateURLRequest{URL: "https://example.com", Domain: "go.brand.example"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Domain != "go.brand.example" {
+		t.Fatalf("expected link on brand domain, got %+v", resp)
+	}
+
+	// Дубликаты ищутся только на том же домене
+	plain, err := svc.CreateShortURL(ctx, "ws1", &models.CreateURLRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if plain.Domain != "" || plain.ShortURL == resp.ShortURL {
+		t.Fatalf("expected separate link on default domain, got %+v", plain)
+	}
+
+	var validationErr *policy.ValidationError
+	_, err = svc.CreateShortURL(ctx, "ws2", &models.CreateURLRequest{URL: "https://example.com", Domain: "go.brand.example"})
+	if !errors.As(err, &validationErr) || validationErr.Code != CodeUnknownDomain {
+		t.Fatalf("expected unknown_domain for foreign domain, got %v", err)
+	}
+}
+
+func TestRedirect_HostRouting(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo)
+	if _, err := svc.AddDomain(ctx, "ws1", "go.brand.example"); err != nil {
+		t.Fatal(err)
+	}
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Short: "abc123", Original: "https://default.example", CreatedAt: time.Now()})
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Short: "abc123", Domain: "go.brand.example", Original: "https://brand.example", CreatedAt: time.Now()})
+
+	for host, want := range map[string]string{
+		"localhost:8080":       "https://default.example",
+		"go.brand.example":     "https://brand.example",
+		"GO.brand.example:443": "https://brand.example",
+		"unknown.example":      "https://default.example",
+	} {
+		target, err := svc.Redirect(ctx, &models.RedirectRequest{Short: "abc123", Host: host})
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", host, err)
+		}
+		if target.Location != want {
+			t.Fatalf("%s: expected %s, got %s", host, want, target.Location)
+		}
+	}
+
+	if repo.shortToURL["go.brand.example/abc123"].Clicks != 2 || repo.shortToURL["abc123"].Clicks != 2 {
+		t.Fatalf("expected clicks counted per domain")
+	}
+	byDomain := make(map[string]int)
+	for _, e := range repo.clicks {
+		byDomain[e.Domain]++
+	}
+	if byDomain[""] != 2 || byDomain["go.brand.example"] != 2 {
+		t.Fatalf("expected click events per domain, got %v", byDomain)
+	}
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+	"urlcutter/internal/health"
+	"urlcutter/internal/models"
+)
+
+const (
+	// healthHistoryLimit — сколько последних проверок ссылки отдаёт история
+	healthHistoryLimit = 50
+	// healthRetention — сколько хранится история проверок
+	healthRetention = 30 * 24 * time.Hour
+)
+
+// WithHealthChecker включает периодическую проверку доступности адресов назначения
+func WithHealthChecker(c *health.Checker) Option {
+	return func(s *URLService) {
+		s.health = c
+	}
+}
+
+// CheckHealth проверяет адреса назначения всех активных ссылок и возвращает число
+// неработающих. Проверки старше healthRetention удаляются из истории.
+func (s *URLService) CheckHealth(ctx context.Context) (int, error) {
+	if s.health == nil {
+		return 0, fmt.Errorf("health checks are not configured")
+	}
+
+	links, err := s.repo.ListActive(ctx)
+	if err != nil {
+		return 0, err
+	}
+	targets := make([]health.Target, 0, len(links))
+	for _, link := range links {
+		targets = append(targets, health.Target{Domain: link.Domain, Short: link.Short, URL: link.Original})
+	}
+
+	var mu sync.Mutex
+	broken := 0
+	s.health.CheckAll(ctx, targets, func(_ health.Target, result *models.HealthCheck) {
+		mu.Lock()
+		defer mu.Unlock()
+		if result.Broken {
+			broken++
+		}
+		if err := s.repo.RecordHealthCheck(ctx, result); err != nil {
+			log.Printf("Failed to record health check for %s: %v", result.Short, err)
+		}
+	})
+
+	if _, err := s.repo.PruneHealthChecks(ctx, s.now().Add(-healthRetention)); err != nil {
+		log.Printf("Failed to prune health history: %v", err)
+	}
+	return broken, nil
+}
+
+// WatchHealth запускает CheckHealth каждые interval, пока не вызван stop
+func (s *URLService) WatchHealth(interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				broken, err := s.CheckHealth(ctx)
+				if err != nil {
+					log.Printf("Failed to check links: %v", err)
+					continue
+				}
+				log.Printf("Link health check finished, %d broken", broken)
+			}
+		}
+	}()
+	return cancel
+}
+
+// BrokenLinks возвращает ссылки владельца, последняя проверка которых не прошла
+func (s *URLService) BrokenLinks(ctx context.Context, owner string) ([]*models.URL, error) {
+	links, err := s.repo.ListBroken(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	if links == nil {
+		links = []*models.URL{}
+	}
+	return links, nil
+}
+
+// HealthHistory возвращает последние проверки ссылки, новые первыми
+func (s *URLService) HealthHistory(ctx context.Context, domain, short string) ([]models.HealthCheck, error) {
+	link, err := s.findLink(ctx, domain, short)
+	if err != nil {
+		return nil, err
+	}
+	if link == nil {
+		return nil, fmt.Errorf("URL not found")
+	}
+
+	checks, err := s.repo.HealthHistory(ctx, link.Domain, short, healthHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+	if checks == nil {
+		checks = []models.HealthCheck{}
+	}
+	return checks, nil
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"urlcutter/internal/health"
+	"urlcutter/internal/models"
+)
+
+func TestCheckHealth(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			w.WriteHeader(http.StatusGone)
+		}
+	}))
+	defer srv.Close()
+
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "ok1111", Short: "ok1111", Owner: "ws1", Original: srv.URL + "/page", CreatedAt: time.Now()})
+	_ = repo.Create(ctx, &models.URL{Id: "bad111", Short: "bad111", Owner: "ws1", Original: srv.URL + "/gone", CreatedAt: time.Now()})
+	checker := health.NewChecker(health.Config{AllowPrivate: true, Concurrency: 1, HostDelay: time.Millisecond})
+	svc := newTestService(repo, WithHealthChecker(checker))
+
+	broken, err := svc.CheckHealth(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if broken != 1 {
+		t.Fatalf("expected 1 broken link, got %d", broken)
+	}
+
+	links, _ := svc.BrokenLinks(ctx, "ws1")
+	if len(links) != 1 || links[0].Short != "bad111" || links[0].Health.StatusCode != http.StatusGone {
+		t.Fatalf("unexpected broken links: %+v", links)
+	}
+	if links, _ := svc.BrokenLinks(ctx, "ws2"); len(links) != 0 {
+		t.Fatalf("expected no broken links for other owner")
+	}
+
+	// Проверки старше срока хранения удаляются после очередного прохода
+	repo.healthChecks = append(repo.healthChecks, models.HealthCheck{Short: "ok1111", CheckedAt: time.Now().Add(-healthRetention - time.Hour)})
+	if _, err := svc.CheckHealth(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	history, err := svc.HealthHistory(ctx, "", "ok1111")
+	if err != nil || len(history) != 2 || history[0].StatusCode != http.StatusOK {
+		t.Fatalf("unexpected history: %+v, %v", history, err)
+	}
+	if _, err := svc.HealthHistory(ctx, "", "missing"); err == nil {
+		t.Fatalf("expected error for missing link")
+	}
+}
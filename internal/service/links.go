@@ -0,0 +1,51 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"urlcutter/internal/models"
+)
+
+// WithBaseURL задаёт публичный адрес сервиса, например "https://sho.rt", из которого
+// строятся абсолютные адреса ссылок в ответах API. Ссылки брендированных доменов
+// строятся от своего домена с той же схемой.
+func WithBaseURL(base string) Option {
+	return func(s *URLService) {
+		s.baseURL = strings.TrimSuffix(base, "/")
+	}
+}
+
+// linkURLs собирает абсолютные адреса ссылки, её QR-кода и статистики
+func (s *URLService) linkURLs(domain, short string) models.LinkURLs {
+	if s.baseURL == "" {
+		return models.LinkURLs{}
+	}
+
+	origin := s.baseURL
+	query := ""
+	if domain != "" {
+		scheme := "https"
+		if parsed, err := url.Parse(s.baseURL); err == nil && parsed.Scheme != "" {
+			scheme = parsed.Scheme
+		}
+		origin = scheme + "://" + domain
+		query = "?domain=" + url.QueryEscape(domain)
+	}
+
+	api := fmt.Sprintf("%s/api/v1/url/%s", s.baseURL, url.PathEscape(short))
+	return models.LinkURLs{
+		ShortLink: origin + "/" + url.PathEscape(short),
+		QRURL:     api + "/qr" + query,
+		StatsURL:  api + "/stats" + query,
+	}
+}
+
+// createResponse — ответ на создание для новой или уже существующей ссылки
+func (s *URLService) createResponse(link *models.URL) *models.CreateURLResponse {
+	return &models.CreateURLResponse{
+		ShortURL: link.Short,
+		Domain:   link.Domain,
+		LinkURLs: s.linkURLs(link.Domain, link.Short),
+	}
+}
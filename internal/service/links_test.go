@@ -0,0 +1,64 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"urlcutter/internal/models"
+)
+
+func TestCreateShortURL_LinkURLs(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo, WithBaseURL("https://sho.rt/"))
+	if _, err := svc.AddDomain(ctx, "ws1", "go.brand.example"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := svc.CreateShortURL(ctx, "ws1", &models.CreateURLRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want := models.LinkURLs{
+		ShortLink: "https://sho.rt/" + resp.ShortURL,
+		QRURL:     "https://sho.rt/api/v1/url/" + resp.ShortURL + "/qr",
+		StatsURL:  "https://sho.rt/api/v1/url/" + resp.ShortURL + "/stats",
+	}
+	if resp.LinkURLs != want {
+		t.Fatalf("expected %+v, got %+v", want, resp.LinkURLs)
+	}
+
+	branded, err := svc.CreateShortURL(ctx, "ws1", &models.CreateURLRequest{URL: "https://example.com", Domain: "go.brand.example"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if branded.ShortLink != "https://go.brand.example/"+branded.ShortURL {
+		t.Fatalf("expected link on brand domain, got %s", branded.ShortLink)
+	}
+	if branded.StatsURL != "https://sho.rt/api/v1/url/"+branded.ShortURL+"/stats?domain=go.brand.example" {
+		t.Fatalf("unexpected stats url %s", branded.StatsURL)
+	}
+
+	// Повторное создание возвращает те же адреса
+	again, _ := svc.CreateShortURL(ctx, "ws1", &models.CreateURLRequest{URL: "https://example.com"})
+	if again.ShortLink != resp.ShortLink {
+		t.Fatalf("expected duplicate to reuse link %s, got %s", resp.ShortLink, again.ShortLink)
+	}
+
+	info, err := svc.GetURLInfo(ctx, "", resp.ShortURL)
+	if err != nil || info.ShortLink != resp.ShortLink {
+		t.Fatalf("expected short link in info, got %+v, %v", info, err)
+	}
+}
+
+func TestCreateShortURL_NoBaseURL(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(newMockRepository())
+
+	resp, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.LinkURLs != (models.LinkURLs{}) {
+		t.Fatalf("expected no absolute urls without base url, got %+v", resp.LinkURLs)
+	}
+}
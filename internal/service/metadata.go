@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"urlcutter/internal/metadata"
+	"urlcutter/internal/models"
+)
+
+const (
+	defaultMetadataWorkers   = 4
+	defaultMetadataQueueSize = 1000
+)
+
+type MetadataConfig struct {
+	Fetcher *metadata.Fetcher
+	// Workers — сколько страниц загружается одновременно
+	Workers int
+	// QueueSize — сколько ссылок может ждать загрузки; при переполнении новые пропускаются
+	QueueSize int
+}
+
+// metadataQueue — очередь ссылок, для которых нужно загрузить страницу назначения;
+// её разбирают обработчики, запущенные WatchMetadata
+type metadataQueue struct {
+	cfg  MetadataConfig
+	jobs chan metadataJob
+}
+
+type metadataJob struct {
+	domain, short string
+}
+
+// WithMetadata включает фоновый сбор заголовка, описания и картинок страницы назначения
+// для новых ссылок; загрузку запускает WatchMetadata
+func WithMetadata(cfg MetadataConfig) Option {
+	return func(s *URLService) {
+		if cfg.Workers == 0 {
+			cfg.Workers = defaultMetadataWorkers
+		}
+		if cfg.QueueSize == 0 {
+			cfg.QueueSize = defaultMetadataQueueSize
+		}
+		s.metadata = &metadataQueue{cfg: cfg, jobs: make(chan metadataJob, cfg.QueueSize)}
+	}
+}
+
+// enqueueMetadata ставит ссылку в очередь, не задерживая создание
+func (s *URLService) enqueueMetadata(link *models.URL) {
+	if s.metadata == nil {
+		return
+	}
+	select {
+	case s.metadata.jobs <- metadataJob{domain: link.Domain, short: link.Short}:
+	default:
+		log.Printf("Metadata queue is full, skipping %s", link.Short)
+	}
+}
+
+// WatchMetadata запускает Workers обработчиков очереди, пока не вызван stop. stop
+// прерывает начатые загрузки и ждёт завершения обработчиков; ссылки, оставшиеся в
+// очереди, разберёт следующий запуск.
+func (s *URLService) WatchMetadata() (stop func()) {
+	if s.metadata == nil {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for i := 0; i < s.metadata.cfg.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.metadataWorker(ctx)
+		}()
+	}
+	return func() {
+		cancel()
+		wg.Wait()
+	}
+}
+
+func (s *URLService) metadataWorker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case job := <-s.metadata.jobs:
+			if err := s.CaptureMetadata(ctx, job.domain, job.short); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to capture metadata for %s: %v", job.short, err)
+			}
+		}
+	}
+}
+
+// CaptureMetadata загружает страницу назначения ссылки и сохраняет её метаданные.
+// Ошибка загрузки сохраняется в ссылке вместе с ранее собранными данными. link.updated
+// отправляется, только если метаданные или ошибка изменились.
+func (s *URLService) CaptureMetadata(ctx context.Context, domain, short string) error {
+	if s.metadata == nil {
+		return fmt.Errorf("metadata capture is not configured")
+	}
+	link, err := s.repo.FindByShort(ctx, domain, short)
+	if err != nil {
+		return err
+	}
+	if link == nil {
+		return fmt.Errorf("URL not found")
+	}
+
+	before := link.Metadata
+	meta, fetchErr := s.metadata.cfg.Fetcher.Fetch(ctx, link.Original)
+	if fetchErr != nil {
+		copied := before
+		meta = &copied
+		meta.Error = fetchErr.Error()
+	}
+	fetched := s.now()
+	meta.FetchedAt = &fetched
+
+	link.Metadata = *meta
+	var events []*models.WebhookEvent
+	if metadataChanged(before, *meta) {
+		events = s.linkEvents(models.EventLinkUpdated, link)
+	}
+	if err := s.repo.UpdateMetadata(ctx, domain, short, meta, events...); err != nil {
+		return err
+	}
+	return fetchErr
+}
+
+// metadataChanged сравнивает метаданные без времени попытки
+func metadataChanged(before, after models.LinkMetadata) bool {
+	before.FetchedAt, after.FetchedAt = nil, nil
+	return before != after
+}
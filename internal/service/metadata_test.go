@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	"urlcutter/internal/metadata"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+)
+
+func TestCaptureMetadata(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			http.Error(w, "gone", http.StatusGone)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Example page</title><meta property="og:image" content="/cover.png"></head></html>`))
+	}))
+	defer srv.Close()
+
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Short: "abc123", Original: srv.URL + "/page", CreatedAt: time.Now()})
+	_ = repo.Create(ctx, &models.URL{Id: "old111", Short: "old111", Original: srv.URL + "/gone", CreatedAt: time.Now(),
+		Metadata: models.LinkMetadata{Title: "Previous title"}})
+
+	fetcher := metadata.NewFetcher(metadata.Config{Policy: policy.New(policy.Config{AllowPrivate: true}), AllowPrivate: true})
+	svc := newTestService(repo, WithMetadata(MetadataConfig{Fetcher: fetcher}))
+
+	if err := svc.CaptureMetadata(ctx, "", "abc123"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	meta := repo.shortToURL["abc123"].Metadata
+	if meta.Title != "Example page" || meta.Image != srv.URL+"/cover.png" || meta.FetchedAt == nil {
+		t.Fatalf("unexpected metadata: %+v", meta)
+	}
+
+	if err := svc.CaptureMetadata(ctx, "", "old111"); err == nil {
+		t.Fatalf("expected fetch error")
+	}
+	meta = repo.shortToURL["old111"].Metadata
+	if meta.Error == "" || meta.Title != "Previous title" || meta.FetchedAt == nil {
+		t.Fatalf("expected error recorded with previous metadata kept, got %+v", meta)
+	}
+
+	info, _ := svc.GetURLInfo(ctx, "", "abc123")
+	if info.Metadata.Title != "Example page" {
+		t.Fatalf("expected metadata in info, got %+v", info.Metadata)
+	}
+}
+
+func TestCaptureMetadata_EventOnlyOnChange(t *testing.T) {
+	ctx := context.Background()
+	title := "First"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/gone" {
+			http.Error(w, "gone", http.StatusGone)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>` + title + `</title></head></html>`))
+	}))
+	defer srv.Close()
+
+	repo := newMockRepository()
+	_ = repo.CreateWebhook(ctx, &models.Webhook{ID: "all", Owner: "acme", URL: "https://hooks.example.com", Events: webhookEvents})
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Short: "abc123", Owner: "acme", Original: srv.URL + "/page"})
+	_ = repo.Create(ctx, &models.URL{Id: "old111", Short: "old111", Owner: "acme", Original: srv.URL + "/gone"})
+
+	fetcher := metadata.NewFetcher(metadata.Config{Policy: policy.New(policy.Config{AllowPrivate: true}), AllowPrivate: true})
+	svc := newTestService(repo, WithMetadata(MetadataConfig{Fetcher: fetcher}), WithWebhooks(WebhookConfig{}))
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc.now = func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+
+	capture := func(short string) {
+		_ = svc.CaptureMetadata(ctx, "", short)
+	}
+	capture("abc123")
+	capture("abc123")
+	title = "Second"
+	capture("abc123")
+	capture("old111")
+	capture("old111")
+
+	if len(repo.outbox) != 3 {
+		t.Fatalf("expected events for two title changes and the first failure, got %d", len(repo.outbox))
+	}
+	if repo.shortToURL["abc123"].Metadata.FetchedAt == nil {
+		t.Fatalf("expected attempt time stored without an event")
+	}
+}
+
+// notifyingRepository сообщает о каждом сохранении метаданных
+type notifyingRepository struct {
+	*mockRepository
+	updated chan string
+}
+
+func (r *notifyingRepository) UpdateMetadata(ctx context.Context, domain, short string, meta *models.LinkMetadata, events ...*models.WebhookEvent) error {
+	err := r.mockRepository.UpdateMetadata(ctx, domain, short, meta, events...)
+	r.updated <- short
+	return err
+}
+
+func TestWatchMetadata(t *testing.T) {
+	ctx := context.Background()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Example page</title></head></html>`))
+	}))
+	defer srv.Close()
+
+	repo := &notifyingRepository{mockRepository: newMockRepository(), updated: make(chan string, 1)}
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Short: "abc123", Original: srv.URL})
+	fetcher := metadata.NewFetcher(metadata.Config{Policy: policy.New(policy.Config{AllowPrivate: true}), AllowPrivate: true})
+	svc := newTestService(repo, WithMetadata(MetadataConfig{Fetcher: fetcher, Workers: 1}))
+
+	// Ссылка ждёт в очереди, пока обработчики не запущены
+	svc.enqueueMetadata(&models.URL{Short: "abc123"})
+	stop := svc.WatchMetadata()
+	select {
+	case <-repo.updated:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected queued link to be captured")
+	}
+	stop()
+
+	if title := repo.shortToURL["abc123"].Metadata.Title; title != "Example page" {
+		t.Fatalf("unexpected captured title %q", title)
+	}
+}
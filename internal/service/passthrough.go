@@ -0,0 +1,49 @@
+package service
+
+import (
+	"net/url"
+	"path"
+	"strings"
+	"urlcutter/internal/models"
+)
+
+// applyPassthrough дописывает к целевому URL путь и query перехода, если ссылка это разрешает.
+// При совпадении имён параметров приоритет у параметров целевого URL.
+func applyPassthrough(link *models.URL, destination string, req *models.RedirectRequest) (string, error) {
+	if (!link.ForwardPath || req.Rest == "") && (!link.ForwardQuery || req.RawQuery == "") {
+		return destination, nil
+	}
+
+	target, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	if link.ForwardPath && req.Rest != "" {
+		// Clean не даёт выйти за пределы пути ссылки через ..
+		rest := path.Clean("/" + req.Rest)
+		target.Path = strings.TrimSuffix(target.Path, "/") + rest
+		target.RawPath = ""
+	}
+
+	if link.ForwardQuery && req.RawQuery != "" {
+		// ParseQuery возвращает все разобранные пары вместе с ошибкой первой неразобранной:
+		// битые пары (?a=%zz) отбрасываются, а переход не ломается
+		incoming, _ := url.ParseQuery(req.RawQuery)
+		existing := target.Query()
+		extra := url.Values{}
+		for key, values := range incoming {
+			if _, ok := existing[key]; !ok {
+				extra[key] = values
+			}
+		}
+		if len(extra) > 0 {
+			if target.RawQuery != "" {
+				target.RawQuery += "&"
+			}
+			target.RawQuery += extra.Encode()
+		}
+	}
+
+	return target.String(), nil
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+	"urlcutter/internal/models"
+)
+
+func TestRedirect_Passthrough(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "fwd", Short: "fwd", Original: "https://example.com/base/?ref=link&a=1", CreatedAt: time.Now(),
+		ForwardQuery: true, ForwardPath: true})
+	_ = repo.Create(ctx, &models.URL{Id: "plain", Short: "plain", Original: "https://example.com/page", CreatedAt: time.Now()})
+	svc := newTestService(repo)
+
+	cases := []struct {
+		req      models.RedirectRequest
+		location string
+	}{
+		{models.RedirectRequest{Short: "fwd"}, "https://example.com/base/?ref=link&a=1"},
+		{models.RedirectRequest{Short: "fwd", RawQuery: "utm_source=x&ref=visitor"}, "https://example.com/base/?ref=link&a=1&utm_source=x"},
+		{models.RedirectRequest{Short: "fwd", RawQuery: "bad=%zz&utm_source=x"}, "https://example.com/base/?ref=link&a=1&utm_source=x"},
+		{models.RedirectRequest{Short: "fwd", RawQuery: "%zz"}, "https://example.com/base/?ref=link&a=1"},
+		{models.RedirectRequest{Short: "fwd", Rest: "docs/intro"}, "https://example.com/base/docs/intro?ref=link&a=1"},
+		{models.RedirectRequest{Short: "fwd", Rest: "../../etc"}, "https://example.com/base/etc?ref=link&a=1"},
+		{models.RedirectRequest{Short: "plain", RawQuery: "utm_source=x"}, "https://example.com/page"},
+	}
+	for _, c := range cases {
+		target, err := svc.Redirect(ctx, &c.req)
+		if err != nil {
+			t.Fatalf("%+v: unexpected error: %v", c.req, err)
+		}
+		if target.Location != c.location {
+			t.Errorf("%+v: expected %s, got %s", c.req, c.location, target.Location)
+		}
+	}
+
+	if _, err := svc.Redirect(ctx, &models.RedirectRequest{Short: "plain", Rest: "extra"}); err == nil {
+		t.Fatalf("expected not found for path on link without forward_path")
+	}
+}
@@ -0,0 +1,48 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"urlcutter/internal/models"
+)
+
+// Preview собирает данные для публичной страницы предпросмотра: куда ведёт ссылка, когда её создали
+// и безопасна ли цель по текущим блок-листу и политике
+func (s *URLService) Preview(ctx context.Context, domain, short string) (*models.Preview, error) {
+	link, err := s.findLink(ctx, domain, short)
+	if err != nil {
+		return nil, err
+	}
+	if link == nil {
+		return nil, fmt.Errorf("URL not found")
+	}
+
+	target := currentTarget(link, linkStatus(link, s.now()))
+	destination, err := s.destination(ctx, link, target, &models.RedirectRequest{Short: short})
+	if err != nil {
+		return nil, err
+	}
+
+	preview := &models.Preview{
+		Short:       short,
+		Domain:      link.Domain,
+		Destination: destination,
+		CreatedAt:   link.CreatedAt,
+		Safety:      models.SafetyOK,
+	}
+
+	if link.Disabled {
+		preview.Safety, preview.SafetyReason = models.SafetyBlocked, link.DisabledReason
+	} else if s.blocklist != nil {
+		if rule, ok := s.matchLink(link); ok {
+			preview.Safety, preview.SafetyReason = models.SafetyBlocked, blocklistReason+rule
+		}
+	}
+	// Политика могла стать строже после создания ссылки
+	if preview.Safety == models.SafetyOK {
+		if _, err := s.policy.Check(ctx, target); err != nil {
+			preview.Safety, preview.SafetyReason = models.SafetyWarning, err.Error()
+		}
+	}
+	return preview, nil
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"urlcutter/internal/policy"
+	"urlcutter/pkg/qr"
+)
+
+const CodeInvalidQR = "invalid_qr"
+
+// qrCacheSize — сколько изображений QR-кодов держать в памяти
+const qrCacheSize = 1024
+
+// qrCache хранит готовые изображения; при переполнении вытесняются самые старые
+type qrCache struct {
+	mu    sync.Mutex
+	items map[string][]byte
+	order []string
+}
+
+func (c *qrCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, ok := c.items[key]
+	return data, ok
+}
+
+func (c *qrCache) put(key string, data []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.items == nil {
+		c.items = make(map[string][]byte)
+	}
+	if _, ok := c.items[key]; ok {
+		return
+	}
+	if len(c.order) >= qrCacheSize {
+		delete(c.items, c.order[0])
+		c.order = c.order[1:]
+	}
+	c.items[key] = data
+	c.order = append(c.order, key)
+}
+
+// QRCode рисует QR-код абсолютного адреса ссылки. origin ("https://host") используется,
+// если публичный адрес сервиса не настроен.
+func (s *URLService) QRCode(ctx context.Context, domain, short, origin, format string, opts qr.Options) ([]byte, error) {
+	if format != qr.PNG && format != qr.SVG {
+		return nil, &policy.ValidationError{Code: CodeInvalidQR, Message: fmt.Sprintf("format must be png or svg, got %q", format)}
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, &policy.ValidationError{Code: CodeInvalidQR, Message: err.Error()}
+	}
+
+	link, err := s.findLink(ctx, domain, short)
+	if err != nil {
+		return nil, err
+	}
+	if link == nil {
+		return nil, fmt.Errorf("URL not found")
+	}
+
+	content := s.linkURLs(link.Domain, link.Short).ShortLink
+	if content == "" {
+		if link.Domain != "" {
+			origin = "https://" + link.Domain
+		}
+		content = origin + "/" + url.PathEscape(link.Short)
+	}
+
+	key := fmt.Sprintf("%s|%s|%d|%s|%d|%s|%s", content, format, opts.Size, opts.Level, opts.Margin,
+		qr.Hex(opts.Foreground), qr.Hex(opts.Background))
+	if data, ok := s.qrCache.get(key); ok {
+		return data, nil
+	}
+
+	data, err := qr.Encode(content, format, opts)
+	if err != nil {
+		return nil, err
+	}
+	s.qrCache.put(key, data)
+	return data, nil
+}
@@ -0,0 +1,63 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+	"urlcutter/pkg/qr"
+)
+
+func TestQRCode(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Short: "abc123", Original: "https://example.com", CreatedAt: time.Now()})
+	svc := newTestService(repo, WithBaseURL("https://sho.rt"))
+
+	first, err := svc.QRCode(ctx, "", "abc123", "http://localhost:8080", qr.PNG, qr.DefaultOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want, _ := qr.Encode("https://sho.rt/abc123", qr.PNG, qr.DefaultOptions())
+	if !bytes.Equal(first, want) {
+		t.Fatalf("expected QR code of the absolute short link")
+	}
+
+	second, _ := svc.QRCode(ctx, "", "abc123", "http://localhost:8080", qr.PNG, qr.DefaultOptions())
+	if &first[0] != &second[0] {
+		t.Fatalf("expected cached image")
+	}
+
+	svg, err := svc.QRCode(ctx, "", "abc123", "", qr.SVG, qr.DefaultOptions())
+	if err != nil || !bytes.HasPrefix(svg, []byte("<svg")) {
+		t.Fatalf("expected svg, got %v", err)
+	}
+
+	if _, err := svc.QRCode(ctx, "", "missing", "", qr.PNG, qr.DefaultOptions()); err == nil {
+		t.Fatalf("expected error for missing link")
+	}
+
+	var validationErr *policy.ValidationError
+	if _, err := svc.QRCode(ctx, "", "abc123", "", "gif", qr.DefaultOptions()); !errors.As(err, &validationErr) || validationErr.Code != CodeInvalidQR {
+		t.Fatalf("expected invalid_qr, got %v", err)
+	}
+}
+
+func TestQRCode_RequestOrigin(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Short: "abc123", Original: "https://example.com", CreatedAt: time.Now()})
+	svc := newTestService(repo)
+
+	got, err := svc.QRCode(ctx, "", "abc123", "http://localhost:8080", qr.SVG, qr.DefaultOptions())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	want, _ := qr.Encode("http://localhost:8080/abc123", qr.SVG, qr.DefaultOptions())
+	if !bytes.Equal(got, want) {
+		t.Fatalf("expected request origin without base url")
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"urlcutter/internal/models"
+)
+
+const (
+	QuotaTotal   = "total"
+	QuotaMonthly = "monthly"
+	QuotaActive  = "active"
+	QuotaBatch   = "batch_size"
+)
+
+// QuotaError возвращается, когда создание ссылок упирается в лимит владельца
+type QuotaError struct {
+	Kind  string
+	Limit int
+	Used  int
+	// ResetAt — момент обнуления месячного лимита, для остальных лимитов пустой
+	ResetAt time.Time
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("quota exceeded: %s limit is %d, used %d", e.Kind, e.Limit, e.Used)
+}
+
+// WithQuota задаёт лимиты на создание ссылок для каждого владельца
+func WithQuota(q models.Quota) Option {
+	return func(s *URLService) {
+		s.quota = q
+	}
+}
+
+func (s *URLService) Usage(ctx context.Context, owner string) (*models.UsageResponse, error) {
+	counts, err := s.repo.CountByOwner(ctx, owner, monthStart(s.now()))
+	if err != nil {
+		return nil, err
+	}
+	return &models.UsageResponse{Owner: owner, Limits: s.quota, Usage: *counts}, nil
+}
+
+// checkQuota проверяет, что владелец может создать ещё n ссылок
+func (s *URLService) checkQuota(ctx context.Context, owner string, n int) error {
+	q := s.quota
+	if q.MaxTotal == 0 && q.MaxMonthly == 0 && q.MaxActive == 0 {
+		return nil
+	}
+	// Анонимные запросы не отличить друг от друга, поэтому при квотах нужен ключ API
+	if owner == "" {
+		return ErrUnauthorized
+	}
+
+	counts, err := s.repo.CountByOwner(ctx, owner, monthStart(s.now()))
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case q.MaxTotal > 0 && counts.Total+n > q.MaxTotal:
+		return &QuotaError{Kind: QuotaTotal, Limit: q.MaxTotal, Used: counts.Total}
+	case q.MaxActive > 0 && counts.Active+n > q.MaxActive:
+		return &QuotaError{Kind: QuotaActive, Limit: q.MaxActive, Used: counts.Active}
+	case q.MaxMonthly > 0 && counts.Monthly+n > q.MaxMonthly:
+		reset := monthStart(s.now()).AddDate(0, 1, 0)
+		return &QuotaError{Kind: QuotaMonthly, Limit: q.MaxMonthly, Used: counts.Monthly, ResetAt: reset}
+	}
+	return nil
+}
+
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+)
+
+const CodeInvalidSchedule = "invalid_schedule"
+
+// InactiveError возвращается при переходе по ссылке вне её окна активности
+type InactiveError struct {
+	Short string
+	// Status — models.StatusScheduled или models.StatusExpired
+	Status string
+	// At — время запуска для запланированной ссылки или окончания для истёкшей
+	At time.Time
+}
+
+func (e *InactiveError) Error() string {
+	if e.Status == models.StatusScheduled {
+		return fmt.Sprintf("link %s is not active until %s", e.Short, e.At.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("link %s expired at %s", e.Short, e.At.Format(time.RFC3339))
+}
+
+// checkSchedule проверяет окно активности и резервный адрес
+func (s *URLService) checkSchedule(ctx context.Context, req *models.CreateURLRequest) (string, error) {
+	if req.NotBefore != nil && req.NotAfter != nil && !req.NotAfter.After(*req.NotBefore) {
+		return "", &policy.ValidationError{Code: CodeInvalidSchedule, Message: "not_after must be later than not_before"}
+	}
+	if req.FallbackURL == "" {
+		return "", nil
+	}
+
+	fallback, err := s.checkDestination(ctx, req.FallbackURL)
+	if err != nil {
+		return "", fmt.Errorf("fallback_url: %w", err)
+	}
+	return fallback, nil
+}
+
+// currentTarget возвращает адрес, на который ведёт ссылка в состоянии status:
+// истёкшая ссылка с запасным адресом ведёт на него
+func currentTarget(link *models.URL, status string) string {
+	if status == models.StatusExpired && link.FallbackURL != "" {
+		return link.FallbackURL
+	}
+	return link.Original
+}
+
+// linkStatus возвращает состояние ссылки на момент now
+func linkStatus(link *models.URL, now time.Time) string {
+	switch {
+	case link.Disabled:
+		return models.StatusDisabled
+	case link.NotBefore != nil && now.Before(*link.NotBefore):
+		return models.StatusScheduled
+	case link.NotAfter != nil && !now.Before(*link.NotAfter):
+		return models.StatusExpired
+	}
+	return models.StatusActive
+}
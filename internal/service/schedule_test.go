@@ -0,0 +1,72 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+)
+
+func TestRedirect_Schedule(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo)
+
+	launch := time.Date(2025, 11, 1, 10, 0, 0, 0, time.UTC)
+	end := launch.Add(7 * 24 * time.Hour)
+	resp, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{
+		URL:         "https://example.com/sale",
+		NotBefore:   &launch,
+		NotAfter:    &end,
+		FallbackURL: "https://example.com/",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var inactive *InactiveError
+	_, err = svc.Redirect(ctx, &models.RedirectRequest{Short: resp.ShortURL, Time: launch.Add(-time.Minute)})
+	if !errors.As(err, &inactive) || inactive.Status != models.StatusScheduled {
+		t.Fatalf("expected scheduled link error, got %v", err)
+	}
+
+	target, err := svc.Redirect(ctx, &models.RedirectRequest{Short: resp.ShortURL, Time: launch})
+	if err != nil || target.Location != "https://example.com/sale" {
+		t.Fatalf("expected active link, got %+v, %v", target, err)
+	}
+
+	target, err = svc.Redirect(ctx, &models.RedirectRequest{Short: resp.ShortURL, Time: end})
+	if err != nil || target.Location != "https://example.com/" {
+		t.Fatalf("expected fallback after end, got %+v, %v", target, err)
+	}
+
+	svc.now = func() time.Time { return end.Add(time.Hour) }
+	info, err := svc.GetURLInfo(ctx, "", resp.ShortURL)
+	if err != nil || info.Status != models.StatusExpired || info.FinalURL != "https://example.com/" {
+		t.Fatalf("unexpected info: %+v, %v", info, err)
+	}
+	if preview, err := svc.Preview(ctx, "", resp.ShortURL); err != nil || preview.Destination != "https://example.com/" {
+		t.Fatalf("expected preview of fallback, got %+v, %v", preview, err)
+	}
+
+	noFallback, _ := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://example.com/promo", NotAfter: &end})
+	_, err = svc.Redirect(ctx, &models.RedirectRequest{Short: noFallback.ShortURL, Time: end})
+	if !errors.As(err, &inactive) || inactive.Status != models.StatusExpired {
+		t.Fatalf("expected expired link error, got %v", err)
+	}
+}
+
+func TestCreateShortURL_InvalidSchedule(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(newMockRepository())
+	start := time.Now()
+	end := start.Add(-time.Hour)
+
+	var verr *policy.ValidationError
+	_, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://example.com", NotBefore: &start, NotAfter: &end})
+	if !errors.As(err, &verr) || verr.Code != CodeInvalidSchedule {
+		t.Fatalf("expected invalid schedule error, got %v", err)
+	}
+}
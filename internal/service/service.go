@@ -1,68 +1,299 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"net/url"
+	"math/rand"
+	"net/http"
+	"strings"
 	"time"
+	"urlcutter/internal/blocklist"
+	"urlcutter/internal/health"
+	"urlcutter/internal/keygen"
 	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+	"urlcutter/internal/pubsub"
 	"urlcutter/internal/repository"
-	"urlcutter/pkg/shortener"
+	"urlcutter/pkg/qr"
+	"urlcutter/pkg/useragent"
 )
 
+const CodeInvalidRedirectType = "invalid_redirect_type"
+
 type Service interface {
-	CreateShortURL(original string) (*models.CreateURLResponse, error)
-	GetOriginalURL(short string) (string, error)
-	Redirect(short string) (string, error)
+	CreateShortURL(ctx context.Context, owner string, req *models.CreateURLRequest) (*models.CreateURLResponse, error)
+	CreateShortURLs(ctx context.Context, owner string, req *models.BatchCreateURLRequest) ([]models.CreateURLResponse, error)
+	GetOriginalURL(ctx context.Context, domain, short string) (string, error)
+	GetURLInfo(ctx context.Context, domain, short string) (*models.URLInfo, error)
+	Redirect(ctx context.Context, req *models.RedirectRequest) (*models.RedirectTarget, error)
+	Usage(ctx context.Context, owner string) (*models.UsageResponse, error)
+	GetUTMDefaults(ctx context.Context, owner string) (*models.UTM, error)
+	SetUTMDefaults(ctx context.Context, owner string, utm *models.UTM) error
+	Stats(ctx context.Context, domain, short string) (*models.StatsResponse, error)
+	Preview(ctx context.Context, domain, short string) (*models.Preview, error)
+	AddDomain(ctx context.Context, owner, host string) (*models.Domain, error)
+	ListDomains(ctx context.Context, owner string) ([]*models.Domain, error)
+	QRCode(ctx context.Context, domain, short, origin, format string, opts qr.Options) ([]byte, error)
+	BrokenLinks(ctx context.Context, owner string) ([]*models.URL, error)
+	HealthHistory(ctx context.Context, domain, short string) ([]models.HealthCheck, error)
+	AddWebhook(ctx context.Context, owner string, req *models.CreateWebhookRequest) (*models.Webhook, error)
+	ListWebhooks(ctx context.Context, owner string) ([]*models.Webhook, error)
+	DeleteWebhook(ctx context.Context, owner, id string) error
+	WebhookDeliveries(ctx context.Context, owner, id string) ([]models.WebhookDelivery, error)
+	SubscribeClicks(ctx context.Context, owner, domain, short string) (*pubsub.Subscription, error)
+	SubscribeOwnerClicks(ctx context.Context, owner string) (*pubsub.Subscription, error)
+	Authenticate(ctx context.Context, key string) (string, error)
 }
 
 type URLService struct {
-	repo repository.Repository
+	repo      repository.Repository
+	policy    *policy.Policy
+	blocklist *blocklist.Blocklist
+	chain     *ChainConfig
+	dedupe    DedupeConfig
+	quota     models.Quota
+	// defaultRedirect — статус редиректа для ссылок без redirect_type
+	defaultRedirect int
+	// baseURL — публичный адрес сервиса для абсолютных ссылок в ответах
+	baseURL string
+	qrCache qrCache
+	// metadata — очередь фоновой загрузки страниц назначения, nil — выключено
+	metadata *metadataQueue
+	health   *health.Checker
+	// webhooks — настройки событий для подписок владельцев, nil — выключено
+	webhooks *WebhookConfig
+	// codes — пул заранее сгенерированных кодов, nil — коды генерируются при создании
+	codes *keygen.Pool
+	// clicks — брокер потока переходов, nil — выключено
+	clicks *pubsub.Broker
+	now    func() time.Time
+	intn   func(n int) int
+}
+
+// Option настраивает URLService при создании
+type Option func(*URLService)
+
+func NewURLService(repo repository.Repository, opts ...Option) *URLService {
+	s := &URLService{
+		repo:            repo,
+		policy:          policy.New(policy.Config{}),
+		defaultRedirect: http.StatusFound,
+		now:             time.Now,
+		intn:            rand.Intn,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
-func NewURLService(repo repository.Repository) *URLService {
-	return &URLService{repo: repo}
+// WithPolicy задаёт политику проверки целевых URL
+func WithPolicy(p *policy.Policy) Option {
+	return func(s *URLService) {
+		s.policy = p
+	}
+}
+
+// WithDefaultRedirect задаёт статус редиректа по умолчанию для всей инсталляции
+func WithDefaultRedirect(status int) Option {
+	return func(s *URLService) {
+		if validRedirectType(status) {
+			s.defaultRedirect = status
+		}
+	}
 }
 
-func (s *URLService) CreateShortURL(original string) (*models.CreateURLResponse, error) {
+func (s *URLService) CreateShortURL(ctx context.Context, owner string, req *models.CreateURLRequest) (*models.CreateURLResponse, error) {
+	if req.RedirectType != 0 && !validRedirectType(req.RedirectType) {
+		return nil, &policy.ValidationError{
+			Code:    CodeInvalidRedirectType,
+			Message: fmt.Sprintf("redirect_type must be one of 301, 302, 307, 308, got %d", req.RedirectType),
+		}
+	}
+
+	domain, err := s.ownedDomain(ctx, owner, req.Domain)
+	if err != nil {
+		return nil, err
+	}
+
 	//Валидация URL
-	if !isValidURL(original) {
-		return nil, fmt.Errorf("invalid URL")
+	original, err := s.checkDestination(ctx, req.URL)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := s.checkRules(ctx, req.Rules)
+	if err != nil {
+		return nil, err
+	}
+	variants, err := s.checkVariants(ctx, req.Variants)
+	if err != nil {
+		return nil, err
+	}
+	fallback, err := s.checkSchedule(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	social, err := s.checkSocial(ctx, req.Social)
+	if err != nil {
+		return nil, err
+	}
+
+	link := &models.URL{
+		Owner:          owner,
+		Domain:         domain,
+		Original:       original,
+		RedirectType:   req.RedirectType,
+		ForwardQuery:   req.ForwardQuery,
+		ForwardPath:    req.ForwardPath,
+		UTM:            req.UTM,
+		Rules:          rules,
+		Variants:       variants,
+		StickyVariants: req.StickyVariants,
+		Interstitial:   req.Interstitial,
+		NotBefore:      req.NotBefore,
+		NotAfter:       req.NotAfter,
+		FallbackURL:    fallback,
+		Social:         social,
 	}
 
 	//Проверяем не сокращали ли уже этот url
-	existing, err := s.repo.FindByOriginal(original)
+	existing, key, err := s.findDuplicate(ctx, domain, owner, original)
 	if err != nil {
 		return nil, err
 	}
-	if existing != nil {
-		return &models.CreateURLResponse{ShortURL: existing.Short}, nil
+	if existing != nil && !hasLinkOptions(link) {
+		return s.createResponse(existing), nil
+	}
+	link.Canonical = key
+
+	if err := s.checkQuota(ctx, owner, 1); err != nil {
+		return nil, err
 	}
 
-	//Генерируем короткую ссылку
-	short, err := shortener.GenerateShortURL()
+	return s.create(ctx, link)
+}
+
+// CreateShortURLs сокращает пачку ссылок. Лимиты проверяются на всю пачку сразу, но
+// учитываются только ссылки, которые действительно будут созданы: дубликаты уже
+// существующих ссылок и повторы внутри пачки лимит не расходуют.
+func (s *URLService) CreateShortURLs(ctx context.Context, owner string, req *models.BatchCreateURLRequest) ([]models.CreateURLResponse, error) {
+	if max := s.quota.MaxBatchSize; max > 0 && len(req.URLs) > max {
+		return nil, &QuotaError{Kind: QuotaBatch, Limit: max, Used: len(req.URLs)}
+	}
+	domain, err := s.ownedDomain(ctx, owner, req.Domain)
 	if err != nil {
 		return nil, err
 	}
 
-	//Создаем запись в БД
-	url := &models.URL{
-		Id:        short,
-		Original:  original,
-		Short:     short,
-		CreatedAt: time.Now(),
-		Clicks:    0,
+	type batchItem struct {
+		original, key string
+		existing      *models.URL
+	}
+	items := make([]batchItem, len(req.URLs))
+	fresh := make(map[string]bool)
+	for i, original := range req.URLs {
+		normalized, err := s.checkDestination(ctx, original)
+		if err != nil {
+			return nil, fmt.Errorf("urls[%d]: %w", i, err)
+		}
+		existing, key, err := s.findDuplicate(ctx, domain, owner, normalized)
+		if err != nil {
+			return nil, err
+		}
+		items[i] = batchItem{original: normalized, key: key, existing: existing}
+		if existing == nil {
+			fresh[key] = true
+		}
 	}
 
-	if err := s.repo.Create(url); err != nil {
-		return nil, err
+	if len(fresh) > 0 {
+		if err := s.checkQuota(ctx, owner, len(fresh)); err != nil {
+			return nil, err
+		}
+	}
+
+	results := make([]models.CreateURLResponse, 0, len(items))
+	created := make(map[string]*models.CreateURLResponse)
+	for _, item := range items {
+		if item.existing != nil {
+			results = append(results, *s.createResponse(item.existing))
+			continue
+		}
+		if resp, ok := created[item.key]; ok {
+			results = append(results, *resp)
+			continue
+		}
+
+		resp, err := s.create(ctx, &models.URL{Owner: owner, Domain: domain, Original: item.original, Canonical: item.key})
+		if err != nil {
+			return nil, err
+		}
+		created[item.key] = resp
+		results = append(results, *resp)
+	}
+	return results, nil
+}
+
+// checkDestination проверяет целевой URL и возвращает адрес, который нужно сохранить:
+// ссылки на наш сервис и на сокращатели заменяются конечным адресом
+func (s *URLService) checkDestination(ctx context.Context, original string) (string, error) {
+	resolved, own, err := s.resolveOwnDomain(ctx, original)
+	if err != nil {
+		return "", err
+	}
+	if own {
+		// Конечный адрес уже прошёл проверки при создании целевой ссылки
+		return resolved, s.checkBlocklist(resolved)
 	}
 
-	return &models.CreateURLResponse{ShortURL: short}, nil
+	checked, err := s.policy.Check(ctx, original)
+	if err != nil {
+		return "", err
+	}
+	if checked, err = s.checkShortener(ctx, checked); err != nil {
+		return "", err
+	}
+	return checked, s.checkBlocklist(checked)
 }
 
-func (s *URLService) GetOriginalURL(short string) (string, error) {
-	url, err := s.repo.FindByShort(short)
+// create генерирует код для ссылки и сохраняет её. Если код уже занят (например, резерв
+// пула успели отдать другому экземпляру), берётся следующий.
+func (s *URLService) create(ctx context.Context, url *models.URL) (*models.CreateURLResponse, error) {
+	var short string
+	for attempt := 1; ; attempt++ {
+		//Генерируем короткую ссылку
+		var err error
+		short, err = s.nextCode(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		//Создаем запись в БД
+		url.Id = short
+		url.Short = short
+		url.CreatedAt = s.now()
+		url.Clicks = 0
+
+		err = s.repo.Create(ctx, url, s.linkEvents(models.EventLinkCreated, url)...)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, repository.ErrCodeTaken) || attempt == maxCreateAttempts {
+			return nil, err
+		}
+		// Занятый код больше не нужен в пуле
+		s.consumeCode(ctx, short)
+	}
+	s.consumeCode(ctx, short)
+	s.enqueueMetadata(url)
+
+	return s.createResponse(url), nil
+}
+
+func (s *URLService) GetOriginalURL(ctx context.Context, domain, short string) (string, error) {
+	url, err := s.findLink(ctx, domain, short)
 	if err != nil {
 		return "", err
 	}
@@ -72,21 +303,117 @@ func (s *URLService) GetOriginalURL(short string) (string, error) {
 	return url.Original, nil
 }
 
-func (s *URLService) Redirect(short string) (string, error) {
-	original, err := s.GetOriginalURL(short)
+func (s *URLService) Redirect(ctx context.Context, req *models.RedirectRequest) (*models.RedirectTarget, error) {
+	url, err := s.findLink(ctx, req.Host, req.Short)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	// Путь после кода допустим только для ссылок с ForwardPath
+	if url == nil || (req.Rest != "" && !url.ForwardPath) {
+		return nil, fmt.Errorf("URL not found")
+	}
+	if url.Disabled {
+		return nil, &DisabledError{
+			Short:    req.Short,
+			Original: url.Original,
+			Reason:   url.DisabledReason,
+			Blocked:  strings.HasPrefix(url.DisabledReason, blocklistReason),
+		}
+	}
+
+	now := req.Time
+	if now.IsZero() {
+		now = s.now()
+	}
+
+	var target, variant string
+	switch linkStatus(url, now) {
+	case models.StatusScheduled:
+		return nil, &InactiveError{Short: req.Short, Status: models.StatusScheduled, At: *url.NotBefore}
+	case models.StatusExpired:
+		if url.FallbackURL == "" {
+			return nil, &InactiveError{Short: req.Short, Status: models.StatusExpired, At: *url.NotAfter}
+		}
+		target = url.FallbackURL
+	default:
+		target, variant = s.chooseTarget(url, req)
 	}
 
+	location, err := s.destination(ctx, url, target, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Боты превью получают карточку ссылки; их запросы не считаются переходами
+	if useragent.IsLinkPreview(req.UserAgent) {
+		return &models.RedirectTarget{Location: location, Unfurl: unfurl(url, location)}, nil
+	}
+
+	// Страница предпросмотра — ещё не переход: он учитывается, когда посетитель его подтвердит
+	if url.Interstitial && !req.Confirmed {
+		return &models.RedirectTarget{Location: location, Variant: variant, Interstitial: true}, nil
+	}
+
+	// Переход уже состоялся: его учёт не отменяется, даже если клиент отключился
+	ctx = context.WithoutCancel(ctx)
+
 	//Увеличиваем счетчик кликов
-	if err := s.repo.IncrementClicks(short); err != nil {
+	if clicks, err := s.repo.IncrementClicks(ctx, url.Domain, req.Short); err != nil {
 		log.Printf("Failed to increment clicks: %v", err)
+	} else {
+		s.emitClickThreshold(ctx, url, clicks-1, clicks)
+	}
+	s.recordClick(ctx, req, url, variant, location)
+
+	status := url.RedirectType
+	if status == 0 {
+		status = s.defaultRedirect
 	}
+	if url.Interstitial {
+		// Подтверждение пришло формой: браузер должен перейти GET-запросом, а не повторить POST
+		status = http.StatusSeeOther
+	}
+	return &models.RedirectTarget{
+		Location: location,
+		Status:   status,
+		Variant:  variant,
+		Sticky:   url.StickyVariants && variant != "",
+	}, nil
+}
 
-	return original, nil
+func (s *URLService) recordClick(ctx context.Context, req *models.RedirectRequest, link *models.URL, variant, location string) {
+	occurred := req.Time
+	if occurred.IsZero() {
+		occurred = s.now()
+	}
+	event := &models.ClickEvent{
+		Short:       req.Short,
+		Domain:      link.Domain,
+		Variant:     variant,
+		Destination: location,
+		Device:      useragent.Parse(req.UserAgent).Device,
+		Country:     req.Country,
+		OccurredAt:  occurred,
+	}
+	if err := s.repo.RecordClick(ctx, event); err != nil {
+		log.Printf("Failed to record click: %v", err)
+	}
+	s.publishClick(link.Owner, event)
 }
 
-func isValidURL(u string) bool {
-	parsed, err := url.Parse(u)
-	return err == nil && parsed.Scheme != "" && parsed.Host != ""
+// findLink ищет ссылку по коду на домене, к которому относится host
+func (s *URLService) findLink(ctx context.Context, host, short string) (*models.URL, error) {
+	domain, err := s.requestDomain(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	return s.repo.FindByShort(ctx, domain, short)
+}
+
+func validRedirectType(status int) bool {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
 }
@@ -1,66 +1,480 @@
 package service
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
+	"net/http"
+	"strings"
 	"testing"
 	"time"
+	"urlcutter/internal/keygen"
 	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+	"urlcutter/internal/pubsub"
+	"urlcutter/internal/repository"
+	"urlcutter/pkg/canonical"
 )
 
 type mockRepository struct {
-	shortToURL    map[string]*models.URL
-	originalToURL map[string]*models.URL
-	incremented   []string
-	createErr     error
+	shortToURL     map[string]*models.URL
+	originalToURL  map[string]*models.URL
+	utmDefaults    map[string]*models.UTM
+	domains        map[string]*models.Domain
+	clicks         []*models.ClickEvent
+	healthChecks   []models.HealthCheck
+	webhooks       map[string]*models.Webhook
+	outbox         []*mockOutboxEntry
+	deliveries     []models.WebhookDelivery
+	codePool       map[string]string
+	apiKeys        map[string]*models.APIKey
+	expiryNotified map[string]bool
+	incremented    []string
+	createErr      error
+	utmErr         error
+}
+
+// newTestService создаёт сервис с политикой без резолва имён, чтобы тесты не зависели от DNS
+func newTestService(repo repository.Repository, opts ...Option) *URLService {
+	opts = append([]Option{WithPolicy(policy.New(policy.Config{SkipResolve: true}))}, opts...)
+	return NewURLService(repo, opts...)
 }
 
 func newMockRepository() *mockRepository {
 	return &mockRepository{
-		shortToURL:    make(map[string]*models.URL),
-		originalToURL: make(map[string]*models.URL),
-		incremented:   []string{},
+		shortToURL:     make(map[string]*models.URL),
+		originalToURL:  make(map[string]*models.URL),
+		utmDefaults:    make(map[string]*models.UTM),
+		domains:        make(map[string]*models.Domain),
+		webhooks:       make(map[string]*models.Webhook),
+		codePool:       make(map[string]string),
+		apiKeys:        make(map[string]*models.APIKey),
+		expiryNotified: make(map[string]bool),
+		incremented:    []string{},
 	}
 }
 
-func (m *mockRepository) Create(u *models.URL) error {
+func (m *mockRepository) Create(ctx context.Context, u *models.URL, events ...*models.WebhookEvent) error {
 	if m.createErr != nil {
 		return m.createErr
 	}
 	if u == nil {
 		return errors.New("nil url")
 	}
-	m.shortToURL[u.Short] = u
+	if _, ok := m.shortToURL[linkKey(u.Domain, u.Short)]; ok {
+		return repository.ErrCodeTaken
+	}
+	m.shortToURL[linkKey(u.Domain, u.Short)] = u
 	m.originalToURL[u.Original] = u
+	return m.enqueue(ctx, events)
+}
+
+// enqueue кладёт события, переданные вместе с изменением ссылки, в очередь вебхуков
+func (m *mockRepository) enqueue(ctx context.Context, events []*models.WebhookEvent) error {
+	for _, event := range events {
+		if err := m.EnqueueWebhookEvent(ctx, event.Link.Owner, event); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-func (m *mockRepository) FindByShort(short string) (*models.URL, error) {
-	if u, ok := m.shortToURL[short]; ok {
+// linkKey — ключ shortToURL: код для домена по умолчанию, domain/код для остальных
+func linkKey(domain, short string) string {
+	if domain == "" {
+		return short
+	}
+	return domain + "/" + short
+}
+
+func (m *mockRepository) FindByShort(ctx context.Context, domain, short string) (*models.URL, error) {
+	if u, ok := m.shortToURL[linkKey(domain, short)]; ok {
 		return u, nil
 	}
 	return nil, nil
 }
 
-func (m *mockRepository) FindByOriginal(original string) (*models.URL, error) {
-	if u, ok := m.originalToURL[original]; ok {
-		return u, nil
+func (m *mockRepository) FindDuplicate(ctx context.Context, domain, canonical, original, owner string) (*models.URL, error) {
+	for _, u := range m.shortToURL {
+		same := u.Canonical == canonical || (u.Canonical == "" && u.Original == original)
+		if same && u.Domain == domain && u.Owner == owner && !u.Disabled && !hasLinkOptions(u) {
+			return u, nil
+		}
 	}
 	return nil, nil
 }
 
-func (m *mockRepository) IncrementClicks(short string) error {
+func (m *mockRepository) IncrementClicks(ctx context.Context, domain, short string) (int, error) {
 	m.incremented = append(m.incremented, short)
-	if u, ok := m.shortToURL[short]; ok {
-		u.Clicks++
+	u, ok := m.shortToURL[linkKey(domain, short)]
+	if !ok {
+		return 0, nil
+	}
+	u.Clicks++
+	return u.Clicks, nil
+}
+
+func (m *mockRepository) CountByOwner(ctx context.Context, owner string, since time.Time) (*models.UsageCounts, error) {
+	var counts models.UsageCounts
+	for _, u := range m.shortToURL {
+		if u.Owner != owner {
+			continue
+		}
+		counts.Total++
+		if !u.Disabled && (u.NotAfter == nil || u.NotAfter.After(time.Now())) {
+			counts.Active++
+		}
+		if !u.CreatedAt.Before(since) {
+			counts.Monthly++
+		}
+	}
+	return &counts, nil
+}
+
+func (m *mockRepository) ListActive(ctx context.Context) ([]*models.URL, error) {
+	var urls []*models.URL
+	for _, u := range m.shortToURL {
+		if !u.Disabled {
+			urls = append(urls, u)
+		}
+	}
+	return urls, nil
+}
+
+func (m *mockRepository) ListExpired(ctx context.Context, now time.Time) ([]*models.URL, error) {
+	var urls []*models.URL
+	for key, u := range m.shortToURL {
+		if !u.Disabled && u.NotAfter != nil && !u.NotAfter.After(now) && !m.expiryNotified[key] {
+			urls = append(urls, u)
+		}
+	}
+	return urls, nil
+}
+
+func (m *mockRepository) MarkExpiredNotified(ctx context.Context, domain, short string, events ...*models.WebhookEvent) error {
+	key := linkKey(domain, short)
+	if m.expiryNotified[key] {
+		return nil
+	}
+	m.expiryNotified[key] = true
+	return m.enqueue(ctx, events)
+}
+
+func (m *mockRepository) ScanCodes(ctx context.Context, since time.Time, visit func(domain, short string, insertedAt time.Time)) error {
+	for _, u := range m.shortToURL {
+		if !u.CreatedAt.Before(since) {
+			visit(u.Domain, u.Short, u.CreatedAt)
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) Disable(ctx context.Context, domain, short, reason string, events ...*models.WebhookEvent) error {
+	if u, ok := m.shortToURL[linkKey(domain, short)]; ok {
+		u.Disabled = true
+		u.DisabledReason = reason
+	}
+	return m.enqueue(ctx, events)
+}
+
+func (m *mockRepository) UpdateMetadata(ctx context.Context, domain, short string, meta *models.LinkMetadata, events ...*models.WebhookEvent) error {
+	if u, ok := m.shortToURL[linkKey(domain, short)]; ok {
+		u.Metadata = *meta
+	}
+	return m.enqueue(ctx, events)
+}
+
+func (m *mockRepository) RecordHealthCheck(ctx context.Context, check *models.HealthCheck) error {
+	m.healthChecks = append(m.healthChecks, *check)
+	if u, ok := m.shortToURL[linkKey(check.Domain, check.Short)]; ok {
+		last := *check
+		u.Health = &last
 	}
 	return nil
 }
 
+func (m *mockRepository) ListBroken(ctx context.Context, owner string) ([]*models.URL, error) {
+	var urls []*models.URL
+	for _, u := range m.shortToURL {
+		if u.Owner == owner && u.Health != nil && u.Health.Broken && !u.Disabled {
+			urls = append(urls, u)
+		}
+	}
+	return urls, nil
+}
+
+func (m *mockRepository) PruneHealthChecks(ctx context.Context, before time.Time) (int, error) {
+	kept := m.healthChecks[:0]
+	for _, c := range m.healthChecks {
+		if !c.CheckedAt.Before(before) {
+			kept = append(kept, c)
+		}
+	}
+	pruned := len(m.healthChecks) - len(kept)
+	m.healthChecks = kept
+	return pruned, nil
+}
+
+func (m *mockRepository) HealthHistory(ctx context.Context, domain, short string, limit int) ([]models.HealthCheck, error) {
+	var checks []models.HealthCheck
+	for i := len(m.healthChecks) - 1; i >= 0 && len(checks) < limit; i-- {
+		if c := m.healthChecks[i]; c.Domain == domain && c.Short == short {
+			checks = append(checks, c)
+		}
+	}
+	return checks, nil
+}
+
+func (m *mockRepository) GetUTMDefaults(ctx context.Context, owner string) (*models.UTM, error) {
+	if m.utmErr != nil {
+		return nil, m.utmErr
+	}
+	if utm, ok := m.utmDefaults[owner]; ok {
+		return utm, nil
+	}
+	return &models.UTM{}, nil
+}
+
+func (m *mockRepository) SetUTMDefaults(ctx context.Context, owner string, utm *models.UTM) error {
+	m.utmDefaults[owner] = utm
+	return nil
+}
+
+func (m *mockRepository) RecordClick(ctx context.Context, event *models.ClickEvent) error {
+	m.clicks = append(m.clicks, event)
+	return nil
+}
+
+func (m *mockRepository) VariantStats(ctx context.Context, domain, short string) ([]models.VariantStats, error) {
+	counts := make(map[string]int)
+	var order []string
+	for _, e := range m.clicks {
+		if e.Domain != domain || e.Short != short {
+			continue
+		}
+		if _, ok := counts[e.Variant]; !ok {
+			order = append(order, e.Variant)
+		}
+		counts[e.Variant]++
+	}
+	var stats []models.VariantStats
+	for _, v := range order {
+		stats = append(stats, models.VariantStats{Variant: v, Clicks: counts[v]})
+	}
+	return stats, nil
+}
+
+func (m *mockRepository) CreateDomain(ctx context.Context, domain *models.Domain) error {
+	m.domains[domain.Host] = domain
+	return nil
+}
+
+func (m *mockRepository) FindDomain(ctx context.Context, host string) (*models.Domain, error) {
+	return m.domains[host], nil
+}
+
+func (m *mockRepository) ListDomains(ctx context.Context, owner string) ([]*models.Domain, error) {
+	var domains []*models.Domain
+	for _, d := range m.domains {
+		if d.Owner == owner {
+			domains = append(domains, d)
+		}
+	}
+	return domains, nil
+}
+
+// mockOutboxEntry — сообщение очереди доставки с его состоянием
+type mockOutboxEntry struct {
+	msg    models.WebhookMessage
+	status string
+	next   time.Time
+}
+
+func (m *mockRepository) CreateWebhook(ctx context.Context, webhook *models.Webhook) error {
+	stored := *webhook
+	m.webhooks[webhook.ID] = &stored
+	return nil
+}
+
+func (m *mockRepository) CreateAPIKey(ctx context.Context, key *models.APIKey) error {
+	m.apiKeys[key.Hash] = key
+	return nil
+}
+
+func (m *mockRepository) FindAPIKey(ctx context.Context, hash string) (*models.APIKey, error) {
+	return m.apiKeys[hash], nil
+}
+
+func (m *mockRepository) FindWebhook(ctx context.Context, owner, id string) (*models.Webhook, error) {
+	if hook, ok := m.webhooks[id]; ok && hook.Owner == owner {
+		found := *hook
+		return &found, nil
+	}
+	return nil, nil
+}
+
+func (m *mockRepository) ListWebhooks(ctx context.Context, owner string) ([]*models.Webhook, error) {
+	var hooks []*models.Webhook
+	for _, hook := range m.webhooks {
+		if hook.Owner == owner {
+			found := *hook
+			hooks = append(hooks, &found)
+		}
+	}
+	return hooks, nil
+}
+
+func (m *mockRepository) DeleteWebhook(ctx context.Context, owner, id string) error {
+	if hook, ok := m.webhooks[id]; ok && hook.Owner == owner {
+		delete(m.webhooks, id)
+	}
+	return nil
+}
+
+func (m *mockRepository) EnqueueWebhookEvent(ctx context.Context, owner string, event *models.WebhookEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	for _, hook := range m.webhooks {
+		if hook.Owner != owner || !containsString(hook.Events, event.Type) || m.queued(hook.ID, event.ID) ||
+			hook.CreatedAt.After(event.CreatedAt) {
+			continue
+		}
+		m.outbox = append(m.outbox, &mockOutboxEntry{
+			msg: models.WebhookMessage{
+				ID: int64(len(m.outbox) + 1), WebhookID: hook.ID, EventID: event.ID, EventType: event.Type,
+				URL: hook.URL, Secret: hook.Secret, Payload: payload,
+			},
+			status: "pending",
+			next:   event.CreatedAt,
+		})
+	}
+	return nil
+}
+
+func (m *mockRepository) queued(webhookID, eventID string) bool {
+	for _, e := range m.outbox {
+		if e.msg.WebhookID == webhookID && e.msg.EventID == eventID {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *mockRepository) ClaimWebhookMessages(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*models.WebhookMessage, error) {
+	var messages []*models.WebhookMessage
+	for _, e := range m.outbox {
+		if e.status == "pending" && !e.next.After(now) && len(messages) < limit {
+			e.next = leaseUntil
+			msg := e.msg
+			messages = append(messages, &msg)
+		}
+	}
+	return messages, nil
+}
+
+func (m *mockRepository) RecordWebhookDelivery(ctx context.Context, messageID int64, delivery *models.WebhookDelivery) error {
+	m.deliveries = append(m.deliveries, *delivery)
+	e := m.outbox[messageID-1]
+	e.msg.Attempts = delivery.Attempt
+	switch {
+	case delivery.Success:
+		e.status = "delivered"
+	case delivery.NextAttemptAt == nil:
+		e.status = "failed"
+	default:
+		e.next = *delivery.NextAttemptAt
+	}
+	return nil
+}
+
+func (m *mockRepository) WebhookDeliveries(ctx context.Context, webhookID string, limit int) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	for i := len(m.deliveries) - 1; i >= 0 && len(deliveries) < limit; i-- {
+		if m.deliveries[i].WebhookID == webhookID {
+			deliveries = append(deliveries, m.deliveries[i])
+		}
+	}
+	return deliveries, nil
+}
+
+// Пул кодов: codePool хранит экземпляр, за которым закреплён код, "" — свободный код
+func (m *mockRepository) FillCodePool(ctx context.Context, codes []string) (int, error) {
+	added := 0
+	for _, code := range codes {
+		if _, ok := m.codePool[code]; !ok {
+			m.codePool[code] = ""
+			added++
+		}
+	}
+	return added, nil
+}
+
+func (m *mockRepository) CountFreeCodes(ctx context.Context) (int, error) {
+	n := 0
+	for _, instance := range m.codePool {
+		if instance == "" {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *mockRepository) ReserveCodes(ctx context.Context, instance string, n int, now time.Time) ([]string, error) {
+	var codes []string
+	for code, owner := range m.codePool {
+		if owner == "" && len(codes) < n {
+			m.codePool[code] = instance
+			codes = append(codes, code)
+		}
+	}
+	return codes, nil
+}
+
+func (m *mockRepository) TouchReservedCodes(ctx context.Context, instance string, now time.Time) ([]string, error) {
+	var held []string
+	for code, owner := range m.codePool {
+		if owner == instance {
+			held = append(held, code)
+		}
+	}
+	return held, nil
+}
+
+func (m *mockRepository) ReleaseCodes(ctx context.Context, instance string) error {
+	for code, owner := range m.codePool {
+		if owner == instance {
+			m.codePool[code] = ""
+		}
+	}
+	return nil
+}
+
+func (m *mockRepository) ConsumeCode(ctx context.Context, code string) error {
+	delete(m.codePool, code)
+	return nil
+}
+
+func (m *mockRepository) ReclaimCodes(ctx context.Context, staleBefore time.Time) (int, error) {
+	return 0, nil
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
 func TestCreateShortURL_New(t *testing.T) {
+	ctx := context.Background()
 	repo := newMockRepository()
-	svc := NewURLService(repo)
+	svc := newTestService(repo)
 
-	resp, err := svc.CreateShortURL("https://example.com")
+	resp, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://example.com"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -73,12 +487,13 @@ func TestCreateShortURL_New(t *testing.T) {
 }
 
 func TestCreateShortURL_Existing(t *testing.T) {
+	ctx := context.Background()
 	repo := newMockRepository()
 	existing := &models.URL{Id: "abc123", Original: "https://example.com", Short: "abc123", CreatedAt: time.Now()}
-	_ = repo.Create(existing)
-	svc := NewURLService(repo)
+	_ = repo.Create(ctx, existing)
+	svc := newTestService(repo)
 
-	resp, err := svc.CreateShortURL("https://example.com")
+	resp, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://example.com"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -88,19 +503,21 @@ func TestCreateShortURL_Existing(t *testing.T) {
 }
 
 func TestCreateShortURL_Invalid(t *testing.T) {
+	ctx := context.Background()
 	repo := newMockRepository()
-	svc := NewURLService(repo)
-	if _, err := svc.CreateShortURL("not-a-url"); err == nil {
+	svc := newTestService(repo)
+	if _, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "not-a-url"}); err == nil {
 		t.Fatalf("expected error for invalid URL")
 	}
 }
 
 func TestGetOriginalURL(t *testing.T) {
+	ctx := context.Background()
 	repo := newMockRepository()
-	_ = repo.Create(&models.URL{Id: "abc123", Original: "https://example.com", Short: "abc123", CreatedAt: time.Now()})
-	svc := NewURLService(repo)
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Original: "https://example.com", Short: "abc123", CreatedAt: time.Now()})
+	svc := newTestService(repo)
 
-	orig, err := svc.GetOriginalURL("abc123")
+	orig, err := svc.GetOriginalURL(ctx, "", "abc123")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -110,26 +527,383 @@ func TestGetOriginalURL(t *testing.T) {
 }
 
 func TestGetOriginalURL_NotFound(t *testing.T) {
+	ctx := context.Background()
 	repo := newMockRepository()
-	svc := NewURLService(repo)
-	if _, err := svc.GetOriginalURL("missing"); err == nil {
+	svc := newTestService(repo)
+	if _, err := svc.GetOriginalURL(ctx, "", "missing"); err == nil {
 		t.Fatalf("expected not found error")
 	}
 }
 
 func TestRedirect_IncrementsClicks(t *testing.T) {
+	ctx := context.Background()
 	repo := newMockRepository()
-	_ = repo.Create(&models.URL{Id: "abc123", Original: "https://example.com", Short: "abc123", CreatedAt: time.Now()})
-	svc := NewURLService(repo)
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Original: "https://example.com", Short: "abc123", CreatedAt: time.Now()})
+	svc := newTestService(repo)
 
-	orig, err := svc.Redirect("abc123")
+	target, err := svc.Redirect(ctx, &models.RedirectRequest{Short: "abc123"})
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
-	if orig != "https://example.com" {
-		t.Fatalf("unexpected original: %q", orig)
+	if target.Location != "https://example.com" {
+		t.Fatalf("unexpected original: %q", target.Location)
 	}
 	if repo.shortToURL["abc123"].Clicks != 1 {
 		t.Fatalf("expected clicks incremented")
 	}
 }
+
+func TestCreateShortURL_Quota(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "old111", Original: "https://old.example.com", Short: "old111", CreatedAt: time.Now().AddDate(0, -2, 0), Owner: "acme"})
+	_ = repo.Create(ctx, &models.URL{Id: "new111", Original: "https://new.example.com", Short: "new111", CreatedAt: time.Now(), Owner: "acme"})
+
+	svc := newTestService(repo, WithQuota(models.Quota{MaxMonthly: 1}))
+	_, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://example.com"})
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.Kind != QuotaMonthly {
+		t.Fatalf("expected monthly quota error, got %v", err)
+	}
+
+	// Повторное сокращение уже существующего URL квоту не расходует
+	if _, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://new.example.com"}); err != nil {
+		t.Fatalf("unexpected error for existing url: %v", err)
+	}
+	// Квоты считаются отдельно для каждого владельца
+	if _, err := svc.CreateShortURL(ctx, "other", &models.CreateURLRequest{URL: "https://example.com"}); err != nil {
+		t.Fatalf("unexpected error for other owner: %v", err)
+	}
+	// Анонимные запросы не делят одну квоту на всех
+	if _, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://example.com/anon"}); !errors.Is(err, ErrUnauthorized) {
+		t.Fatalf("expected anonymous create to require a key, got %v", err)
+	}
+
+	svc = newTestService(repo, WithQuota(models.Quota{MaxTotal: 2}))
+	if _, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://example.org"}); !errors.As(err, &quotaErr) || quotaErr.Kind != QuotaTotal {
+		t.Fatalf("expected total quota error, got %v", err)
+	}
+}
+
+func TestCreateShortURLs_BatchSize(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo, WithQuota(models.Quota{MaxBatchSize: 2}))
+
+	_, err := svc.CreateShortURLs(ctx, "acme", &models.BatchCreateURLRequest{URLs: []string{"https://a.example.com", "https://b.example.com", "https://c.example.com"}})
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.Kind != QuotaBatch {
+		t.Fatalf("expected batch size error, got %v", err)
+	}
+	if len(repo.shortToURL) != 0 {
+		t.Fatalf("expected nothing created")
+	}
+
+	results, err := svc.CreateShortURLs(ctx, "acme", &models.BatchCreateURLRequest{URLs: []string{"https://a.example.com", "https://b.example.com"}})
+	if err != nil || len(results) != 2 {
+		t.Fatalf("unexpected batch result: %v, %v", results, err)
+	}
+}
+
+func TestCreateShortURLs_QuotaCountsNewLinks(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Original: "https://a.example.com", Canonical: "https://a.example.com/", Short: "abc123", CreatedAt: time.Now(), Owner: "acme"})
+	svc := newTestService(repo, WithQuota(models.Quota{MaxTotal: 2}))
+
+	results, err := svc.CreateShortURLs(ctx, "acme", &models.BatchCreateURLRequest{
+		URLs: []string{"https://a.example.com", "https://b.example.com", "https://b.example.com"},
+	})
+	if err != nil {
+		t.Fatalf("duplicates must not count against the quota: %v", err)
+	}
+	if len(results) != 3 || results[0].ShortURL != "abc123" || results[1].ShortURL != results[2].ShortURL {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	if len(repo.shortToURL) != 2 {
+		t.Fatalf("expected one new link, got %d links", len(repo.shortToURL))
+	}
+
+	_, err = svc.CreateShortURLs(ctx, "acme", &models.BatchCreateURLRequest{URLs: []string{"https://c.example.com"}})
+	var quotaErr *QuotaError
+	if !errors.As(err, &quotaErr) || quotaErr.Kind != QuotaTotal {
+		t.Fatalf("expected total quota error, got %v", err)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Original: "https://example.com", Short: "abc123", CreatedAt: time.Now(), Owner: "acme"})
+	svc := newTestService(repo, WithQuota(models.Quota{MaxTotal: 100}))
+
+	usage, err := svc.Usage(ctx, "acme")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if usage.Usage.Total != 1 || usage.Limits.MaxTotal != 100 {
+		t.Fatalf("unexpected usage: %+v", usage)
+	}
+}
+
+func TestCreateShortURL_CanonicalDedupe(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo, WithDedupe(DedupeConfig{
+		Canonical: canonical.Options{StripTracking: true},
+	}))
+
+	first, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://Example.com/?b=2&a=1&utm_source=mail"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://example.com:443/?a=1&b=2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.ShortURL != second.ShortURL {
+		t.Fatalf("expected equivalent URLs to share a code, got %q and %q", first.ShortURL, second.ShortURL)
+	}
+	if got := repo.shortToURL[first.ShortURL].Original; got != "https://example.com/?b=2&a=1&utm_source=mail" {
+		t.Fatalf("expected original to be stored as given, got %q", got)
+	}
+
+	other, err := svc.CreateShortURL(ctx, "other", &models.CreateURLRequest{URL: "https://example.com/?a=1&b=2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if other.ShortURL == first.ShortURL {
+		t.Fatalf("expected dedupe to be scoped to the owner")
+	}
+}
+
+func TestCreateShortURL_DedupeKeepsLinkOptions(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo)
+
+	plain, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://example.com/"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	permanent, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://example.com/", RedirectType: http.StatusMovedPermanently})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if permanent.ShortURL == plain.ShortURL || repo.shortToURL[permanent.ShortURL].RedirectType != http.StatusMovedPermanently {
+		t.Fatalf("expected a new 301 link instead of the existing one")
+	}
+
+	again, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://example.com/"})
+	if err != nil || again.ShortURL != plain.ShortURL {
+		t.Fatalf("expected plain request to reuse the plain link, got %+v, %v", again, err)
+	}
+}
+
+func TestRedirect_Status(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo, WithDefaultRedirect(http.StatusMovedPermanently))
+
+	resp, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://example.com/api", RedirectType: http.StatusTemporaryRedirect})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	target, err := svc.Redirect(ctx, &models.RedirectRequest{Short: resp.ShortURL})
+	if err != nil || target.Status != http.StatusTemporaryRedirect {
+		t.Fatalf("expected per-link 307, got %+v, %v", target, err)
+	}
+
+	resp, _ = svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://example.com/seo"})
+	if target, _ = svc.Redirect(ctx, &models.RedirectRequest{Short: resp.ShortURL}); target.Status != http.StatusMovedPermanently {
+		t.Fatalf("expected deployment default 301, got %d", target.Status)
+	}
+
+	var verr *policy.ValidationError
+	_, err = svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://example.com/x", RedirectType: 200})
+	if !errors.As(err, &verr) || verr.Code != CodeInvalidRedirectType {
+		t.Fatalf("expected invalid redirect type error, got %v", err)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Original: "https://example.com", Short: "abc123", Owner: "acme", CreatedAt: time.Now()})
+	_ = repo.Create(ctx, &models.URL{Id: "old111", Original: "http://127.0.0.1/admin", Short: "old111", CreatedAt: time.Now()})
+	svc := newTestService(repo)
+
+	preview, err := svc.Preview(ctx, "", "abc123")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if preview.Destination != "https://example.com" || preview.Safety != models.SafetyOK {
+		t.Fatalf("unexpected preview: %+v", preview)
+	}
+	if len(repo.incremented) != 0 {
+		t.Fatalf("preview must not count clicks")
+	}
+
+	// Ссылка, созданная до ужесточения политики
+	if preview, _ := svc.Preview(ctx, "", "old111"); preview.Safety != models.SafetyWarning {
+		t.Fatalf("expected warning, got %+v", preview)
+	}
+}
+
+func TestRedirect_InterstitialCountsOnlyConfirmed(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Original: "https://example.com", Short: "abc123", Interstitial: true, CreatedAt: time.Now()})
+	svc := newTestService(repo)
+
+	target, err := svc.Redirect(ctx, &models.RedirectRequest{Short: "abc123"})
+	if err != nil || !target.Interstitial || target.Location != "https://example.com" {
+		t.Fatalf("expected interstitial target, got %+v, %v", target, err)
+	}
+	if len(repo.incremented) != 0 || len(repo.clicks) != 0 {
+		t.Fatalf("unconfirmed interstitial must not count clicks")
+	}
+
+	target, err = svc.Redirect(ctx, &models.RedirectRequest{Short: "abc123", Confirmed: true})
+	if err != nil || target.Interstitial || target.Location != "https://example.com" || target.Status != http.StatusSeeOther {
+		t.Fatalf("expected 303 after confirmation, got %+v, %v", target, err)
+	}
+	if len(repo.incremented) != 1 || len(repo.clicks) != 1 {
+		t.Fatalf("expected confirmed click counted once, got %d/%d", len(repo.incremented), len(repo.clicks))
+	}
+
+	// POST на обычную ссылку — не подтверждение: статус ссылки сохраняется
+	_ = repo.Create(ctx, &models.URL{Id: "api111", Original: "https://example.com/api", Short: "api111", RedirectType: http.StatusTemporaryRedirect, CreatedAt: time.Now()})
+	if target, _ := svc.Redirect(ctx, &models.RedirectRequest{Short: "api111", Confirmed: true}); target.Status != http.StatusTemporaryRedirect {
+		t.Fatalf("expected link status 307 for POST, got %+v", target)
+	}
+}
+
+func TestRedirect_LinkPreviewBot(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{
+		Id: "abc123", Original: "https://example.com/post", Short: "abc123", CreatedAt: time.Now(),
+		Metadata: models.LinkMetadata{Title: "Captured", Description: "From page", Image: "https://example.com/og.png"},
+		Social:   models.SocialOverride{Title: "Custom"},
+	})
+	_ = repo.Create(ctx, &models.URL{Id: "bare11", Original: "https://bare.example.com/x", Short: "bare11", CreatedAt: time.Now()})
+	svc := newTestService(repo)
+
+	target, err := svc.Redirect(ctx, &models.RedirectRequest{Short: "abc123", UserAgent: "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if target.Unfurl == nil || target.Unfurl.Title != "Custom" || target.Unfurl.Description != "From page" || target.Unfurl.Image != "https://example.com/og.png" {
+		t.Fatalf("unexpected unfurl: %+v", target.Unfurl)
+	}
+	if repo.shortToURL["abc123"].Clicks != 0 {
+		t.Fatalf("preview bots must not count clicks")
+	}
+
+	target, _ = svc.Redirect(ctx, &models.RedirectRequest{Short: "bare11", UserAgent: "TelegramBot (like TwitterBot)"})
+	if target.Unfurl == nil || target.Unfurl.Title != "bare.example.com" {
+		t.Fatalf("expected hostname title, got %+v", target.Unfurl)
+	}
+
+	target, _ = svc.Redirect(ctx, &models.RedirectRequest{Short: "abc123", UserAgent: "Mozilla/5.0"})
+	if target.Unfurl != nil {
+		t.Fatalf("browsers must be redirected")
+	}
+}
+
+func TestCreateShortURL_InvalidSocial(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(newMockRepository())
+
+	for _, social := range []models.SocialOverride{
+		{Title: strings.Repeat("a", maxSocialTitle+1)},
+		{Image: "javascript:alert(1)"},
+	} {
+		_, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://example.com", Social: social})
+		var verr *policy.ValidationError
+		if !errors.As(err, &verr) || verr.Code != CodeInvalidSocial {
+			t.Fatalf("expected %s for %+v, got %v", CodeInvalidSocial, social, err)
+		}
+	}
+}
+
+func TestRedirect_PublishesClick(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Original: "https://example.com", Short: "abc123", Owner: "acme", CreatedAt: time.Now()})
+	svc := newTestService(repo, WithClickStream(pubsub.NewBroker(4)))
+
+	link, err := svc.SubscribeClicks(ctx, "acme", "", "abc123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer link.Close()
+	workspace, _ := svc.SubscribeOwnerClicks(ctx, "acme")
+	defer workspace.Close()
+	other, _ := svc.SubscribeOwnerClicks(ctx, "other")
+	defer other.Close()
+	if _, err := svc.SubscribeClicks(ctx, "acme", "", "missing"); err == nil {
+		t.Fatalf("expected error for missing link")
+	}
+	if _, err := svc.SubscribeClicks(ctx, "other", "", "abc123"); err == nil {
+		t.Fatalf("expected error for another owner's link")
+	}
+	if _, err := svc.SubscribeOwnerClicks(ctx, ""); err == nil {
+		t.Fatalf("expected error for anonymous owner")
+	}
+
+	if _, err := svc.Redirect(ctx, &models.RedirectRequest{Short: "abc123", Country: "DE"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, sub := range []*pubsub.Subscription{link, workspace} {
+		if event := <-sub.Events; event.Short != "abc123" || event.Country != "DE" {
+			t.Fatalf("unexpected event %+v", event)
+		}
+	}
+	if len(other.Events) != 0 {
+		t.Fatalf("other owner must not receive clicks")
+	}
+}
+
+func TestCreateShortURL_CodePool(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	_, _ = repo.FillCodePool(ctx, []string{"pool01"})
+	pool := keygen.NewPool(repo, keygen.Config{Instance: "test", StorageLowWatermark: 1, StorageBatch: 1})
+	svc := newTestService(repo, WithCodePool(pool))
+
+	resp, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ShortURL != "pool01" {
+		t.Fatalf("expected code from pool, got %q", resp.ShortURL)
+	}
+	if _, ok := repo.codePool["pool01"]; ok {
+		t.Fatalf("expected used code removed from pool")
+	}
+
+	// Пустой пул пополняется при создании
+	resp, err = svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://example.com/other"})
+	if err != nil || len(resp.ShortURL) != 6 {
+		t.Fatalf("expected generated code, got %+v, %v", resp, err)
+	}
+}
+
+func TestCreateShortURL_RetriesTakenCode(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "pool01", Short: "pool01", Original: "https://example.com/taken"})
+	_, _ = repo.FillCodePool(ctx, []string{"pool01"})
+	pool := keygen.NewPool(repo, keygen.Config{Instance: "test", StorageLowWatermark: 1, StorageBatch: 1})
+	svc := newTestService(repo, WithCodePool(pool))
+
+	resp, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://example.com"})
+	if err != nil || resp.ShortURL == "pool01" || len(resp.ShortURL) != 6 {
+		t.Fatalf("expected another code after a taken one, got %+v, %v", resp, err)
+	}
+	if _, ok := repo.codePool["pool01"]; ok {
+		t.Fatalf("expected taken code removed from pool")
+	}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+	"urlcutter/pkg/useragent"
+)
+
+const CodeInvalidRule = "invalid_rule"
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// checkRules проверяет правила таргетинга и их целевые URL так же, как основной адрес
+func (s *URLService) checkRules(ctx context.Context, rules []models.TargetingRule) ([]models.TargetingRule, error) {
+	checked := make([]models.TargetingRule, len(rules))
+	for i, rule := range rules {
+		destination, err := s.checkDestination(ctx, rule.URL)
+		if err != nil {
+			return nil, fmt.Errorf("rules[%d]: %w", i, err)
+		}
+		rule.URL = destination
+
+		if (rule.TimeFrom == "") != (rule.TimeTo == "") {
+			return nil, invalidRule(i, "time_from and time_to must be set together")
+		}
+		if rule.TimeFrom != "" {
+			if _, err := time.Parse("15:04", rule.TimeFrom); err != nil {
+				return nil, invalidRule(i, "invalid time_from %q", rule.TimeFrom)
+			}
+			if _, err := time.Parse("15:04", rule.TimeTo); err != nil {
+				return nil, invalidRule(i, "invalid time_to %q", rule.TimeTo)
+			}
+		}
+		for _, day := range rule.Weekdays {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				return nil, invalidRule(i, "invalid weekday %q", day)
+			}
+		}
+		checked[i] = rule
+	}
+	return checked, nil
+}
+
+// matchRule возвращает URL первого совпавшего правила таргетинга
+func matchRule(link *models.URL, req *models.RedirectRequest) (string, bool) {
+	if len(link.Rules) == 0 {
+		return "", false
+	}
+
+	ua := useragent.Parse(req.UserAgent)
+	language := preferredLanguage(req.AcceptLanguage)
+	now := req.Time
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	for _, rule := range link.Rules {
+		if matchAny(rule.OS, ua.OS) &&
+			matchAny(rule.Device, ua.Device) &&
+			matchLanguage(rule.Language, language) &&
+			matchAny(rule.Country, req.Country) &&
+			matchTime(rule, now.UTC()) {
+			return rule.URL, true
+		}
+	}
+	return "", false
+}
+
+func matchAny(allowed []string, value string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(a, value) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchLanguage(allowed []string, language string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(a, language) || strings.HasPrefix(language, strings.ToLower(a)+"-") {
+			return true
+		}
+	}
+	return false
+}
+
+func matchTime(rule models.TargetingRule, now time.Time) bool {
+	if len(rule.Weekdays) > 0 {
+		day := strings.ToLower(now.Weekday().String()[:3])
+		if !matchAny(rule.Weekdays, day) {
+			return false
+		}
+	}
+	if rule.TimeFrom == "" {
+		return true
+	}
+
+	from, _ := time.Parse("15:04", rule.TimeFrom)
+	to, _ := time.Parse("15:04", rule.TimeTo)
+	minute := now.Hour()*60 + now.Minute()
+	start := from.Hour()*60 + from.Minute()
+	end := to.Hour()*60 + to.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	// Окно через полночь, например 22:00–06:00
+	return minute >= start || minute < end
+}
+
+// preferredLanguage возвращает первый язык из Accept-Language в нижнем регистре
+func preferredLanguage(header string) string {
+	first, _, _ := strings.Cut(header, ",")
+	tag, _, _ := strings.Cut(first, ";")
+	return strings.ToLower(strings.TrimSpace(tag))
+}
+
+func invalidRule(i int, format string, args ...interface{}) error {
+	return &policy.ValidationError{
+		Code:    CodeInvalidRule,
+		Message: fmt.Sprintf("rules[%d]: ", i) + fmt.Sprintf(format, args...),
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+)
+
+const (
+	iphoneUA  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148"
+	androidUA = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36"
+	desktopUA = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0"
+)
+
+func TestRedirect_TargetingRules(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo)
+
+	resp, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{
+		URL: "https://example.com/app",
+		Rules: []models.TargetingRule{
+			{URL: "https://apps.apple.com/app/id1", OS: []string{"ios"}},
+			{URL: "https://play.google.com/store/apps/details?id=app", OS: []string{"android"}},
+			{URL: "https://example.ru/app", Language: []string{"ru"}, Country: []string{"RU"}},
+			{URL: "https://example.com/night", TimeFrom: "22:00", TimeTo: "06:00", Weekdays: []string{"sat", "sun"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	saturdayNoon := time.Date(2025, 10, 18, 12, 0, 0, 0, time.UTC)
+	saturdayNight := time.Date(2025, 10, 18, 23, 30, 0, 0, time.UTC)
+	cases := []struct {
+		req  models.RedirectRequest
+		want string
+	}{
+		{models.RedirectRequest{UserAgent: iphoneUA, Time: saturdayNoon}, "https://apps.apple.com/app/id1"},
+		{models.RedirectRequest{UserAgent: androidUA, Time: saturdayNoon}, "https://play.google.com/store/apps/details?id=app"},
+		{models.RedirectRequest{UserAgent: desktopUA, AcceptLanguage: "ru-RU,ru;q=0.9,en;q=0.8", Country: "RU", Time: saturdayNoon}, "https://example.ru/app"},
+		{models.RedirectRequest{UserAgent: desktopUA, AcceptLanguage: "ru-RU", Country: "DE", Time: saturdayNoon}, "https://example.com/app"},
+		{models.RedirectRequest{UserAgent: desktopUA, Time: saturdayNight}, "https://example.com/night"},
+		{models.RedirectRequest{UserAgent: desktopUA, Time: saturdayNight.AddDate(0, 0, 3)}, "https://example.com/app"},
+	}
+	for _, c := range cases {
+		c.req.Short = resp.ShortURL
+		target, err := svc.Redirect(ctx, &c.req)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if target.Location != c.want {
+			t.Errorf("%+v: expected %s, got %s", c.req, c.want, target.Location)
+		}
+	}
+}
+
+func TestCreateShortURL_InvalidRules(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(newMockRepository())
+
+	var verr *policy.ValidationError
+	_, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{
+		URL:   "https://example.com",
+		Rules: []models.TargetingRule{{URL: "javascript:alert(1)", OS: []string{"ios"}}},
+	})
+	if !errors.As(err, &verr) || verr.Code != policy.CodeSchemeNotAllowed {
+		t.Fatalf("expected rule destination to be validated, got %v", err)
+	}
+
+	_, err = svc.CreateShortURL(ctx, "", &models.CreateURLRequest{
+		URL:   "https://example.com",
+		Rules: []models.TargetingRule{{URL: "https://example.org", TimeFrom: "25:00", TimeTo: "06:00"}},
+	})
+	if !errors.As(err, &verr) || verr.Code != CodeInvalidRule {
+		t.Fatalf("expected invalid rule error, got %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"unicode/utf8"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+)
+
+const CodeInvalidSocial = "invalid_social"
+
+const (
+	maxSocialTitle       = 300
+	maxSocialDescription = 1000
+)
+
+// checkSocial проверяет заданную вручную карточку ссылки; картинка проходит ту же
+// политику, что и адрес назначения
+func (s *URLService) checkSocial(ctx context.Context, social models.SocialOverride) (models.SocialOverride, error) {
+	if utf8.RuneCountInString(social.Title) > maxSocialTitle {
+		return social, invalidSocial("title is longer than %d characters", maxSocialTitle)
+	}
+	if utf8.RuneCountInString(social.Description) > maxSocialDescription {
+		return social, invalidSocial("description is longer than %d characters", maxSocialDescription)
+	}
+	if social.Image != "" {
+		image, err := s.policy.Check(ctx, social.Image)
+		if err != nil {
+			return social, invalidSocial("image: %v", err)
+		}
+		social.Image = image
+	}
+	return social, nil
+}
+
+// unfurl собирает карточку ссылки: ручные значения важнее собранных со страницы назначения,
+// без заголовка показывается хост назначения
+func unfurl(link *models.URL, destination string) *models.Unfurl {
+	card := &models.Unfurl{
+		Title:       first(link.Social.Title, link.Metadata.Title),
+		Description: first(link.Social.Description, link.Metadata.Description),
+		Image:       first(link.Social.Image, link.Metadata.Image),
+		Destination: destination,
+	}
+	if card.Title == "" {
+		if parsed, err := url.Parse(destination); err == nil {
+			card.Title = parsed.Hostname()
+		}
+	}
+	return card
+}
+
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func invalidSocial(format string, args ...interface{}) error {
+	return &policy.ValidationError{Code: CodeInvalidSocial, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"urlcutter/internal/models"
+)
+
+func (s *URLService) GetUTMDefaults(ctx context.Context, owner string) (*models.UTM, error) {
+	return s.repo.GetUTMDefaults(ctx, owner)
+}
+
+// SetUTMDefaults задаёт UTM-метки, которые получат все ссылки владельца без собственных значений
+func (s *URLService) SetUTMDefaults(ctx context.Context, owner string, utm *models.UTM) error {
+	return s.repo.SetUTMDefaults(ctx, owner, utm)
+}
+
+// GetURLInfo возвращает ссылку и адрес, на который сейчас ведёт переход по ней
+func (s *URLService) GetURLInfo(ctx context.Context, domain, short string) (*models.URLInfo, error) {
+	link, err := s.findLink(ctx, domain, short)
+	if err != nil {
+		return nil, err
+	}
+	if link == nil {
+		return nil, fmt.Errorf("URL not found")
+	}
+
+	status := linkStatus(link, s.now())
+	final, err := s.destination(ctx, link, currentTarget(link, status), &models.RedirectRequest{Short: short})
+	if err != nil {
+		return nil, err
+	}
+	return &models.URLInfo{URL: *link, LinkURLs: s.linkURLs(link.Domain, link.Short), FinalURL: final, Status: status}, nil
+}
+
+// destination собирает итоговый адрес перехода на target: UTM-метки, затем путь и query запроса
+func (s *URLService) destination(ctx context.Context, link *models.URL, target string, req *models.RedirectRequest) (string, error) {
+	location, err := applyUTM(target, &link.UTM, s.utmDefaults(ctx, link.Owner))
+	if err != nil {
+		return "", err
+	}
+	return applyPassthrough(link, location, req)
+}
+
+// utmDefaults возвращает UTM-метки владельца по умолчанию. У анонимных ссылок их нет, а
+// ошибка хранилища не должна ломать переход, поэтому она только пишется в лог.
+func (s *URLService) utmDefaults(ctx context.Context, owner string) *models.UTM {
+	if owner == "" {
+		return &models.UTM{}
+	}
+	defaults, err := s.repo.GetUTMDefaults(ctx, owner)
+	if err != nil {
+		log.Printf("Failed to load UTM defaults for %s: %v", owner, err)
+		return &models.UTM{}
+	}
+	return defaults
+}
+
+// applyUTM добавляет UTM-метки к целевому URL. Поля ссылки важнее значений владельца по умолчанию,
+// а параметры, уже заданные в целевом URL, не перезаписываются.
+func applyUTM(destination string, link, defaults *models.UTM) (string, error) {
+	params := []struct{ key, value, fallback string }{
+		{"utm_source", link.Source, defaults.Source},
+		{"utm_medium", link.Medium, defaults.Medium},
+		{"utm_campaign", link.Campaign, defaults.Campaign},
+		{"utm_term", link.Term, defaults.Term},
+		{"utm_content", link.Content, defaults.Content},
+	}
+
+	target, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+	existing := target.Query()
+
+	extra := url.Values{}
+	for _, p := range params {
+		value := p.value
+		if value == "" {
+			value = p.fallback
+		}
+		if _, ok := existing[p.key]; !ok && value != "" {
+			extra.Set(p.key, value)
+		}
+	}
+	if len(extra) == 0 {
+		return destination, nil
+	}
+
+	if target.RawQuery != "" {
+		target.RawQuery += "&"
+	}
+	target.RawQuery += extra.Encode()
+	return target.String(), nil
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"urlcutter/internal/models"
+)
+
+func TestUTMTemplating(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo)
+	_ = svc.SetUTMDefaults(ctx, "acme", &models.UTM{Source: "newsletter", Medium: "email"})
+
+	resp, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{
+		URL: "https://example.com/sale?utm_medium=banner",
+		UTM: models.UTM{Source: "poster", Campaign: "spring sale"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := "https://example.com/sale?utm_medium=banner&utm_campaign=spring+sale&utm_source=poster"
+	info, err := svc.GetURLInfo(ctx, "", resp.ShortURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if info.FinalURL != want {
+		t.Fatalf("unexpected preview: %s", info.FinalURL)
+	}
+
+	target, err := svc.Redirect(ctx, &models.RedirectRequest{Short: resp.ShortURL})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if target.Location != want {
+		t.Fatalf("unexpected redirect: %s", target.Location)
+	}
+
+	// Ссылки других владельцев значения по умолчанию не получают
+	other, _ := svc.CreateShortURL(ctx, "other", &models.CreateURLRequest{URL: "https://example.com/plain"})
+	if info, _ := svc.GetURLInfo(ctx, "", other.ShortURL); info.FinalURL != "https://example.com/plain" {
+		t.Fatalf("unexpected preview for other owner: %s", info.FinalURL)
+	}
+}
+
+func TestRedirect_UTMDefaultsUnavailable(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo)
+	resp, _ := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{
+		URL: "https://example.com/sale",
+		UTM: models.UTM{Source: "poster"},
+	})
+
+	repo.utmErr = errors.New("utm table is unavailable")
+	target, err := svc.Redirect(ctx, &models.RedirectRequest{Short: resp.ShortURL})
+	if err != nil {
+		t.Fatalf("redirect must not depend on workspace defaults: %v", err)
+	}
+	if target.Location != "https://example.com/sale?utm_source=poster" {
+		t.Fatalf("unexpected redirect: %s", target.Location)
+	}
+}
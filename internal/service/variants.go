@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+)
+
+const CodeInvalidVariant = "invalid_variant"
+
+// Ограничения весов: сумма весов всех вариантов должна оставаться положительным int
+const (
+	maxVariantWeight      = 10000
+	maxVariantTotalWeight = 1000000
+)
+
+// checkVariants проверяет варианты A/B-теста; безымянные получают имена v1, v2, ...
+func (s *URLService) checkVariants(ctx context.Context, variants []models.Variant) ([]models.Variant, error) {
+	checked := make([]models.Variant, len(variants))
+	names := make(map[string]bool)
+	total := 0
+	for i, v := range variants {
+		destination, err := s.checkDestination(ctx, v.URL)
+		if err != nil {
+			return nil, fmt.Errorf("variants[%d]: %w", i, err)
+		}
+		v.URL = destination
+
+		if v.Name == "" {
+			v.Name = fmt.Sprintf("v%d", i+1)
+		}
+		if names[v.Name] {
+			return nil, invalidVariant(i, "duplicate variant name %q", v.Name)
+		}
+		names[v.Name] = true
+
+		if v.Weight <= 0 || v.Weight > maxVariantWeight {
+			return nil, invalidVariant(i, "weight must be between 1 and %d", maxVariantWeight)
+		}
+		if total += v.Weight; total > maxVariantTotalWeight {
+			return nil, invalidVariant(i, "total weight must not exceed %d", maxVariantTotalWeight)
+		}
+		checked[i] = v
+	}
+	return checked, nil
+}
+
+// chooseTarget выбирает адрес перехода: правило таргетинга, затем вариант A/B-теста,
+// затем основной адрес. Второе значение — имя выбранного варианта.
+func (s *URLService) chooseTarget(link *models.URL, req *models.RedirectRequest) (string, string) {
+	if target, ok := matchRule(link, req); ok {
+		return target, ""
+	}
+	if len(link.Variants) == 0 {
+		return link.Original, ""
+	}
+
+	if link.StickyVariants && req.Variant != "" {
+		for _, v := range link.Variants {
+			if v.Name == req.Variant {
+				return v.URL, v.Name
+			}
+		}
+	}
+
+	// Ссылки, сохранённые до ограничения весов, могут нести неположительные веса
+	// или переполнять сумму; такие варианты не выбираются
+	total := 0
+	for _, v := range link.Variants {
+		if v.Weight > 0 && v.Weight <= maxVariantTotalWeight {
+			total += v.Weight
+		}
+	}
+	if total <= 0 {
+		return link.Original, ""
+	}
+	n := s.intn(total)
+	for _, v := range link.Variants {
+		if v.Weight <= 0 || v.Weight > maxVariantTotalWeight {
+			continue
+		}
+		if n < v.Weight {
+			return v.URL, v.Name
+		}
+		n -= v.Weight
+	}
+	return link.Original, ""
+}
+
+// Stats возвращает переходы по ссылке с разбивкой по вариантам
+func (s *URLService) Stats(ctx context.Context, domain, short string) (*models.StatsResponse, error) {
+	link, err := s.findLink(ctx, domain, short)
+	if err != nil {
+		return nil, err
+	}
+	if link == nil {
+		return nil, fmt.Errorf("URL not found")
+	}
+
+	stats, err := s.repo.VariantStats(ctx, link.Domain, short)
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, st := range stats {
+		total += st.Clicks
+	}
+	for i := range stats {
+		if total > 0 {
+			stats[i].Share = float64(stats[i].Clicks) / float64(total)
+		}
+	}
+	if stats == nil {
+		stats = []models.VariantStats{}
+	}
+	return &models.StatsResponse{Short: short, Domain: link.Domain, Clicks: link.Clicks, Variants: stats}, nil
+}
+
+func invalidVariant(i int, format string, args ...interface{}) error {
+	return &policy.ValidationError{
+		Code:    CodeInvalidVariant,
+		Message: fmt.Sprintf("variants[%d]: ", i) + fmt.Sprintf(format, args...),
+	}
+}
@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+)
+
+func TestRedirect_Variants(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo)
+
+	resp, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{
+		URL: "https://example.com/landing",
+		Variants: []models.Variant{
+			{Name: "a", URL: "https://example.com/a", Weight: 3},
+			{Name: "b", URL: "https://example.com/b", Weight: 1},
+		},
+		StickyVariants: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Веса 3:1 — значения 0..2 попадают в a, 3 — в b
+	for n, want := range map[int]string{0: "a", 2: "a", 3: "b"} {
+		svc.intn = func(int) int { return n }
+		target, err := svc.Redirect(ctx, &models.RedirectRequest{Short: resp.ShortURL})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if target.Variant != want || target.Location != "https://example.com/"+want || !target.Sticky {
+			t.Fatalf("n=%d: unexpected target %+v", n, target)
+		}
+	}
+
+	// Закреплённый вариант важнее случайного выбора
+	svc.intn = func(int) int { return 0 }
+	target, _ := svc.Redirect(ctx, &models.RedirectRequest{Short: resp.ShortURL, Variant: "b"})
+	if target.Variant != "b" {
+		t.Fatalf("expected sticky variant b, got %q", target.Variant)
+	}
+
+	stats, err := svc.Stats(ctx, "", resp.ShortURL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stats.Clicks != 4 || len(stats.Variants) != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	for _, v := range stats.Variants {
+		if v.Variant == "a" && (v.Clicks != 2 || v.Share != 0.5) {
+			t.Fatalf("unexpected stats for a: %+v", v)
+		}
+	}
+}
+
+func TestCreateShortURL_InvalidVariants(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(newMockRepository())
+
+	var verr *policy.ValidationError
+	_, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{
+		URL:      "https://example.com",
+		Variants: []models.Variant{{URL: "https://example.com/a", Weight: 0}},
+	})
+	if !errors.As(err, &verr) || verr.Code != CodeInvalidVariant {
+		t.Fatalf("expected invalid variant error, got %v", err)
+	}
+
+	heavy := make([]models.Variant, 101)
+	for i := range heavy {
+		heavy[i] = models.Variant{URL: "https://example.com/v", Weight: maxVariantWeight}
+	}
+	for name, variants := range map[string][]models.Variant{
+		"weight": {{URL: "https://example.com/a", Weight: math.MaxInt}, {URL: "https://example.com/b", Weight: 1}},
+		"total":  heavy,
+	} {
+		_, err := svc.CreateShortURL(ctx, "", &models.CreateURLRequest{URL: "https://example.com", Variants: variants})
+		if !errors.As(err, &verr) || verr.Code != CodeInvalidVariant {
+			t.Fatalf("%s: expected invalid variant error, got %v", name, err)
+		}
+	}
+}
+
+func TestRedirect_VariantsOverflowingWeights(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Short: "abc123", Original: "https://example.com", Variants: []models.Variant{
+		{Name: "a", URL: "https://example.com/a", Weight: math.MaxInt},
+		{Name: "b", URL: "https://example.com/b", Weight: math.MaxInt},
+	}})
+	svc := newTestService(repo)
+
+	target, err := svc.Redirect(ctx, &models.RedirectRequest{Short: "abc123"})
+	if err != nil || target.Location != "https://example.com" {
+		t.Fatalf("expected original for unusable weights, got %+v, %v", target, err)
+	}
+}
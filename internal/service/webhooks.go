@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+	"urlcutter/internal/webhook"
+)
+
+const CodeInvalidWebhook = "invalid_webhook"
+
+const (
+	defaultWebhookBatch   = 100
+	defaultWebhookLease   = 5 * time.Minute
+	defaultExpiryInterval = time.Minute
+	// webhookDeliveriesLimit — сколько последних попыток отдаёт журнал доставки
+	webhookDeliveriesLimit = 100
+)
+
+// webhookEvents — события, на которые можно подписаться
+var webhookEvents = []string{
+	models.EventLinkCreated,
+	models.EventLinkUpdated,
+	models.EventLinkDisabled,
+	models.EventLinkExpired,
+	models.EventLinkClickThreshold,
+}
+
+var defaultClickThresholds = []int{100, 1000, 10000, 100000, 1000000}
+
+type WebhookConfig struct {
+	Sender *webhook.Sender
+	// ClickThresholds — числа переходов, при достижении которых отправляется
+	// link.clicks_threshold
+	ClickThresholds []int
+	// BatchSize — сколько сообщений очереди забирается за один проход
+	BatchSize int
+	// Lease — на сколько откладывается взятое сообщение; если экземпляр упадёт во время
+	// доставки, после этого срока сообщение доставит другой
+	Lease time.Duration
+	// ExpiryInterval — как часто WatchWebhooks ищет истёкшие ссылки
+	ExpiryInterval time.Duration
+}
+
+// WithWebhooks включает события ссылок для подписок владельцев
+func WithWebhooks(cfg WebhookConfig) Option {
+	return func(s *URLService) {
+		if cfg.ClickThresholds == nil {
+			cfg.ClickThresholds = defaultClickThresholds
+		}
+		if cfg.BatchSize == 0 {
+			cfg.BatchSize = defaultWebhookBatch
+		}
+		if cfg.Lease == 0 {
+			cfg.Lease = defaultWebhookLease
+		}
+		if cfg.ExpiryInterval == 0 {
+			cfg.ExpiryInterval = defaultExpiryInterval
+		}
+		s.webhooks = &cfg
+	}
+}
+
+// AddWebhook подписывает адрес на события ссылок владельца. Секрет для проверки подписи
+// возвращается только здесь.
+func (s *URLService) AddWebhook(ctx context.Context, owner string, req *models.CreateWebhookRequest) (*models.Webhook, error) {
+	if s.webhooks == nil {
+		return nil, fmt.Errorf("webhooks are not configured")
+	}
+
+	target, err := s.policy.Check(ctx, req.URL)
+	if err != nil {
+		return nil, invalidWebhook("url: %v", err)
+	}
+	events := req.Events
+	if len(events) == 0 {
+		events = webhookEvents
+	}
+	for _, event := range events {
+		if !knownEvent(event) {
+			return nil, invalidWebhook("unknown event %q", event)
+		}
+	}
+
+	id, err := randomHex(8)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomHex(32)
+	if err != nil {
+		return nil, err
+	}
+	hook := &models.Webhook{ID: id, Owner: owner, URL: target, Secret: secret, Events: events, CreatedAt: s.now()}
+	if err := s.repo.CreateWebhook(ctx, hook); err != nil {
+		return nil, err
+	}
+	return hook, nil
+}
+
+// ListWebhooks возвращает подписки владельца без секретов
+func (s *URLService) ListWebhooks(ctx context.Context, owner string) ([]*models.Webhook, error) {
+	hooks, err := s.repo.ListWebhooks(ctx, owner)
+	if err != nil {
+		return nil, err
+	}
+	if hooks == nil {
+		hooks = []*models.Webhook{}
+	}
+	for _, hook := range hooks {
+		hook.Secret = ""
+	}
+	return hooks, nil
+}
+
+func (s *URLService) DeleteWebhook(ctx context.Context, owner, id string) error {
+	if _, err := s.ownedWebhook(ctx, owner, id); err != nil {
+		return err
+	}
+	return s.repo.DeleteWebhook(ctx, owner, id)
+}
+
+// WebhookDeliveries возвращает журнал доставки подписки, новые попытки первыми
+func (s *URLService) WebhookDeliveries(ctx context.Context, owner, id string) ([]models.WebhookDelivery, error) {
+	if _, err := s.ownedWebhook(ctx, owner, id); err != nil {
+		return nil, err
+	}
+	deliveries, err := s.repo.WebhookDeliveries(ctx, id, webhookDeliveriesLimit)
+	if err != nil {
+		return nil, err
+	}
+	if deliveries == nil {
+		deliveries = []models.WebhookDelivery{}
+	}
+	return deliveries, nil
+}
+
+func (s *URLService) ownedWebhook(ctx context.Context, owner, id string) (*models.Webhook, error) {
+	hook, err := s.repo.FindWebhook(ctx, owner, id)
+	if err != nil {
+		return nil, err
+	}
+	if hook == nil {
+		return nil, fmt.Errorf("webhook not found")
+	}
+	return hook, nil
+}
+
+// DeliverWebhooks делает по одной попытке доставки для сообщений, время которых
+// наступило, и возвращает число успешных
+func (s *URLService) DeliverWebhooks(ctx context.Context) (int, error) {
+	if s.webhooks == nil {
+		return 0, fmt.Errorf("webhooks are not configured")
+	}
+
+	now := s.now()
+	messages, err := s.repo.ClaimWebhookMessages(ctx, now, now.Add(s.webhooks.Lease), s.webhooks.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	delivered := 0
+	for _, msg := range messages {
+		delivery := s.webhooks.Sender.Send(ctx, msg)
+		if delivery.Success {
+			delivered++
+		}
+		if err := s.repo.RecordWebhookDelivery(ctx, msg.ID, delivery); err != nil {
+			log.Printf("Failed to record webhook delivery %s: %v", msg.EventID, err)
+		}
+	}
+	return delivered, nil
+}
+
+// NotifyExpired отправляет link.expired для ссылок, окно активности которых закончилось.
+// Каждая ссылка отмечается в базе вместе с записью события, поэтому повторные вызовы
+// её не выбирают. Событие получают только подписки, существовавшие на момент not_after.
+func (s *URLService) NotifyExpired(ctx context.Context) (int, error) {
+	if s.webhooks == nil {
+		return 0, nil
+	}
+	links, err := s.repo.ListExpired(ctx, s.now())
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, link := range links {
+		event := s.webhookEvent(models.EventLinkExpired, link, 0)
+		event.CreatedAt = *link.NotAfter
+		if err := s.repo.MarkExpiredNotified(ctx, link.Domain, link.Short, event); err != nil {
+			log.Printf("Failed to enqueue %s for %s: %v", models.EventLinkExpired, link.Short, err)
+			continue
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// WatchWebhooks доставляет события каждые interval и ищет истёкшие ссылки раз в
+// ExpiryInterval, пока не вызван stop
+func (s *URLService) WatchWebhooks(interval time.Duration) (stop func()) {
+	if s.webhooks == nil {
+		return func() {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		deliver := time.NewTicker(interval)
+		defer deliver.Stop()
+		expiry := time.NewTicker(s.webhooks.ExpiryInterval)
+		defer expiry.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-expiry.C:
+				if _, err := s.NotifyExpired(ctx); err != nil {
+					log.Printf("Failed to look for expired links: %v", err)
+				}
+			case <-deliver.C:
+				if _, err := s.DeliverWebhooks(ctx); err != nil {
+					log.Printf("Failed to deliver webhooks: %v", err)
+				}
+			}
+		}
+	}()
+	return cancel
+}
+
+// emit кладёт в очередь доставки событие, не связанное с записью ссылки (порог переходов,
+// окончание срока); события изменений передаются в репозиторий через linkEvents. ID события детерминирован, поэтому
+// повтор того же события (например, при гонке переходов) в очередь не попадает.
+// Событие о случившемся изменении ставится в очередь, даже если запрос уже отменён.
+func (s *URLService) emit(ctx context.Context, eventType string, link *models.URL, threshold int) {
+	if s.webhooks == nil {
+		return
+	}
+	ctx = context.WithoutCancel(ctx)
+
+	event := s.webhookEvent(eventType, link, threshold)
+	if err := s.repo.EnqueueWebhookEvent(ctx, link.Owner, event); err != nil {
+		log.Printf("Failed to enqueue %s for %s: %v", eventType, link.Short, err)
+	}
+}
+
+// linkEvents возвращает событие об изменении link для записи в одной транзакции с самим
+// изменением; без настроенных вебхуков — пустой список
+func (s *URLService) linkEvents(eventType string, link *models.URL) []*models.WebhookEvent {
+	if s.webhooks == nil {
+		return nil
+	}
+	return []*models.WebhookEvent{s.webhookEvent(eventType, link, 0)}
+}
+
+func (s *URLService) webhookEvent(eventType string, link *models.URL, threshold int) *models.WebhookEvent {
+	now := s.now()
+	id := fmt.Sprintf("%s:%s", eventType, linkID(link))
+	switch eventType {
+	case models.EventLinkUpdated:
+		// ревизия ссылки — время сохранённых метаданных (в точности колонки), поэтому
+		// повторная запись той же ревизии даёт тот же ID
+		if link.Metadata.FetchedAt != nil {
+			id = fmt.Sprintf("%s:%d", id, link.Metadata.FetchedAt.UnixMicro())
+		}
+	case models.EventLinkClickThreshold:
+		id = fmt.Sprintf("%s:%d", id, threshold)
+	}
+
+	return &models.WebhookEvent{
+		ID:        id,
+		Type:      eventType,
+		CreatedAt: now,
+		Link:      link,
+		ShortLink: s.linkURLs(link.Domain, link.Short).ShortLink,
+		Threshold: threshold,
+	}
+}
+
+// emitClickThreshold отправляет link.clicks_threshold для порогов, которые счётчик пересёк,
+// изменившись с before на clicks. Значения берутся из самого UPDATE, а не из прочитанной
+// (возможно, закешированной) ссылки, поэтому каждый порог срабатывает ровно один раз.
+func (s *URLService) emitClickThreshold(ctx context.Context, link *models.URL, before, clicks int) {
+	if s.webhooks == nil {
+		return
+	}
+	for _, threshold := range s.webhooks.ClickThresholds {
+		if before < threshold && threshold <= clicks {
+			reached := *link
+			reached.Clicks = clicks
+			s.emit(ctx, models.EventLinkClickThreshold, &reached, threshold)
+		}
+	}
+}
+
+// linkID — код ссылки с доменом, уникальный в пределах инсталляции
+func linkID(link *models.URL) string {
+	if link.Domain == "" {
+		return link.Short
+	}
+	return link.Domain + "/" + link.Short
+}
+
+func knownEvent(event string) bool {
+	for _, known := range webhookEvents {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func invalidWebhook(format string, args ...interface{}) error {
+	return &policy.ValidationError{Code: CodeInvalidWebhook, Message: fmt.Sprintf(format, args...)}
+}
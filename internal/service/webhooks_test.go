@@ -0,0 +1,265 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+	"urlcutter/internal/blocklist"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+	"urlcutter/internal/webhook"
+)
+
+func TestAddWebhook_Validation(t *testing.T) {
+	ctx := context.Background()
+	svc := newTestService(newMockRepository(), WithWebhooks(WebhookConfig{}))
+
+	for _, req := range []*models.CreateWebhookRequest{
+		{URL: "http://127.0.0.1/hook"},
+		{URL: "https://hooks.example.com", Events: []string{"link.deleted"}},
+	} {
+		_, err := svc.AddWebhook(ctx, "acme", req)
+		var verr *policy.ValidationError
+		if !errors.As(err, &verr) || verr.Code != CodeInvalidWebhook {
+			t.Fatalf("expected %s for %+v, got %v", CodeInvalidWebhook, req, err)
+		}
+	}
+
+	hook, err := svc.AddWebhook(ctx, "acme", &models.CreateWebhookRequest{URL: "https://hooks.example.com"})
+	if err != nil || hook.Secret == "" || len(hook.Events) != len(webhookEvents) {
+		t.Fatalf("unexpected webhook: %+v, %v", hook, err)
+	}
+	hooks, _ := svc.ListWebhooks(ctx, "acme")
+	if len(hooks) != 1 || hooks[0].Secret != "" {
+		t.Fatalf("expected listed webhook without secret, got %+v", hooks)
+	}
+	if err := svc.DeleteWebhook(ctx, "other", hook.ID); err == nil {
+		t.Fatalf("expected other owner not to delete webhook")
+	}
+}
+
+func TestWebhookEvents(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("blocked.example\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	bl, err := blocklist.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	svc := newTestService(repo,
+		WithWebhooks(WebhookConfig{ClickThresholds: []int{2}}),
+		WithBlocklist(bl),
+	)
+	svc.now = func() time.Time { return now }
+	_ = repo.CreateWebhook(ctx, &models.Webhook{ID: "all", Owner: "acme", URL: "https://hooks.example.com", Events: webhookEvents})
+	_ = repo.CreateWebhook(ctx, &models.Webhook{ID: "created", Owner: "acme", URL: "https://hooks.example.com", Events: []string{models.EventLinkCreated}})
+
+	resp, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://example.com/a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if _, err := svc.Redirect(ctx, &models.RedirectRequest{Short: resp.ShortURL}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	notAfter := now.Add(-time.Hour)
+	_ = repo.Create(ctx, &models.URL{Id: "old111", Short: "old111", Owner: "acme", Original: "https://example.com/old", NotAfter: &notAfter})
+	for i := 0; i < 2; i++ {
+		if _, err := svc.NotifyExpired(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_ = repo.Create(ctx, &models.URL{Id: "bad111", Short: "bad111", Owner: "acme", Original: "https://blocked.example/x"})
+	if _, err := svc.RescanBlocklist(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	counts := make(map[string]int)
+	for _, e := range repo.outbox {
+		counts[e.msg.WebhookID+" "+e.msg.EventType]++
+	}
+	want := map[string]int{
+		"all " + models.EventLinkCreated:        1,
+		"created " + models.EventLinkCreated:    1,
+		"all " + models.EventLinkClickThreshold: 1,
+		"all " + models.EventLinkExpired:        1,
+		"all " + models.EventLinkDisabled:       1,
+	}
+	if len(counts) != len(want) {
+		t.Fatalf("unexpected events: %v", counts)
+	}
+	for key, n := range want {
+		if counts[key] != n {
+			t.Fatalf("expected %d of %q, got events %v", n, key, counts)
+		}
+	}
+
+	var event models.WebhookEvent
+	for _, e := range repo.outbox {
+		if e.msg.EventType == models.EventLinkClickThreshold {
+			_ = json.Unmarshal(e.msg.Payload, &event)
+		}
+	}
+	if event.Threshold != 2 || event.Link.Clicks != 2 || event.Link.Short != resp.ShortURL {
+		t.Fatalf("unexpected threshold event: %+v", event)
+	}
+}
+
+func TestNotifyExpired_OnlyOnceAndToExistingSubscriptions(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	svc := newTestService(repo, WithWebhooks(WebhookConfig{}))
+	svc.now = func() time.Time { return now }
+
+	notAfter := now.Add(-time.Hour)
+	_ = repo.Create(ctx, &models.URL{Id: "old111", Short: "old111", Owner: "acme", Original: "https://example.com/old", NotAfter: &notAfter})
+	_ = repo.CreateWebhook(ctx, &models.Webhook{ID: "before", Owner: "acme", URL: "https://hooks.example.com",
+		Events: webhookEvents, CreatedAt: notAfter.Add(-time.Minute)})
+	_ = repo.CreateWebhook(ctx, &models.Webhook{ID: "after", Owner: "acme", URL: "https://hooks.example.com",
+		Events: webhookEvents, CreatedAt: notAfter.Add(time.Minute)})
+
+	if n, err := svc.NotifyExpired(ctx); err != nil || n != 1 {
+		t.Fatalf("expected one expired link, got %d, %v", n, err)
+	}
+	if n, err := svc.NotifyExpired(ctx); err != nil || n != 0 {
+		t.Fatalf("expected notified link to be skipped, got %d, %v", n, err)
+	}
+	if len(repo.outbox) != 1 || repo.outbox[0].msg.WebhookID != "before" {
+		t.Fatalf("expected one event for the earlier subscription, got %+v", repo.outbox)
+	}
+}
+
+func TestLinkUpdatedEventID_FollowsRevision(t *testing.T) {
+	svc := newTestService(newMockRepository(), WithWebhooks(WebhookConfig{}))
+	fetched := time.Date(2025, 3, 1, 12, 0, 0, 123456789, time.UTC)
+	link := &models.URL{Short: "abc123", Metadata: models.LinkMetadata{FetchedAt: &fetched}}
+
+	first := svc.webhookEvent(models.EventLinkUpdated, link, 0)
+	svc.now = func() time.Time { return fetched.Add(time.Hour) }
+	again := svc.webhookEvent(models.EventLinkUpdated, link, 0)
+	if first.ID != again.ID || first.ID != "link.updated:abc123:1740830400123456" {
+		t.Fatalf("expected ID derived from the revision, got %q and %q", first.ID, again.ID)
+	}
+
+	next := fetched.Add(time.Second)
+	link.Metadata.FetchedAt = &next
+	if svc.webhookEvent(models.EventLinkUpdated, link, 0).ID == first.ID {
+		t.Fatalf("expected a new revision to get a new ID")
+	}
+}
+
+func TestCreateShortURL_EventOnlyWithLink(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo, WithWebhooks(WebhookConfig{}))
+	_ = repo.CreateWebhook(ctx, &models.Webhook{ID: "all", Owner: "acme", URL: "https://hooks.example.com", Events: webhookEvents})
+
+	repo.createErr = errors.New("insert failed")
+	if _, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://example.com/a"}); err == nil {
+		t.Fatal("expected create error")
+	}
+	if len(repo.outbox) != 0 {
+		t.Fatalf("failed create must not enqueue events, got %d", len(repo.outbox))
+	}
+
+	repo.createErr = nil
+	if _, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://example.com/a"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(repo.outbox) != 1 || repo.outbox[0].msg.EventType != models.EventLinkCreated {
+		t.Fatalf("expected link.created with the link, got %d events", len(repo.outbox))
+	}
+}
+
+func TestRedirect_ClickThresholdUsesUpdatedCounter(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockRepository()
+	svc := newTestService(repo, WithWebhooks(WebhookConfig{ClickThresholds: []int{2, 4}}))
+	_ = repo.CreateWebhook(ctx, &models.Webhook{ID: "all", Owner: "acme", URL: "https://hooks.example.com", Events: []string{models.EventLinkClickThreshold}})
+	_ = repo.Create(ctx, &models.URL{Id: "abc123", Short: "abc123", Owner: "acme", Original: "https://example.com"})
+
+	thresholds := func() []int {
+		var reached []int
+		for _, e := range repo.outbox {
+			var event models.WebhookEvent
+			_ = json.Unmarshal(e.msg.Payload, &event)
+			reached = append(reached, event.Threshold)
+		}
+		return reached
+	}
+
+	_, _ = svc.Redirect(ctx, &models.RedirectRequest{Short: "abc123"})
+	if got := thresholds(); len(got) != 0 {
+		t.Fatalf("first click must not reach threshold 2, got %v", got)
+	}
+	_, _ = svc.Redirect(ctx, &models.RedirectRequest{Short: "abc123"})
+	if got := thresholds(); len(got) != 1 || got[0] != 2 {
+		t.Fatalf("expected threshold 2 on the second click, got %v", got)
+	}
+
+	// Третий переход засчитал другой инстанс: порог 4 достигается следующим переходом здесь
+	_, _ = repo.IncrementClicks(ctx, "", "abc123")
+	_, _ = svc.Redirect(ctx, &models.RedirectRequest{Short: "abc123"})
+	if got := thresholds(); len(got) != 2 || got[1] != 4 {
+		t.Fatalf("expected threshold 4 on the fourth click, got %v", got)
+	}
+}
+
+func TestDeliverWebhooks_Retry(t *testing.T) {
+	ctx := context.Background()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	repo := newMockRepository()
+	sender := webhook.NewSender(webhook.Config{AllowPrivate: true, Backoff: time.Minute})
+	svc := newTestService(repo, WithWebhooks(WebhookConfig{Sender: sender}))
+	now := time.Now()
+	svc.now = func() time.Time { return now }
+
+	hook, err := svc.AddWebhook(ctx, "acme", &models.CreateWebhookRequest{URL: "https://hooks.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Политика не пускает адреса тестового сервера, поэтому подменяем адрес в хранилище
+	repo.webhooks[hook.ID].URL = srv.URL
+	if _, err := svc.CreateShortURL(ctx, "acme", &models.CreateURLRequest{URL: "https://example.com"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if delivered, err := svc.DeliverWebhooks(context.Background()); err != nil || delivered != 0 {
+		t.Fatalf("expected failed first attempt, got %d, %v", delivered, err)
+	}
+	if delivered, _ := svc.DeliverWebhooks(context.Background()); delivered != 0 || calls != 1 {
+		t.Fatalf("expected no attempt before backoff, got %d calls", calls)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if delivered, _ := svc.DeliverWebhooks(context.Background()); delivered != 1 {
+		t.Fatalf("expected delivery after backoff")
+	}
+
+	log, err := svc.WebhookDeliveries(ctx, "acme", hook.ID)
+	if err != nil || len(log) != 2 || !log[0].Success || log[0].Attempt != 2 || log[1].StatusCode != http.StatusInternalServerError {
+		t.Fatalf("unexpected delivery log: %+v, %v", log, err)
+	}
+}
@@ -0,0 +1,184 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+	"urlcutter/internal/models"
+	"urlcutter/internal/policy"
+)
+
+// Заголовки запроса вебхука
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	TimestampHeader = "X-Webhook-Timestamp"
+	EventHeader     = "X-Webhook-Event"
+	IDHeader        = "X-Webhook-ID"
+)
+
+const (
+	defaultTimeout     = 10 * time.Second
+	defaultMaxAttempts = 8
+	defaultBackoff     = 30 * time.Second
+	defaultMaxBackoff  = 6 * time.Hour
+	defaultUserAgent   = "URLcutter-Webhooks/1.0"
+)
+
+type Config struct {
+	// Timeout ограничивает одну попытку доставки
+	Timeout time.Duration
+	// MaxAttempts — после стольких неудачных попыток доставка прекращается
+	MaxAttempts int
+	// Backoff — пауза перед второй попыткой; каждая следующая вдвое длиннее, но не
+	// больше MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	UserAgent  string
+	// AllowPrivate разрешает соединения с приватными адресами (только для тестов)
+	AllowPrivate bool
+}
+
+// Sender отправляет события подписчикам POST-запросами с JSON-телом, подписанным
+// HMAC-SHA256 секретом подписки
+type Sender struct {
+	cfg    Config
+	client *http.Client
+	now    func() time.Time
+}
+
+func NewSender(cfg Config) *Sender {
+	if cfg.Timeout == 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.MaxAttempts == 0 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.Backoff == 0 {
+		cfg.Backoff = defaultBackoff
+	}
+	if cfg.MaxBackoff == 0 {
+		cfg.MaxBackoff = defaultMaxBackoff
+	}
+	if cfg.UserAgent == "" {
+		cfg.UserAgent = defaultUserAgent
+	}
+
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		dialer.Control = policy.DenyPrivateControl
+	}
+	return &Sender{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: &http.Transport{DialContext: dialer.DialContext},
+			// Редирект считается ошибкой доставки: подписчик должен указать точный адрес
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		now: time.Now,
+	}
+}
+
+// Sign возвращает подпись тела: HMAC-SHA256 от "timestamp.body" в hex с префиксом sha256=
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify проверяет подпись тела, полученного вместе с timestamp
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Backoff возвращает паузу перед попыткой attempt+1 после неудачной попытки attempt
+func (s *Sender) Backoff(attempt int) time.Duration {
+	delay := s.cfg.Backoff
+	for i := 1; i < attempt; i++ {
+		delay *= 2
+		if delay >= s.cfg.MaxBackoff {
+			return s.cfg.MaxBackoff
+		}
+	}
+	return delay
+}
+
+// Send делает очередную попытку доставки и возвращает запись журнала. Успехом считается
+// ответ 2xx; при неудаче NextAttemptAt содержит время повтора, пока не исчерпаны попытки.
+func (s *Sender) Send(ctx context.Context, msg *models.WebhookMessage) *models.WebhookDelivery {
+	delivery := &models.WebhookDelivery{
+		WebhookID: msg.WebhookID,
+		EventID:   msg.EventID,
+		EventType: msg.EventType,
+		Attempt:   msg.Attempts + 1,
+	}
+
+	start := s.now()
+	status, err := s.post(ctx, msg, start)
+	delivery.AttemptedAt = start
+	delivery.DurationMs = s.now().Sub(start).Milliseconds()
+	delivery.StatusCode = status
+	switch {
+	case err != nil:
+		delivery.Error = describe(err)
+	case status < 200 || status > 299:
+		delivery.Error = fmt.Sprintf("unexpected status %d", status)
+	default:
+		delivery.Success = true
+	}
+
+	if !delivery.Success && delivery.Attempt < s.cfg.MaxAttempts {
+		next := start.Add(s.Backoff(delivery.Attempt))
+		delivery.NextAttemptAt = &next
+	}
+	return delivery
+}
+
+func (s *Sender) post(ctx context.Context, msg *models.WebhookMessage, at time.Time) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.URL, bytes.NewReader(msg.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := at.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", s.cfg.UserAgent)
+	req.Header.Set(EventHeader, msg.EventType)
+	req.Header.Set(IDHeader, msg.EventID)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, Sign(msg.Secret, timestamp, msg.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Тело ответа не нужно, но дочитываем немного, чтобы соединение вернулось в пул
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+	return resp.StatusCode, nil
+}
+
+// describe превращает ошибку запроса в короткое описание для журнала доставки
+func describe(err error) string {
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if urlErr.Timeout() {
+			return "timeout"
+		}
+		return urlErr.Err.Error()
+	}
+	return err.Error()
+}
@@ -0,0 +1,88 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+	"urlcutter/internal/models"
+)
+
+func TestSend_Signed(t *testing.T) {
+	var got *http.Request
+	var body []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	msg := &models.WebhookMessage{
+		WebhookID: "wh1", EventID: "link.created:abc123", EventType: models.EventLinkCreated,
+		URL: srv.URL, Secret: "s3cret", Payload: []byte(`{"type":"link.created"}`),
+	}
+	delivery := NewSender(Config{AllowPrivate: true}).Send(context.Background(), msg)
+	if !delivery.Success || delivery.StatusCode != http.StatusOK || delivery.Attempt != 1 || delivery.NextAttemptAt != nil {
+		t.Fatalf("unexpected delivery: %+v", delivery)
+	}
+
+	timestamp, err := strconv.ParseInt(got.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		t.Fatalf("bad timestamp header: %v", err)
+	}
+	if !Verify("s3cret", timestamp, body, got.Header.Get(SignatureHeader)) {
+		t.Fatalf("signature does not match body")
+	}
+	if Verify("other", timestamp, body, got.Header.Get(SignatureHeader)) {
+		t.Fatalf("signature must depend on secret")
+	}
+	if got.Header.Get(EventHeader) != models.EventLinkCreated || got.Header.Get(IDHeader) != msg.EventID {
+		t.Fatalf("unexpected headers: %v", got.Header)
+	}
+}
+
+func TestSend_Retries(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	s := NewSender(Config{AllowPrivate: true, MaxAttempts: 3, Backoff: time.Minute})
+	msg := &models.WebhookMessage{URL: srv.URL, Payload: []byte(`{}`), Attempts: 1}
+
+	delivery := s.Send(context.Background(), msg)
+	if delivery.Success || delivery.Attempt != 2 || delivery.NextAttemptAt == nil {
+		t.Fatalf("expected retry, got %+v", delivery)
+	}
+	if wait := delivery.NextAttemptAt.Sub(delivery.AttemptedAt); wait != 2*time.Minute {
+		t.Fatalf("expected backoff 2m after second attempt, got %v", wait)
+	}
+
+	msg.Attempts = 2
+	if delivery := s.Send(context.Background(), msg); delivery.NextAttemptAt != nil {
+		t.Fatalf("expected no retry after last attempt, got %+v", delivery)
+	}
+}
+
+func TestSend_PrivateAddress(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer srv.Close()
+
+	delivery := NewSender(Config{}).Send(context.Background(), &models.WebhookMessage{URL: srv.URL})
+	if delivery.Success || delivery.Error == "" {
+		t.Fatalf("expected connection to private address to be refused, got %+v", delivery)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	s := NewSender(Config{Backoff: time.Second, MaxBackoff: 5 * time.Second})
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := s.Backoff(i + 1); got != w {
+			t.Fatalf("attempt %d: expected %v, got %v", i+1, w, got)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package bloom
+
+import (
+	"hash/fnv"
+	"math"
+	"sync"
+)
+
+// Filter — фильтр Блума: Test может ошибочно ответить «есть», но никогда не ответит
+// «нет» для добавленного ключа. Безопасен для параллельного использования.
+type Filter struct {
+	mu    sync.RWMutex
+	bits  []uint64
+	m     uint64
+	k     uint64
+	added uint64
+}
+
+// New рассчитывает фильтр на n ключей с долей ложных срабатываний p
+func New(n int, p float64) *Filter {
+	if n < 1 {
+		n = 1
+	}
+	if p <= 0 || p >= 1 {
+		p = 0.01
+	}
+	m := uint64(math.Ceil(-float64(n) * math.Log(p) / (math.Ln2 * math.Ln2)))
+	k := uint64(math.Round(float64(m) / float64(n) * math.Ln2))
+	if k < 1 {
+		k = 1
+	}
+	m = (m + 63) / 64 * 64
+	return &Filter{bits: make([]uint64, m/64), m: m, k: k}
+}
+
+// Add добавляет ключ и сообщает, был ли он новым для фильтра. Ключ, на который Test
+// уже отвечал «есть», в Added не учитывается.
+func (f *Filter) Add(key string) bool {
+	h1, h2 := hashes(key)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	added := false
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		mask := uint64(1) << (bit % 64)
+		if f.bits[bit/64]&mask == 0 {
+			f.bits[bit/64] |= mask
+			added = true
+		}
+	}
+	if added {
+		f.added++
+	}
+	return added
+}
+
+// Test сообщает, мог ли ключ быть добавлен
+func (f *Filter) Test(key string) bool {
+	h1, h2 := hashes(key)
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	for i := uint64(0); i < f.k; i++ {
+		bit := (h1 + i*h2) % f.m
+		if f.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Added возвращает число новых ключей, добавленных в фильтр
+func (f *Filter) Added() uint64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return f.added
+}
+
+// FalsePositiveRate оценивает текущую долю ложных срабатываний по числу новых ключей
+func (f *Filter) FalsePositiveRate() float64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return math.Pow(1-math.Exp(-float64(f.k)*float64(f.added)/float64(f.m)), float64(f.k))
+}
+
+// hashes даёт две независимые половины 64-битного FNV-1a для двойного хеширования
+func hashes(key string) (uint64, uint64) {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	sum := h.Sum64()
+	h1, h2 := sum&0xffffffff, sum>>32
+	// Нечётный шаг не зацикливается на части битов
+	return h1, h2 | 1
+}
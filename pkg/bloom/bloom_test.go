@@ -0,0 +1,41 @@
+package bloom
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFilter(t *testing.T) {
+	f := New(10000, 0.01)
+	for i := 0; i < 10000; i++ {
+		f.Add(fmt.Sprintf("code%d", i))
+	}
+	for i := 0; i < 10000; i++ {
+		if !f.Test(fmt.Sprintf("code%d", i)) {
+			t.Fatalf("added key code%d not found", i)
+		}
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if f.Test(fmt.Sprintf("missing%d", i)) {
+			falsePositives++
+		}
+	}
+	if rate := float64(falsePositives) / 10000; rate > 0.03 {
+		t.Fatalf("false positive rate %.3f is too high", rate)
+	}
+	if rate := f.FalsePositiveRate(); rate < 0.005 || rate > 0.02 {
+		t.Fatalf("unexpected estimated rate %.4f", rate)
+	}
+
+	added := f.Added()
+	for i := 0; i < 10000; i++ {
+		if f.Add(fmt.Sprintf("code%d", i)) {
+			t.Fatalf("expected code%d to be known", i)
+		}
+	}
+	if f.Added() != added {
+		t.Fatalf("expected repeated keys not to be counted, got %d after %d", f.Added(), added)
+	}
+}
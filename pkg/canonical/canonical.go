@@ -0,0 +1,103 @@
+package canonical
+
+import (
+	"net"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// DefaultTrackingParams — параметры, которые не влияют на содержимое страницы.
+// Запись с * на конце задаёт префикс.
+var DefaultTrackingParams = []string{
+	"utm_*", "fbclid", "gclid", "dclid", "yclid", "msclkid", "mc_cid", "mc_eid", "igshid", "_ga", "_gl",
+}
+
+type Options struct {
+	// StripTracking удаляет параметры отслеживания
+	StripTracking bool
+	// TrackingParams переопределяет DefaultTrackingParams
+	TrackingParams []string
+	// StripFragment удаляет фрагмент. По умолчанию он сохраняется: в одностраничных
+	// приложениях #/route указывает на разные страницы.
+	StripFragment bool
+}
+
+var defaultPorts = map[string]string{
+	"http":  "80",
+	"https": "443",
+}
+
+// Canonicalize приводит URL к канонической форме для поиска дубликатов: схема и хост в нижнем
+// регистре, без порта по умолчанию, с нормализованным путём и отсортированным query
+func Canonicalize(raw string, opts Options) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	port := u.Port()
+	if port == defaultPorts[u.Scheme] {
+		port = ""
+	}
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host = net.JoinHostPort(strings.Trim(host, "[]"), port)
+	}
+	u.Host = host
+	if opts.StripFragment {
+		u.Fragment = ""
+		u.RawFragment = ""
+	}
+
+	u.Path = normalizePath(u.Path)
+	u.RawPath = ""
+
+	query := u.Query()
+	if opts.StripTracking {
+		params := opts.TrackingParams
+		if params == nil {
+			params = DefaultTrackingParams
+		}
+		for key := range query {
+			if isTracking(key, params) {
+				query.Del(key)
+			}
+		}
+	}
+	// Encode сортирует параметры по имени
+	u.RawQuery = query.Encode()
+	u.ForceQuery = false
+
+	return u.String(), nil
+}
+
+func normalizePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+	trailing := strings.HasSuffix(p, "/")
+	p = path.Clean(p)
+	if trailing && p != "/" {
+		p += "/"
+	}
+	return p
+}
+
+func isTracking(key string, params []string) bool {
+	key = strings.ToLower(key)
+	for _, p := range params {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == p {
+			return true
+		}
+	}
+	return false
+}
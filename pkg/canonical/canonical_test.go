@@ -0,0 +1,40 @@
+package canonical
+
+import "testing"
+
+func TestCanonicalize(t *testing.T) {
+	cases := []struct {
+		in, out string
+		opts    Options
+	}{
+		{in: "https://Example.com", out: "https://example.com/"},
+		{in: "HTTPS://EXAMPLE.COM:443/", out: "https://example.com/"},
+		{in: "http://example.com:8080/a", out: "http://example.com:8080/a"},
+		{in: "https://example.com/a/./b/../c/", out: "https://example.com/a/c/"},
+		{in: "https://example.com/%7Euser", out: "https://example.com/~user"},
+		{in: "https://example.com/?b=2&a=1", out: "https://example.com/?a=1&b=2"},
+		{in: "https://example.com/app#/orders", out: "https://example.com/app#/orders"},
+		{in: "https://example.com/page#section", out: "https://example.com/page", opts: Options{StripFragment: true}},
+		{in: "https://example.com/?", out: "https://example.com/"},
+		{
+			in:   "https://example.com/?utm_source=x&id=7&fbclid=abc&UTM_Medium=y",
+			out:  "https://example.com/?id=7",
+			opts: Options{StripTracking: true},
+		},
+		{
+			in:   "https://example.com/?utm_source=x&ref=home",
+			out:  "https://example.com/?utm_source=x",
+			opts: Options{StripTracking: true, TrackingParams: []string{"ref"}},
+		},
+	}
+
+	for _, c := range cases {
+		got, err := Canonicalize(c.in, c.opts)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", c.in, err)
+		}
+		if got != c.out {
+			t.Errorf("%s: expected %s, got %s", c.in, c.out, got)
+		}
+	}
+}
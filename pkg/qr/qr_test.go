@@ -0,0 +1,79 @@
+package qr
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestEncodePNG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Foreground = color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}
+
+	data, err := Encode("abc", PNG, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("expected valid PNG: %v", err)
+	}
+
+	b := img.Bounds()
+	if b.Dx() != b.Dy() || b.Dx() > opts.Size || b.Dx() < opts.Size/2 {
+		t.Fatalf("unexpected image size %v", b)
+	}
+	// Поле пустое, а левый верхний угол метки позиционирования — тёмный
+	if r, g, bl, _ := img.At(0, 0).RGBA(); r>>8 != 0xff || g>>8 != 0xff || bl>>8 != 0xff {
+		t.Fatalf("expected background in margin")
+	}
+	scale := b.Dx() / (21 + 2*opts.Margin)
+	if r, _, _, _ := img.At(opts.Margin*scale, opts.Margin*scale).RGBA(); r>>8 != 0x11 {
+		t.Fatalf("expected foreground color in finder pattern")
+	}
+}
+
+func TestEncodeSVG(t *testing.T) {
+	opts := DefaultOptions()
+	opts.Margin = 0
+
+	data, err := Encode("abc", SVG, opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	svg := string(data)
+	if !strings.HasPrefix(svg, "<svg") || !strings.Contains(svg, `viewBox="0 0 21 21"`) || !strings.Contains(svg, "M0 0h7v1h-7z") {
+		t.Fatalf("unexpected svg: %s", svg)
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	for _, mutate := range []func(*Options){
+		func(o *Options) { o.Size = 10 },
+		func(o *Options) { o.Margin = -1 },
+		func(o *Options) { o.Level = "X" },
+	} {
+		opts := DefaultOptions()
+		mutate(&opts)
+		if _, err := Encode("x", PNG, opts); err == nil {
+			t.Fatalf("expected validation error for %+v", opts)
+		}
+	}
+}
+
+func TestParseColor(t *testing.T) {
+	for in, want := range map[string]color.RGBA{
+		"#1a2b3c": {R: 0x1a, G: 0x2b, B: 0x3c, A: 0xff},
+		"fff":     {R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+	} {
+		got, err := ParseColor(in)
+		if err != nil || got != want {
+			t.Fatalf("%s: expected %v, got %v (%v)", in, want, got, err)
+		}
+	}
+	if _, err := ParseColor("#12345z"); err == nil {
+		t.Fatalf("expected error for invalid color")
+	}
+}
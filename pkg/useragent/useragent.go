@@ -0,0 +1,87 @@
+package useragent
+
+import "strings"
+
+const (
+	OSiOS      = "ios"
+	OSAndroid  = "android"
+	OSWindows  = "windows"
+	OSMacOS    = "macos"
+	OSLinux    = "linux"
+	OSChromeOS = "chromeos"
+	OSOther    = "other"
+
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceDesktop = "desktop"
+	DeviceBot     = "bot"
+)
+
+// Info — платформа посетителя, определённая по User-Agent
+type Info struct {
+	OS     string
+	Device string
+}
+
+var botMarkers = []string{"bot", "crawler", "spider", "slurp", "facebookexternalhit", "preview"}
+
+// previewMarkers — боты мессенджеров и соцсетей, которые строят карточку ссылки
+var previewMarkers = []string{
+	"facebookexternalhit", "facebot", "twitterbot", "slackbot-linkexpanding", "slack-imgproxy",
+	"discordbot", "telegrambot", "linkedinbot", "skypeuripreview", "vkshare",
+	"pinterestbot", "redditbot", "embedly", "iframely", "mastodon/", "snap url preview",
+}
+
+// previewPrefixes — сборщики превью приложений, чьи встроенные браузеры тоже называют себя
+// в UA; сборщик отличается тем, что UA начинается с имени приложения, а не с Mozilla/
+var previewPrefixes = []string{"whatsapp/", "viber/"}
+
+// IsLinkPreview сообщает, что запрос пришёл от бота, который строит превью ссылки в чате или ленте
+func IsLinkPreview(ua string) bool {
+	s := strings.ToLower(ua)
+	for _, marker := range previewMarkers {
+		if strings.Contains(s, marker) {
+			return true
+		}
+	}
+	for _, prefix := range previewPrefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse грубо определяет ОС и класс устройства; точности достаточно для правил таргетинга
+func Parse(ua string) Info {
+	s := strings.ToLower(ua)
+
+	info := Info{OS: OSOther, Device: DeviceDesktop}
+	switch {
+	case strings.Contains(s, "iphone"), strings.Contains(s, "ipod"):
+		info.OS, info.Device = OSiOS, DeviceMobile
+	case strings.Contains(s, "ipad"):
+		info.OS, info.Device = OSiOS, DeviceTablet
+	case strings.Contains(s, "android"):
+		info.OS, info.Device = OSAndroid, DeviceTablet
+		if strings.Contains(s, "mobile") {
+			info.Device = DeviceMobile
+		}
+	case strings.Contains(s, "windows"):
+		info.OS = OSWindows
+	case strings.Contains(s, "cros"):
+		info.OS = OSChromeOS
+	case strings.Contains(s, "mac os x"), strings.Contains(s, "macintosh"):
+		info.OS = OSMacOS
+	case strings.Contains(s, "linux"):
+		info.OS = OSLinux
+	}
+
+	for _, marker := range botMarkers {
+		if strings.Contains(s, marker) {
+			info.Device = DeviceBot
+			break
+		}
+	}
+	return info
+}
@@ -0,0 +1,49 @@
+package useragent
+
+import "testing"
+
+func TestParse(t *testing.T) {
+	cases := []struct {
+		ua   string
+		want Info
+	}{
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148", Info{OSiOS, DeviceMobile}},
+		{"Mozilla/5.0 (iPad; CPU OS 16_6 like Mac OS X) AppleWebKit/605.1.15", Info{OSiOS, DeviceTablet}},
+		{"Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36", Info{OSAndroid, DeviceMobile}},
+		{"Mozilla/5.0 (Linux; Android 13; SM-X700) AppleWebKit/537.36 Chrome/120.0 Safari/537.36", Info{OSAndroid, DeviceTablet}},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0", Info{OSWindows, DeviceDesktop}},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/605.1.15 Safari/605.1.15", Info{OSMacOS, DeviceDesktop}},
+		{"Mozilla/5.0 (X11; CrOS x86_64 15633.69.0) AppleWebKit/537.36", Info{OSChromeOS, DeviceDesktop}},
+		{"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)", Info{OSOther, DeviceBot}},
+		{"", Info{OSOther, DeviceDesktop}},
+	}
+	for _, c := range cases {
+		if got := Parse(c.ua); got != c.want {
+			t.Errorf("%q: expected %+v, got %+v", c.ua, c.want, got)
+		}
+	}
+}
+
+func TestIsLinkPreview(t *testing.T) {
+	cases := map[string]bool{
+		"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)":          true,
+		"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)":                         true,
+		"TelegramBot (like TwitterBot)":                                                      true,
+		"WhatsApp/2.23.20.0":                                                                 true,
+		"Viber/20.3.0 (Android)":                                                             true,
+		"Mozilla/5.0 (compatible; Snap URL Preview Service; bot; snapchat_preview@snap.com)": true,
+		"Mastodon/4.2.0 (http.rb/5.1.1; +https://mastodon.social/)":                          true,
+		// Встроенные браузеры мессенджеров — это люди, а не сборщики превью
+		"Mozilla/5.0 (Linux; Android 13; SM-S911B; wv) AppleWebKit/537.36 Chrome/120.0 Mobile Safari/537.36 WhatsApp/2.23.20.0":             false,
+		"Mozilla/5.0 (Linux; Android 12; Pixel 6) AppleWebKit/537.36 Chrome/119.0 Mobile Safari/537.36 Viber/20.3.0":                        false,
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_1 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148 Snapchat/12.60.0.48 (like Safari/604.1)": false,
+		"Mozilla/5.0 (compatible; Discordbot/2.0; +https://discordapp.com)":                                                                 true,
+		"Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)":                                                          false,
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/120.0 Safari/537.36":                                           false,
+	}
+	for ua, want := range cases {
+		if got := IsLinkPreview(ua); got != want {
+			t.Errorf("%q: expected %v, got %v", ua, want, got)
+		}
+	}
+}
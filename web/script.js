@@ -1,4 +1,10 @@
-const API_BASE = 'http://localhost:8080/api/v1';
+const API_BASE = `${window.location.origin}/api/v1`;
+
+// Полный адрес короткой ссылки: брендированный домен ссылки или текущий сервер
+function buildShortUrl(code, domain) {
+    const origin = domain ? `https://${domain}` : window.location.origin;
+    return `${origin}/${code}`;
+}
 
 const shortenForm = document.getElementById('shortenForm');
 const lookupForm = document.getElementById('lookupForm');
@@ -53,7 +59,8 @@ shortenForm.addEventListener('submit', async function(e) {
         
         const data = await response.json();
         
-        const shortUrl = `http://localhost:8080/${data.short_url}`;
+        const shortUrl = data.short_link || buildShortUrl(data.short_url, data.domain);
+        const qrUrl = data.qr_url || `${API_BASE}/url/${data.short_url}/qr`;
         const resultHTML = `
             <div class="success-url">
                 <div>
@@ -66,6 +73,10 @@ shortenForm.addEventListener('submit', async function(e) {
                 <strong>Оригинальный URL:</strong><br>
                 <a href="${url}" target="_blank">${url}</a>
             </div>
+            <div class="url-display">
+                <strong>QR‑код:</strong><br>
+                <img src="${qrUrl}${qrUrl.includes('?') ? '&' : '?'}size=160" alt="QR" width="160" height="160">
+            </div>
             <div class="test-redirect">
                 <button onclick="testRedirect('${data.short_url}')" class="test-btn">🔗 Протестировать редирект</button>
             </div>
@@ -105,8 +116,10 @@ lookupForm.addEventListener('submit', async function(e) {
         
         const data = await response.json();
         
-        const shortUrl = `http://localhost:8080/${data.short_url}`;
+        const shortUrl = data.short_link || buildShortUrl(data.short_url, data.domain);
+        const meta = data.metadata || {};
         const resultHTML = `
+            ${meta.title ? '<div class="url-display" id="lookupMetadata"></div>' : ''}
             <div class="url-display">
                 <strong>Короткая ссылка:</strong><br>
                 <a href="${shortUrl}" target="_blank" class="short-url-link">${shortUrl}</a>
@@ -115,6 +128,11 @@ lookupForm.addEventListener('submit', async function(e) {
                 <strong>Оригинальный URL:</strong><br>
                 <a href="${data.original_url}" target="_blank">${data.original_url}</a>
             </div>
+            ${data.final_url && data.final_url !== data.original_url ? `
+            <div class="url-display">
+                <strong>Итоговый URL (с UTM‑метками):</strong><br>
+                <a href="${data.final_url}" target="_blank">${data.final_url}</a>
+            </div>` : ''}
             <div class="url-info">
                 <strong>Статистика:</strong><br>
                 • Кликов: ${data.clicks || 0}<br>
@@ -127,6 +145,9 @@ lookupForm.addEventListener('submit', async function(e) {
         `;
         
         showResult(lookupResultDiv, resultHTML);
+        if (meta.title) {
+            renderMetadata(document.getElementById('lookupMetadata'), meta);
+        }
         shortCodeInput.value = '';
         
     } catch (error) {
@@ -140,7 +161,7 @@ async function testRedirect(shortCode) {
     try {
         showInfo(redirectResultDiv, 'Тестируем редирект...');
         
-        const response = await fetch(`http://localhost:8080/${shortCode}`, {
+        const response = await fetch(`${window.location.origin}/${shortCode}`, {
             method: 'GET',
             redirect: 'manual'
         });
@@ -149,7 +170,7 @@ async function testRedirect(shortCode) {
             const redirectUrl = response.headers.get('Location');
             showResult(redirectResultDiv, `
                 <strong>✅ Редирект работает!</strong><br>
-                <strong>Короткая ссылка:</strong> http://localhost:8080/${shortCode}<br>
+                <strong>Короткая ссылка:</strong> ${window.location.origin}/${shortCode}<br>
                 <strong>Перенаправление на:</strong> <a href="${redirectUrl}" target="_blank">${redirectUrl}</a><br>
                 <strong>Статус:</strong> ${response.status}
             `);
@@ -183,7 +204,7 @@ async function checkHealth() {
     dbStatus.className = 'status checking';
     
     try {
-        const response = await fetch('http://localhost:8080/health');
+        const response = await fetch(`${window.location.origin}/health`);
         if (response.ok) {
             apiStatus.textContent = 'Онлайн';
             apiStatus.className = 'status online';
@@ -201,6 +222,56 @@ async function checkHealth() {
     }
 }
 
+// Метаданные приходят со стороннего сайта, поэтому собираются через DOM, а не innerHTML
+function renderMetadata(container, meta) {
+    const favicon = safeImageURL(meta.favicon);
+    if (favicon) {
+        const img = document.createElement('img');
+        img.src = favicon;
+        img.alt = '';
+        img.width = 16;
+        img.height = 16;
+        container.append(img, ' ');
+    }
+
+    const title = document.createElement('strong');
+    title.textContent = meta.title;
+    container.append(title);
+
+    if (meta.description) {
+        container.append(document.createElement('br'), meta.description);
+    }
+
+    const image = safeImageURL(meta.image);
+    if (image) {
+        const img = document.createElement('img');
+        img.src = image;
+        img.alt = '';
+        img.style.maxWidth = '100%';
+        img.style.maxHeight = '160px';
+        container.append(document.createElement('br'), img);
+    }
+}
+
+// Адрес картинки допускается только по http(s); иначе возвращается пустая строка
+function safeImageURL(raw) {
+    if (!raw) {
+        return '';
+    }
+    try {
+        const url = new URL(raw, window.location.href);
+        return url.protocol === 'http:' || url.protocol === 'https:' ? url.href : '';
+    } catch {
+        return '';
+    }
+}
+
+function escapeHTML(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
 async function copyToClipboard(text) {
     try {
         await navigator.clipboard.writeText(text);